@@ -0,0 +1,506 @@
+package odin
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Condition 角色权限绑定的附加条件，使用内置的表达式语言描述，只有条件成立时绑定才有效。
+//
+// 表达式支持：
+//   - 字面量：数字（1000、0.5）、字符串（'abc' 或者 "abc"）、true、false、null 及列表（[1, 2, 3]）
+//   - 属性：如 amount、order.owner，值从验证权限时传入的 attrs 中获取，可以使用 . 访问嵌套的 map[string]interface{}，属性不存在时为 null
+//   - 比较运算：==、!=、<、<=、>、>=，以及 in（如 dept in ['sales', 'support']）
+//   - 逻辑运算：&&、||、!，以及 ( ) 分组
+//
+// 如：amount < 1000 && currency == 'CNY'、hour >= 9 && hour < 18
+type Condition struct {
+	text string
+	root condNode
+}
+
+// ParseCondition 解析条件表达式，表达式不合法时返回 *ConditionError
+func ParseCondition(text string) (*Condition, error) {
+	var p = &condParser{text: text}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != condEOF {
+		return nil, p.errorf("无法识别的内容 %s", p.tok.text)
+	}
+	return &Condition{text: text, root: root}, nil
+}
+
+// String 返回条件表达式的原文
+func (this *Condition) String() string {
+	return this.text
+}
+
+// Eval 使用 attrs 计算条件表达式，表达式的结果不是 bool 或者计算过程中出现类型不匹配时返回 *ConditionError
+func (this *Condition) Eval(attrs map[string]interface{}) (bool, error) {
+	value, err := this.root.eval(attrs)
+	if err != nil {
+		if cErr, ok := err.(*ConditionError); ok && cErr.Expr == "" {
+			cErr.Expr = this.text
+		}
+		return false, err
+	}
+	result, ok := value.(bool)
+	if ok == false {
+		return false, &ConditionError{Expr: this.text, Pos: -1, Msg: "表达式的结果不是 bool"}
+	}
+	return result, nil
+}
+
+type condKind int
+
+const (
+	condEOF condKind = iota
+	condNumber
+	condString
+	condIdent
+	condOp
+)
+
+type condToken struct {
+	kind condKind
+	text string
+	pos  int
+}
+
+type condParser struct {
+	text string
+	pos  int
+	tok  condToken
+}
+
+func (this *condParser) errorf(format string, args ...interface{}) error {
+	return newConditionError(this.text, this.tok.pos, format, args...)
+}
+
+// next 读取下一个 token
+func (this *condParser) next() error {
+	for this.pos < len(this.text) && unicode.IsSpace(rune(this.text[this.pos])) {
+		this.pos++
+	}
+	var start = this.pos
+	if start >= len(this.text) {
+		this.tok = condToken{kind: condEOF, pos: start}
+		return nil
+	}
+
+	var c = this.text[start]
+	switch {
+	case c >= '0' && c <= '9':
+		for this.pos < len(this.text) && (this.text[this.pos] >= '0' && this.text[this.pos] <= '9' || this.text[this.pos] == '.') {
+			this.pos++
+		}
+		this.tok = condToken{kind: condNumber, text: this.text[start:this.pos], pos: start}
+	case c == '\'' || c == '"':
+		var sb strings.Builder
+		this.pos++
+		for {
+			if this.pos >= len(this.text) {
+				return newConditionError(this.text, start, "字符串没有结束")
+			}
+			var ch = this.text[this.pos]
+			if ch == c {
+				this.pos++
+				break
+			}
+			if ch == '\\' && this.pos+1 < len(this.text) {
+				this.pos++
+				ch = this.text[this.pos]
+			}
+			sb.WriteByte(ch)
+			this.pos++
+		}
+		this.tok = condToken{kind: condString, text: sb.String(), pos: start}
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for this.pos < len(this.text) {
+			var ch = rune(this.text[this.pos])
+			if ch != '_' && ch != '.' && unicode.IsLetter(ch) == false && unicode.IsDigit(ch) == false {
+				break
+			}
+			this.pos++
+		}
+		this.tok = condToken{kind: condIdent, text: this.text[start:this.pos], pos: start}
+	default:
+		for _, op := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ","} {
+			if strings.HasPrefix(this.text[start:], op) {
+				this.pos += len(op)
+				this.tok = condToken{kind: condOp, text: op, pos: start}
+				return nil
+			}
+		}
+		return newConditionError(this.text, start, "无法识别的字符 %c", c)
+	}
+	return nil
+}
+
+func (this *condParser) isOp(op string) bool {
+	return this.tok.kind == condOp && this.tok.text == op
+}
+
+func (this *condParser) parseOr() (condNode, error) {
+	left, err := this.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for this.isOp("||") {
+		if err = this.next(); err != nil {
+			return nil, err
+		}
+		right, err := this.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &condLogic{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (this *condParser) parseAnd() (condNode, error) {
+	left, err := this.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for this.isOp("&&") {
+		if err = this.next(); err != nil {
+			return nil, err
+		}
+		right, err := this.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &condLogic{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (this *condParser) parseNot() (condNode, error) {
+	if this.isOp("!") {
+		if err := this.next(); err != nil {
+			return nil, err
+		}
+		node, err := this.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &condNot{node: node}, nil
+	}
+	return this.parseCompare()
+}
+
+func (this *condParser) parseCompare() (condNode, error) {
+	left, err := this.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	var op string
+	switch this.tok.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+		if this.tok.kind == condOp {
+			op = this.tok.text
+		}
+	case "in":
+		if this.tok.kind == condIdent {
+			op = "in"
+		}
+	}
+	if op == "" {
+		return left, nil
+	}
+	var pos = this.tok.pos
+	if err = this.next(); err != nil {
+		return nil, err
+	}
+	right, err := this.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return &condCompare{op: op, pos: pos, text: this.text, left: left, right: right}, nil
+}
+
+func (this *condParser) parseValue() (condNode, error) {
+	var tok = this.tok
+	switch tok.kind {
+	case condNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, this.errorf("无效的数字 %s", tok.text)
+		}
+		return &condLiteral{value: value}, this.next()
+	case condString:
+		return &condLiteral{value: tok.text}, this.next()
+	case condIdent:
+		switch tok.text {
+		case "true":
+			return &condLiteral{value: true}, this.next()
+		case "false":
+			return &condLiteral{value: false}, this.next()
+		case "null":
+			return &condLiteral{value: nil}, this.next()
+		case "in":
+			return nil, this.errorf("缺少运算对象")
+		}
+		return &condAttr{path: strings.Split(tok.text, ".")}, this.next()
+	case condOp:
+		switch tok.text {
+		case "(":
+			if err := this.next(); err != nil {
+				return nil, err
+			}
+			node, err := this.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if this.isOp(")") == false {
+				return nil, this.errorf("缺少 )")
+			}
+			return node, this.next()
+		case "[":
+			if err := this.next(); err != nil {
+				return nil, err
+			}
+			var list = &condList{}
+			for this.isOp("]") == false {
+				item, err := this.parseValue()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if this.isOp(",") {
+					if err = this.next(); err != nil {
+						return nil, err
+					}
+				} else if this.isOp("]") == false {
+					return nil, this.errorf("缺少 ]")
+				}
+			}
+			return list, this.next()
+		}
+	case condEOF:
+		return nil, this.errorf("表达式不完整")
+	}
+	return nil, this.errorf("无法识别的内容 %s", tok.text)
+}
+
+type condNode interface {
+	eval(attrs map[string]interface{}) (interface{}, error)
+}
+
+type condLiteral struct {
+	value interface{}
+}
+
+func (this *condLiteral) eval(attrs map[string]interface{}) (interface{}, error) {
+	return this.value, nil
+}
+
+type condAttr struct {
+	path []string
+}
+
+func (this *condAttr) eval(attrs map[string]interface{}) (interface{}, error) {
+	var value interface{} = attrs
+	for _, key := range this.path {
+		m, ok := value.(map[string]interface{})
+		if ok == false {
+			return nil, nil
+		}
+		value = m[key]
+	}
+	return normalizeCondValue(value), nil
+}
+
+type condList struct {
+	items []condNode
+}
+
+func (this *condList) eval(attrs map[string]interface{}) (interface{}, error) {
+	var values = make([]interface{}, 0, len(this.items))
+	for _, item := range this.items {
+		value, err := item.eval(attrs)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+type condNot struct {
+	node condNode
+}
+
+func (this *condNot) eval(attrs map[string]interface{}) (interface{}, error) {
+	b, err := evalCondBool(this.node, attrs, "!")
+	if err != nil {
+		return nil, err
+	}
+	return !b, nil
+}
+
+type condLogic struct {
+	op    string
+	left  condNode
+	right condNode
+}
+
+func (this *condLogic) eval(attrs map[string]interface{}) (interface{}, error) {
+	left, err := evalCondBool(this.left, attrs, this.op)
+	if err != nil {
+		return nil, err
+	}
+	// 短路求值
+	if this.op == "&&" && left == false || this.op == "||" && left {
+		return left, nil
+	}
+	return evalCondBool(this.right, attrs, this.op)
+}
+
+func evalCondBool(node condNode, attrs map[string]interface{}, op string) (bool, error) {
+	value, err := node.eval(attrs)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if ok == false {
+		return false, &ConditionError{Pos: -1, Msg: op + " 的运算对象不是 bool"}
+	}
+	return b, nil
+}
+
+type condCompare struct {
+	op    string
+	pos   int
+	text  string
+	left  condNode
+	right condNode
+}
+
+func (this *condCompare) eval(attrs map[string]interface{}) (interface{}, error) {
+	left, err := this.left.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	right, err := this.right.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	switch this.op {
+	case "==":
+		return condEqual(left, right), nil
+	case "!=":
+		return !condEqual(left, right), nil
+	case "in":
+		list, ok := right.([]interface{})
+		if ok == false {
+			return nil, newConditionError(this.text, this.pos, "in 的右侧不是列表")
+		}
+		for _, item := range list {
+			if condEqual(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	// 属性不存在时，大小比较的结果为 false
+	if left == nil || right == nil {
+		return false, nil
+	}
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if ok == false {
+			return nil, newConditionError(this.text, this.pos, "%s 的运算对象类型不一致", this.op)
+		}
+		cmp = compareFloat(l, r)
+	case string:
+		r, ok := right.(string)
+		if ok == false {
+			return nil, newConditionError(this.text, this.pos, "%s 的运算对象类型不一致", this.op)
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		return nil, newConditionError(this.text, this.pos, "%s 的运算对象只能是数字或者字符串", this.op)
+	}
+
+	switch this.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func compareFloat(l, r float64) int {
+	if l < r {
+		return -1
+	}
+	if l > r {
+		return 1
+	}
+	return 0
+}
+
+func condEqual(left, right interface{}) bool {
+	if l, ok := left.([]interface{}); ok {
+		r, ok := right.([]interface{})
+		if ok == false || len(l) != len(r) {
+			return false
+		}
+		for i := range l {
+			if condEqual(l[i], r[i]) == false {
+				return false
+			}
+		}
+		return true
+	}
+	if _, ok := right.([]interface{}); ok {
+		return false
+	}
+	// attrs 中可能包含 map 等无法使用 == 比较的值，直接比较会引起 panic
+	return reflect.DeepEqual(left, right)
+}
+
+// normalizeCondValue 将 attrs 中的值转换为表达式使用的类型：数字转换为 float64，切片及数组转换为 []interface{}
+func normalizeCondValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	var rv = reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice, reflect.Array:
+		var values = make([]interface{}, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			values = append(values, normalizeCondValue(rv.Index(i).Interface()))
+		}
+		return values
+	}
+	return value
+}
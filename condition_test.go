@@ -0,0 +1,170 @@
+package odin
+
+import (
+	"testing"
+)
+
+func TestParseConditionError(t *testing.T) {
+	var tests = []struct {
+		text string
+		pos  int
+	}{
+		{"", 0},
+		{"amount <", 8},
+		{"(amount < 1", 11},
+		{"dept in ['sales'", 16},
+		{"name == 'abc", 8},
+		{"amount # 1", 7},
+		{"amount == 1 currency", 12},
+		{"in [1]", 0},
+		{"amount < 1.2.3", 9},
+		{"amount < )", 9},
+	}
+
+	for _, test := range tests {
+		_, err := ParseCondition(test.text)
+		if err == nil {
+			t.Errorf("ParseCondition(%q) 应该返回错误", test.text)
+			continue
+		}
+		cErr, ok := err.(*ConditionError)
+		if ok == false {
+			t.Errorf("ParseCondition(%q) 返回的错误类型为 %T，期望为 *ConditionError", test.text, err)
+			continue
+		}
+		if cErr.Expr != test.text || cErr.Pos != test.pos {
+			t.Errorf("ParseCondition(%q) 返回的错误位置为 %d，期望为 %d", test.text, cErr.Pos, test.pos)
+		}
+	}
+}
+
+func TestConditionEval(t *testing.T) {
+	var attrs = map[string]interface{}{
+		"amount":   500,
+		"currency": "CNY",
+		"hour":     int64(10),
+		"ratio":    float32(0.5),
+		"dept":     "sales",
+		"tags":     []string{"a", "b"},
+		"active":   true,
+		"order": map[string]interface{}{
+			"owner": "alice",
+			"items": []int{1, 2},
+		},
+	}
+
+	var tests = []struct {
+		text   string
+		expect bool
+	}{
+		// 比较运算
+		{"amount < 1000 && currency == 'CNY'", true},
+		{"amount >= 500 && amount <= 500", true},
+		{"amount > 500", false},
+		{"amount != 500", false},
+		{"hour >= 9 && hour < 18", true},
+		{"ratio == 0.5", true},
+		{"currency < 'USD'", true},
+		{"active == true", true},
+		{"order.owner == \"alice\"", true},
+		{"order.owner != 'bob'", true},
+
+		// 优先级
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"!false && false", false},
+		{"!(false && false)", true},
+		{"!!active", true},
+		{"false || false || true", true},
+
+		// 短路求值，右侧的类型错误不会被计算
+		{"false && amount < 'x'", false},
+		{"true || amount < 'x'", true},
+
+		// in
+		{"dept in ['sales', 'support']", true},
+		{"dept in ['support']", false},
+		{"amount in [100, 500]", true},
+		{"missing in [1, 2]", false},
+		{"missing in [null]", true},
+		{"tags in [['a', 'b'], ['c']]", true},
+		{"order.items == [1, 2]", true},
+		{"tags == ['a']", false},
+		{"tags == 'a'", false},
+
+		// null 及不存在的属性
+		{"missing == null", true},
+		{"missing != null", false},
+		{"order.missing == null", true},
+		{"currency.code == null", true},
+		{"missing < 1", false},
+		{"null >= 1", false},
+
+		// 无法使用 == 直接比较的值
+		{"order == order", true},
+		{"order == 1", false},
+		{"order != dept", true},
+	}
+
+	for _, test := range tests {
+		cond, err := ParseCondition(test.text)
+		if err != nil {
+			t.Errorf("ParseCondition(%q) 返回错误: %v", test.text, err)
+			continue
+		}
+		result, err := cond.Eval(attrs)
+		if err != nil {
+			t.Errorf("Eval(%q) 返回错误: %v", test.text, err)
+			continue
+		}
+		if result != test.expect {
+			t.Errorf("Eval(%q) 的结果为 %v，期望为 %v", test.text, result, test.expect)
+		}
+	}
+}
+
+func TestConditionEvalError(t *testing.T) {
+	var attrs = map[string]interface{}{
+		"amount": 500,
+		"dept":   "sales",
+		"active": true,
+		"order":  map[string]interface{}{"owner": "alice"},
+	}
+
+	var tests = []struct {
+		text string
+		pos  int
+	}{
+		{"amount < 'x'", 7},
+		{"dept >= 1", 5},
+		{"active < true", 7},
+		{"order > order", 6},
+		{"dept in 'sales'", 5},
+		{"amount", -1},
+		{"amount && true", -1},
+		{"true && dept", -1},
+		{"!amount", -1},
+		{"true && amount < 'x'", 15},
+	}
+
+	for _, test := range tests {
+		cond, err := ParseCondition(test.text)
+		if err != nil {
+			t.Errorf("ParseCondition(%q) 返回错误: %v", test.text, err)
+			continue
+		}
+		_, err = cond.Eval(attrs)
+		if err == nil {
+			t.Errorf("Eval(%q) 应该返回错误", test.text)
+			continue
+		}
+		cErr, ok := err.(*ConditionError)
+		if ok == false {
+			t.Errorf("Eval(%q) 返回的错误类型为 %T，期望为 *ConditionError", test.text, err)
+			continue
+		}
+		if cErr.Expr != test.text || cErr.Pos != test.pos {
+			t.Errorf("Eval(%q) 返回的错误为 %q 位置 %d，期望为 %q 位置 %d", test.text, cErr.Expr, cErr.Pos, test.text, test.pos)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package odin
+
+// findPrePath 在先决条件组成的有向图中查找从 start 出发，经过 froms 中的任一节点，最终回到 start 的路径
+//
+// 参数 next 用于获取节点列表指向的节点，即节点列表的先决条件，如果不存在这样的路径，则返回 nil
+func findPrePath(start int64, froms []int64, next func(ids []int64) (edges [][2]int64, err error)) (path []int64, err error) {
+	var prev = make(map[int64]int64)
+	var frontier = make([]int64, 0, len(froms))
+	for _, id := range froms {
+		if _, ok := prev[id]; ok {
+			continue
+		}
+		prev[id] = start
+		if id == start {
+			return []int64{start, start}, nil
+		}
+		frontier = append(frontier, id)
+	}
+
+	for len(frontier) > 0 {
+		edges, err := next(frontier)
+		if err != nil {
+			return nil, err
+		}
+		frontier = nil
+		for _, edge := range edges {
+			if _, ok := prev[edge[1]]; ok {
+				continue
+			}
+			prev[edge[1]] = edge[0]
+			if edge[1] == start {
+				// 根据 prev 回溯路径
+				path = append(path, start)
+				for cur := prev[start]; cur != start; cur = prev[cur] {
+					path = append(path, cur)
+				}
+				path = append(path, start)
+				for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+				return path, nil
+			}
+			frontier = append(frontier, edge[1])
+		}
+	}
+	return nil, nil
+}
+
+// checkPreRoleCycle 验证为角色 role 添加先决角色 preRoleList 之后，角色先决条件是否会形成循环依赖
+func (this *Service) checkPreRoleCycle(ctx int64, nRepo Repository, role *Role, preRoleList []*Role) (err error) {
+	var names = map[int64]string{role.Id: role.Name}
+	var preIds = make([]int64, 0, len(preRoleList))
+	for _, pre := range preRoleList {
+		names[pre.Id] = pre.Name
+		preIds = append(preIds, pre.Id)
+	}
+
+	path, err := findPrePath(role.Id, preIds, func(ids []int64) (edges [][2]int64, err error) {
+		preRoleList, err := nRepo.GetPreRolesWithIds(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, pre := range preRoleList {
+			names[pre.RoleId] = pre.RoleName
+			names[pre.PreRoleId] = pre.PreRoleName
+			edges = append(edges, [2]int64{pre.RoleId, pre.PreRoleId})
+		}
+		return edges, nil
+	})
+	if err != nil {
+		return err
+	}
+	if path != nil {
+		var cErr = &PreRoleCycleError{}
+		for _, id := range path {
+			cErr.Path = append(cErr.Path, names[id])
+		}
+		return cErr
+	}
+	return nil
+}
+
+// checkPrePermissionCycle 验证为权限 permission 添加先决权限 prePermissionList 之后，权限先决条件是否会形成循环依赖
+func (this *Service) checkPrePermissionCycle(ctx int64, nRepo Repository, permission *Permission, prePermissionList []*Permission) (err error) {
+	var names = map[int64]string{permission.Id: permission.Name}
+	var preIds = make([]int64, 0, len(prePermissionList))
+	for _, pre := range prePermissionList {
+		names[pre.Id] = pre.Name
+		preIds = append(preIds, pre.Id)
+	}
+
+	path, err := findPrePath(permission.Id, preIds, func(ids []int64) (edges [][2]int64, err error) {
+		prePermissionList, err := nRepo.GetPrePermissionsWithIds(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, pre := range prePermissionList {
+			names[pre.PermissionId] = pre.PermissionName
+			names[pre.PrePermissionId] = pre.PrePermissionName
+			edges = append(edges, [2]int64{pre.PermissionId, pre.PrePermissionId})
+		}
+		return edges, nil
+	})
+	if err != nil {
+		return err
+	}
+	if path != nil {
+		var cErr = &PrePermissionCycleError{}
+		for _, id := range path {
+			cErr.Path = append(cErr.Path, names[id])
+		}
+		return cErr
+	}
+	return nil
+}
+
+// checkRoleConflict 验证角色先决条件与角色互斥关系之间是否存在冲突，即授予某一角色时需要同时拥有两个互斥的角色
+//
+// 角色互斥关系会作用到互斥角色的子角色上，即角色 A 与角色 B 互斥时，角色 A 的子角色与角色 B（及其子角色）同样会被视为冲突
+//
+// 参数 seeds 为先决条件或者互斥关系发生变化的角色，参数 preEdges 为即将添加的先决条件（[角色, 先决角色]），参数 mutexEdges 为即将添加的互斥关系
+func (this *Service) checkRoleConflict(ctx int64, nRepo Repository, seeds []int64, preEdges, mutexEdges [][2]int64) (err error) {
+	// 查询出直接或者间接将 seeds 作为先决条件的角色，这些角色的先决条件会受到影响
+	var affected = make(map[int64]struct{})
+	var frontier = make([]int64, 0, len(seeds))
+	for _, id := range seeds {
+		if _, ok := affected[id]; ok == false {
+			affected[id] = struct{}{}
+			frontier = append(frontier, id)
+		}
+	}
+	for len(frontier) > 0 {
+		var current = make(map[int64]struct{}, len(frontier))
+		for _, id := range frontier {
+			current[id] = struct{}{}
+		}
+		preRoleList, err := nRepo.GetPreRolesWithPreIds(ctx, frontier)
+		if err != nil {
+			return err
+		}
+		var edges = make([][2]int64, 0, len(preRoleList)+len(preEdges))
+		for _, pre := range preRoleList {
+			edges = append(edges, [2]int64{pre.RoleId, pre.PreRoleId})
+		}
+		for _, edge := range preEdges {
+			if _, ok := current[edge[1]]; ok {
+				edges = append(edges, edge)
+			}
+		}
+		frontier = nil
+		for _, edge := range edges {
+			if _, ok := affected[edge[0]]; ok == false {
+				affected[edge[0]] = struct{}{}
+				frontier = append(frontier, edge[0])
+			}
+		}
+	}
+
+	// 查询出受影响角色的所有先决条件
+	var adjacency = make(map[int64][]int64)
+	var nodes = make(map[int64]struct{})
+	frontier = frontier[:0]
+	for id := range affected {
+		nodes[id] = struct{}{}
+		frontier = append(frontier, id)
+	}
+	for len(frontier) > 0 {
+		var current = make(map[int64]struct{}, len(frontier))
+		for _, id := range frontier {
+			current[id] = struct{}{}
+		}
+		preRoleList, err := nRepo.GetPreRolesWithIds(ctx, frontier)
+		if err != nil {
+			return err
+		}
+		var edges = make([][2]int64, 0, len(preRoleList)+len(preEdges))
+		for _, pre := range preRoleList {
+			edges = append(edges, [2]int64{pre.RoleId, pre.PreRoleId})
+		}
+		for _, edge := range preEdges {
+			if _, ok := current[edge[0]]; ok {
+				edges = append(edges, edge)
+			}
+		}
+		frontier = nil
+		for _, edge := range edges {
+			adjacency[edge[0]] = append(adjacency[edge[0]], edge[1])
+			if _, ok := nodes[edge[1]]; ok == false {
+				nodes[edge[1]] = struct{}{}
+				frontier = append(frontier, edge[1])
+			}
+		}
+	}
+
+	// 查询出所有相关角色及其父角色的信息
+	var roleMap = make(map[int64]*Role)
+	var loadIds = make([]int64, 0, len(nodes))
+	for id := range nodes {
+		loadIds = append(loadIds, id)
+	}
+	for _, edge := range mutexEdges {
+		loadIds = append(loadIds, edge[0], edge[1])
+	}
+	for len(loadIds) > 0 {
+		roleList, err := nRepo.GetRolesWithIds(ctx, loadIds...)
+		if err != nil {
+			return err
+		}
+		loadIds = nil
+		for _, role := range roleList {
+			roleMap[role.Id] = role
+		}
+		for _, role := range roleList {
+			if _, ok := roleMap[role.ParentId]; role.ParentId > 0 && ok == false {
+				loadIds = append(loadIds, role.ParentId)
+			}
+		}
+	}
+
+	var roleIds = make([]int64, 0, len(roleMap))
+	for id := range roleMap {
+		roleIds = append(roleIds, id)
+	}
+	mutexRoleList, err := nRepo.GetMutexRolesWithIds(ctx, roleIds)
+	if err != nil {
+		return err
+	}
+	var mutexPairs = make([][2]int64, 0, len(mutexRoleList)+len(mutexEdges))
+	for _, mutex := range mutexRoleList {
+		mutexPairs = append(mutexPairs, [2]int64{mutex.RoleId, mutex.MutexRoleId})
+	}
+	mutexPairs = append(mutexPairs, mutexEdges...)
+	if len(mutexPairs) == 0 {
+		return nil
+	}
+
+	var roleName = func(id int64) string {
+		if role := roleMap[id]; role != nil {
+			return role.Name
+		}
+		return ""
+	}
+
+	// 依次验证每一个受影响的角色
+	for id := range affected {
+		// 计算授予该角色时需要拥有的所有角色，prev 用于回溯路径
+		var prev = map[int64]int64{id: id}
+		var queue = []int64{id}
+		for i := 0; i < len(queue); i++ {
+			for _, preId := range adjacency[queue[i]] {
+				if _, ok := prev[preId]; ok == false {
+					prev[preId] = queue[i]
+					queue = append(queue, preId)
+				}
+			}
+		}
+
+		// cover 记录角色（及其父角色）对应的需要拥有的角色
+		var cover = make(map[int64][]int64)
+		for _, rId := range queue {
+			for cur, depth := roleMap[rId], 0; cur != nil && depth < len(roleMap); cur, depth = roleMap[cur.ParentId], depth+1 {
+				cover[cur.Id] = append(cover[cur.Id], rId)
+			}
+		}
+
+		for _, pair := range mutexPairs {
+			for _, x := range cover[pair[0]] {
+				for _, y := range cover[pair[1]] {
+					if x == y {
+						continue
+					}
+					var path = func(target int64) (result []string) {
+						for cur := target; cur != id; cur = prev[cur] {
+							result = append(result, roleName(cur))
+						}
+						result = append(result, roleName(id))
+						for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+							result[i], result[j] = result[j], result[i]
+						}
+						return result
+					}
+					return &PreRoleMutexError{Path: path(x), MutexPath: path(y), Role: roleName(pair[0]), MutexRole: roleName(pair[1])}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkRoleMutexConflict 验证为角色 role 添加互斥角色 mutexIds 之后，是否会与角色先决条件冲突
+func (this *Service) checkRoleMutexConflict(ctx int64, nRepo Repository, role *Role, mutexIds []int64) (err error) {
+	var mutexEdges = make([][2]int64, 0, len(mutexIds))
+	for _, mutexId := range mutexIds {
+		mutexEdges = append(mutexEdges, [2]int64{role.Id, mutexId})
+	}
+
+	// 互斥关系会作用到子角色上，所以子角色也会受到影响
+	var seeds = make([]int64, 0, len(mutexIds)+1)
+	for _, rId := range append([]int64{role.Id}, mutexIds...) {
+		seeds = append(seeds, rId)
+		children, err := nRepo.GetRoles(ctx, rId, 0, "", "")
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			seeds = append(seeds, child.Id)
+		}
+	}
+	return this.checkRoleConflict(ctx, nRepo, seeds, nil, mutexEdges)
+}
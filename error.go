@@ -1,22 +1,280 @@
 package odin
 
-import "errors"
+import (
+	"fmt"
+	"strings"
+)
 
 var (
-	ErrRoleNameExists        = errors.New("角色名已存在")
-	ErrParentRoleNotExist    = errors.New("父角色不存在")
-	ErrRoleNotExist          = errors.New("角色不存在")
-	ErrTargetNotAllowed      = errors.New("不合法的 Target Id")
-	ErrGrantFailed           = errors.New("授权失败")
-	ErrPermissionNotExist    = errors.New("权限不存在")
-	ErrPermissionNameExists  = errors.New("权限名已存在")
-	ErrGroupNotExist         = errors.New("组不存在")
-	ErrGroupNameExists       = errors.New("组名已存在")
-	ErrRevokeFailed          = errors.New("取消授权失败")
-	ErrInvalidParentRole     = errors.New("无效的父角色")
-	ErrPermissionOutOfParent = errors.New("授予权限超出父角色范围")
-	ErrMutexRoleNotExist     = errors.New("互斥角色不存在")
-	ErrPreRoleNotExist       = errors.New("前置角色不存在")
-	ErrPrePermissionNotExist = errors.New("前置权限不存在")
-	ErrNotImplemented        = errors.New("未实现")
+	ErrRoleNameExists        = newError("role_name_exists")
+	ErrParentRoleNotExist    = newError("parent_role_not_exist")
+	ErrSiblingRoleNotExist   = newError("sibling_role_not_exist")
+	ErrRoleNotExist          = newError("role_not_exist")
+	ErrTargetNotAllowed      = newError("target_not_allowed")
+	ErrResourceNotAllowed    = newError("resource_not_allowed")
+	ErrGrantFailed           = newError("grant_failed")
+	ErrPermissionNotExist    = newError("permission_not_exist")
+	ErrPermissionNameExists  = newError("permission_name_exists")
+	ErrGroupNotExist         = newError("group_not_exist")
+	ErrGroupNameExists       = newError("group_name_exists")
+	ErrRevokeFailed          = newError("revoke_failed")
+	ErrInvalidParentRole     = newError("invalid_parent_role")
+	ErrInvalidSiblingRole    = newError("invalid_sibling_role")
+	ErrPermissionOutOfParent = newError("permission_out_of_parent")
+	ErrMutexRoleNotExist     = newError("mutex_role_not_exist")
+	ErrPreRoleNotExist       = newError("pre_role_not_exist")
+	ErrPrePermissionNotExist = newError("pre_permission_not_exist")
+	ErrPermissionIsRequired  = newError("permission_is_required")
+	ErrPermissionNotGranted  = newError("permission_not_granted")
+	ErrInvalidGrantPeriod    = newError("invalid_grant_period")
+	ErrRoleNotDelegable      = newError("role_not_delegable")
+	ErrRoleAlreadyGranted    = newError("role_already_granted")
+	ErrDelegationNotExist    = newError("delegation_not_exist")
+	ErrRoleNotGranted        = newError("role_not_granted")
+	ErrInvalidSession        = newError("invalid_session")
+	ErrInvalidLimit          = newError("invalid_limit")
+	ErrNotImplemented        = newError("not_implemented")
 )
+
+// Error 预定义的错误，Code 为错误码，错误信息从消息目录中获取，参考 Message 及 SetLanguage
+type Error struct {
+	Code string
+}
+
+func newError(code string) *Error {
+	return &Error{Code: code}
+}
+
+func (this *Error) Error() string {
+	return this.message(currentLanguage())
+}
+
+func (this *Error) message(lang Language) string {
+	return lookupMessage(lang, this.Code)
+}
+
+// RoleMutexError 角色互斥（RoleName 及 MutexRoleName 为角色的显示名称），授予角色或者在会话中激活角色时 Role 与 MutexRole 不能同时拥有，Dynamic 为 true 时表示动态互斥
+type RoleMutexError struct {
+	RoleId        int64
+	RoleName      string
+	MutexRoleId   int64
+	MutexRoleName string
+	Dynamic       bool
+}
+
+func newRoleMutexError(mutex *RoleMutex, dynamic bool) *RoleMutexError {
+	return &RoleMutexError{
+		RoleId:        mutex.RoleId,
+		RoleName:      mutex.RoleAliasName,
+		MutexRoleId:   mutex.MutexRoleId,
+		MutexRoleName: mutex.MutexRoleAliasName,
+		Dynamic:       dynamic,
+	}
+}
+
+func (this *RoleMutexError) Error() string {
+	return this.message(currentLanguage())
+}
+
+func (this *RoleMutexError) message(lang Language) string {
+	if this.Dynamic {
+		return formatMessage(lang, "role_dynamic_mutex", this.RoleName, this.MutexRoleName)
+	}
+	return formatMessage(lang, "role_mutex", this.RoleName, this.MutexRoleName)
+}
+
+// PreRoleMissingError 授予角色 Role 时需要先授予先决角色 PreRole
+type PreRoleMissingError struct {
+	RoleId      int64
+	RoleName    string
+	PreRoleId   int64
+	PreRoleName string
+}
+
+func newPreRoleMissingError(pre *PreRole) *PreRoleMissingError {
+	return &PreRoleMissingError{RoleId: pre.RoleId, RoleName: pre.RoleAliasName, PreRoleId: pre.PreRoleId, PreRoleName: pre.PreRoleAliasName}
+}
+
+func (this *PreRoleMissingError) Error() string {
+	return this.message(currentLanguage())
+}
+
+func (this *PreRoleMissingError) message(lang Language) string {
+	return formatMessage(lang, "pre_role_missing", this.RoleName, this.PreRoleName)
+}
+
+// PreRoleRequiredError 角色 Role 依赖于先决角色 PreRole，取消 PreRole 之前需要先取消 Role
+type PreRoleRequiredError struct {
+	RoleId      int64
+	RoleName    string
+	PreRoleId   int64
+	PreRoleName string
+}
+
+func newPreRoleRequiredError(pre *PreRole) *PreRoleRequiredError {
+	return &PreRoleRequiredError{RoleId: pre.RoleId, RoleName: pre.RoleAliasName, PreRoleId: pre.PreRoleId, PreRoleName: pre.PreRoleAliasName}
+}
+
+func (this *PreRoleRequiredError) Error() string {
+	return this.message(currentLanguage())
+}
+
+func (this *PreRoleRequiredError) message(lang Language) string {
+	return formatMessage(lang, "pre_role_required", this.RoleName, this.PreRoleName)
+}
+
+// PrePermissionMissingError 授予权限 Permission 时需要先授予先决权限 PrePermission
+type PrePermissionMissingError struct {
+	PermissionId      int64
+	PermissionName    string
+	PrePermissionId   int64
+	PrePermissionName string
+}
+
+func newPrePermissionMissingError(pre *PrePermission) *PrePermissionMissingError {
+	return &PrePermissionMissingError{PermissionId: pre.PermissionId, PermissionName: pre.PermissionAliasName, PrePermissionId: pre.PrePermissionId, PrePermissionName: pre.PrePermissionAliasName}
+}
+
+func (this *PrePermissionMissingError) Error() string {
+	return this.message(currentLanguage())
+}
+
+func (this *PrePermissionMissingError) message(lang Language) string {
+	return formatMessage(lang, "pre_permission_missing", this.PermissionName, this.PrePermissionName)
+}
+
+// PrePermissionRequiredError 权限 Permission 依赖于先决权限 PrePermission，取消 PrePermission 之前需要先取消 Permission
+type PrePermissionRequiredError struct {
+	PermissionId      int64
+	PermissionName    string
+	PrePermissionId   int64
+	PrePermissionName string
+}
+
+func newPrePermissionRequiredError(pre *PrePermission) *PrePermissionRequiredError {
+	return &PrePermissionRequiredError{PermissionId: pre.PermissionId, PermissionName: pre.PermissionAliasName, PrePermissionId: pre.PrePermissionId, PrePermissionName: pre.PrePermissionAliasName}
+}
+
+func (this *PrePermissionRequiredError) Error() string {
+	return this.message(currentLanguage())
+}
+
+func (this *PrePermissionRequiredError) message(lang Language) string {
+	return formatMessage(lang, "pre_permission_required", this.PermissionName, this.PrePermissionName)
+}
+
+// PermissionOutOfParentError 角色 Role 的权限超出父角色 ParentRole 的权限范围，PermissionNames 为超出范围的权限的显示名称（AliasName）
+//
+// errors.Is(err, ErrPermissionOutOfParent) 的结果为 true
+type PermissionOutOfParentError struct {
+	RoleId          int64
+	RoleName        string
+	ParentRoleId    int64
+	ParentRoleName  string
+	PermissionNames []string
+}
+
+func newPermissionOutOfParentError(role, parent *Role, permissionNames []string) *PermissionOutOfParentError {
+	return &PermissionOutOfParentError{RoleId: role.Id, RoleName: role.AliasName, ParentRoleId: parent.Id, ParentRoleName: parent.AliasName, PermissionNames: permissionNames}
+}
+
+func (this *PermissionOutOfParentError) Error() string {
+	return this.message(currentLanguage())
+}
+
+func (this *PermissionOutOfParentError) message(lang Language) string {
+	return formatMessage(lang, "permission_out_of_parent_detail", this.RoleName, strings.Join(this.PermissionNames, ", "), this.ParentRoleName)
+}
+
+func (this *PermissionOutOfParentError) Is(target error) bool {
+	return target == ErrPermissionOutOfParent
+}
+
+// PreRoleCycleError 角色先决条件存在循环依赖，Path 为构成循环依赖的角色名称列表，首尾为同一角色
+type PreRoleCycleError struct {
+	Path []string
+}
+
+func (this *PreRoleCycleError) Error() string {
+	return this.message(currentLanguage())
+}
+
+func (this *PreRoleCycleError) message(lang Language) string {
+	return formatMessage(lang, "pre_role_cycle", strings.Join(this.Path, " -> "))
+}
+
+// PrePermissionCycleError 权限先决条件存在循环依赖，Path 为构成循环依赖的权限名称列表，首尾为同一权限
+type PrePermissionCycleError struct {
+	Path []string
+}
+
+func (this *PrePermissionCycleError) Error() string {
+	return this.message(currentLanguage())
+}
+
+func (this *PrePermissionCycleError) message(lang Language) string {
+	return formatMessage(lang, "pre_permission_cycle", strings.Join(this.Path, " -> "))
+}
+
+// PreRoleMutexError 角色先决条件与角色互斥关系冲突
+//
+// 授予角色 Path[0] 时需要同时拥有 Path 及 MutexPath 中的最后一个角色，而这两个角色（或者它们所属的父角色）分别为 Role 及 MutexRole，Role 与 MutexRole 互斥
+type PreRoleMutexError struct {
+	Path      []string
+	MutexPath []string
+	Role      string
+	MutexRole string
+}
+
+func (this *PreRoleMutexError) Error() string {
+	return this.message(currentLanguage())
+}
+
+func (this *PreRoleMutexError) message(lang Language) string {
+	return formatMessage(lang, "pre_role_mutex", strings.Join(this.Path, " -> "), strings.Join(this.MutexPath, " -> "), this.Role, this.MutexRole)
+}
+
+// CardinalityError 授权超出数量限制，Count 为授权前已有的数量
+//
+// Role 不为空时表示角色 Role 最多只能授予给 Limit 个 target，否则表示 target 最多只能拥有 Limit 个角色
+type CardinalityError struct {
+	Role   string
+	Target string
+	Limit  int
+	Count  int
+}
+
+func (this *CardinalityError) Error() string {
+	return this.message(currentLanguage())
+}
+
+func (this *CardinalityError) message(lang Language) string {
+	if this.Role != "" {
+		return formatMessage(lang, "role_cardinality", this.Role, this.Limit, this.Count)
+	}
+	return formatMessage(lang, "target_cardinality", this.Target, this.Limit, this.Count)
+}
+
+// ConditionError 条件表达式不合法或者计算失败，Pos 为出错位置（从 0 开始的字节偏移），计算过程中无法确定位置时为 -1
+//
+// Msg 为具体的错误描述，不会根据语言进行转换
+type ConditionError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func newConditionError(expr string, pos int, format string, args ...interface{}) *ConditionError {
+	return &ConditionError{Expr: expr, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (this *ConditionError) Error() string {
+	return this.message(currentLanguage())
+}
+
+func (this *ConditionError) message(lang Language) string {
+	if this.Pos < 0 {
+		return formatMessage(lang, "condition", this.Expr, this.Msg)
+	}
+	return formatMessage(lang, "condition_at", this.Expr, this.Pos+1, this.Msg)
+}
@@ -1,6 +1,6 @@
 module github.com/smartwalle/odin
 
-go 1.12
+go 1.13
 
 require (
 	github.com/smartwalle/dbr v1.0.5
@@ -0,0 +1,67 @@
+package odin
+
+import (
+	"path"
+	"strings"
+)
+
+// PermissionMatcher 权限名称匹配器，用于支持带有层级及通配符的权限名称，如 order:read、order:refund、order:*。
+//
+// 权限名称使用 Separator 分隔为多个层级，每一层级按照 glob 规则（*、? 及 [...]）匹配，但是不会跨越层级；
+// 最后一个层级为 * 时可以匹配剩余的一个或者多个层级，如 order:* 可以匹配 order:refund 及 order:refund:partial，* 可以匹配所有的权限。
+type PermissionMatcher struct {
+	separator string
+}
+
+// NewPermissionMatcher 创建权限名称匹配器，参数 separator 为权限名称的层级分隔符，为空时使用 :
+func NewPermissionMatcher(separator string) *PermissionMatcher {
+	if separator == "" {
+		separator = ":"
+	}
+	return &PermissionMatcher{separator: separator}
+}
+
+// Separator 获取权限名称的层级分隔符
+func (this *PermissionMatcher) Separator() string {
+	return this.separator
+}
+
+// IsPattern 判断权限名称是否包含通配符
+func (this *PermissionMatcher) IsPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// Match 判断权限名称 name 是否与 pattern 匹配
+func (this *PermissionMatcher) Match(pattern, name string) bool {
+	if pattern == name {
+		return true
+	}
+	if this.IsPattern(pattern) == false {
+		return false
+	}
+
+	var pParts = strings.Split(pattern, this.separator)
+	var nParts = strings.Split(name, this.separator)
+	for i, pPart := range pParts {
+		if i >= len(nParts) {
+			return false
+		}
+		if pPart == "*" && i == len(pParts)-1 {
+			return true
+		}
+		if ok, err := path.Match(pPart, nParts[i]); err != nil || ok == false {
+			return false
+		}
+	}
+	return len(pParts) == len(nParts)
+}
+
+// MatchAny 判断权限名称 name 是否与 patterns 中的任一元素匹配
+func (this *PermissionMatcher) MatchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if this.Match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package odin
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Language 错误信息使用的语言
+type Language string
+
+const (
+	LanguageZH Language = "zh" // 中文
+	LanguageEN Language = "en" // 英文
+)
+
+var (
+	language = LanguageZH
+	mu       sync.RWMutex
+	catalog  = map[Language]map[string]string{
+		LanguageZH: {
+			"role_name_exists":                "角色名已存在",
+			"parent_role_not_exist":           "父角色不存在",
+			"sibling_role_not_exist":          "兄弟角色不存在",
+			"role_not_exist":                  "角色不存在",
+			"target_not_allowed":              "不合法的 Target Id",
+			"resource_not_allowed":            "不合法的资源",
+			"grant_failed":                    "授权失败",
+			"permission_not_exist":            "权限不存在",
+			"permission_name_exists":          "权限名已存在",
+			"group_not_exist":                 "组不存在",
+			"group_name_exists":               "组名已存在",
+			"revoke_failed":                   "取消授权失败",
+			"invalid_parent_role":             "无效的父角色",
+			"invalid_sibling_role":            "无效的兄弟角色",
+			"permission_out_of_parent":        "授予权限超出父角色范围",
+			"mutex_role_not_exist":            "互斥角色不存在",
+			"pre_role_not_exist":              "前置角色不存在",
+			"pre_permission_not_exist":        "前置权限不存在",
+			"permission_is_required":          "权限为其它权限的前置权限",
+			"permission_not_granted":          "角色未拥有该权限",
+			"invalid_grant_period":            "无效的授权有效期",
+			"role_not_delegable":              "无法委托该角色",
+			"role_already_granted":            "角色已经授予",
+			"delegation_not_exist":            "委托不存在",
+			"role_not_granted":                "未拥有该角色",
+			"invalid_session":                 "无效的会话",
+			"invalid_limit":                   "无效的数量限制",
+			"not_implemented":                 "未实现",
+			"role_mutex":                      "角色 %s 与角色 %s 互斥",
+			"role_dynamic_mutex":              "角色 %s 与角色 %s 动态互斥，不能同时激活",
+			"pre_role_missing":                "授予角色 %s 时需要先授予角色 %s",
+			"pre_role_required":               "角色 %s 依赖于角色 %s",
+			"pre_permission_missing":          "授予权限 %s 时需要先授予权限 %s",
+			"pre_permission_required":         "权限 %s 依赖于权限 %s",
+			"permission_out_of_parent_detail": "角色 %s 的权限 %s 超出父角色 %s 的权限范围",
+			"pre_role_cycle":                  "角色先决条件存在循环依赖: %s",
+			"pre_permission_cycle":            "权限先决条件存在循环依赖: %s",
+			"pre_role_mutex":                  "角色先决条件与互斥关系冲突: %s 与 %s 需要同时拥有，但角色 %s 与角色 %s 互斥",
+			"role_cardinality":                "角色 %s 最多只能授予给 %d 个对象，当前已授予给 %d 个对象",
+			"target_cardinality":              "%s 最多只能拥有 %d 个角色，当前已拥有 %d 个角色",
+			"condition":                       "条件表达式 %s 错误: %s",
+			"condition_at":                    "条件表达式 %s 第 %d 个字符处错误: %s",
+		},
+		LanguageEN: {
+			"role_name_exists":                "role name already exists",
+			"parent_role_not_exist":           "parent role does not exist",
+			"sibling_role_not_exist":          "sibling role does not exist",
+			"role_not_exist":                  "role does not exist",
+			"target_not_allowed":              "invalid target id",
+			"resource_not_allowed":            "invalid resource",
+			"grant_failed":                    "grant failed",
+			"permission_not_exist":            "permission does not exist",
+			"permission_name_exists":          "permission name already exists",
+			"group_not_exist":                 "group does not exist",
+			"group_name_exists":               "group name already exists",
+			"revoke_failed":                   "revoke failed",
+			"invalid_parent_role":             "invalid parent role",
+			"invalid_sibling_role":            "invalid sibling role",
+			"permission_out_of_parent":        "permission is out of the parent role's scope",
+			"mutex_role_not_exist":            "mutex role does not exist",
+			"pre_role_not_exist":              "prerequisite role does not exist",
+			"pre_permission_not_exist":        "prerequisite permission does not exist",
+			"permission_is_required":          "permission is a prerequisite of other permissions",
+			"permission_not_granted":          "permission is not granted to the role",
+			"invalid_grant_period":            "invalid grant period",
+			"role_not_delegable":              "role cannot be delegated",
+			"role_already_granted":            "role is already granted",
+			"delegation_not_exist":            "delegation does not exist",
+			"role_not_granted":                "role is not granted",
+			"invalid_session":                 "invalid session",
+			"invalid_limit":                   "invalid limit",
+			"not_implemented":                 "not implemented",
+			"role_mutex":                      "role %s is mutually exclusive with role %s",
+			"role_dynamic_mutex":              "role %s is dynamically exclusive with role %s and cannot be activated in the same session",
+			"pre_role_missing":                "role %s requires role %s to be granted first",
+			"pre_role_required":               "role %s depends on role %s",
+			"pre_permission_missing":          "permission %s requires permission %s to be granted first",
+			"pre_permission_required":         "permission %s depends on permission %s",
+			"permission_out_of_parent_detail": "permissions %[2]s of role %[1]s are out of the scope of parent role %[3]s",
+			"pre_role_cycle":                  "role prerequisites form a cycle: %s",
+			"pre_permission_cycle":            "permission prerequisites form a cycle: %s",
+			"pre_role_mutex":                  "role prerequisites conflict with mutex rules: %s and %s must be held together, but role %s is mutually exclusive with role %s",
+			"role_cardinality":                "role %s can be granted to at most %d targets, currently granted to %d",
+			"target_cardinality":              "%s can hold at most %d roles, currently holds %d",
+			"condition":                       "invalid condition %s: %s",
+			"condition_at":                    "invalid condition %s at character %d: %s",
+		},
+	}
+)
+
+// messenger 可以根据语言生成错误信息的错误
+type messenger interface {
+	message(lang Language) string
+}
+
+// SetLanguage 设置错误信息默认使用的语言，默认为 LanguageZH，影响所有 odin 错误的 Error() 方法
+func SetLanguage(lang Language) {
+	mu.Lock()
+	language = lang
+	mu.Unlock()
+}
+
+func currentLanguage() Language {
+	mu.RLock()
+	defer mu.RUnlock()
+	return language
+}
+
+// RegisterMessages 注册或者覆盖指定语言的错误信息，key 为错误码（参考 Error 的 Code），value 为错误信息（可以包含 fmt 格式化占位符）
+func RegisterMessages(lang Language, messages map[string]string) {
+	mu.Lock()
+	defer mu.Unlock()
+	var m = catalog[lang]
+	if m == nil {
+		m = make(map[string]string, len(messages))
+		catalog[lang] = m
+	}
+	for code, text := range messages {
+		m[code] = text
+	}
+}
+
+// Message 使用指定语言生成错误信息，err 被包装时使用错误链中第一个 odin 定义的错误，错误链中没有 odin 定义的错误时返回 err.Error()
+func Message(err error, lang Language) string {
+	if err == nil {
+		return ""
+	}
+	var m messenger
+	if errors.As(err, &m) {
+		return m.message(lang)
+	}
+	return err.Error()
+}
+
+// lookupMessage 获取错误码在指定语言下对应的错误信息，未找到时依次尝试使用 LanguageZH 及错误码本身
+func lookupMessage(lang Language, code string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if text, ok := catalog[lang][code]; ok {
+		return text
+	}
+	if text, ok := catalog[LanguageZH][code]; ok {
+		return text
+	}
+	return code
+}
+
+func formatMessage(lang Language, code string, args ...interface{}) string {
+	return fmt.Sprintf(lookupMessage(lang, code), args...)
+}
@@ -1,6 +1,10 @@
 package odin
 
-import "time"
+import (
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Status 状态信息。
 type Status int
@@ -10,14 +14,52 @@ const (
 	Disable Status = 2 // 禁用
 )
 
-// GroupType 组的类型，目前分为权限组和角色组，组没有实质的意义，主要是对权限数据或者角色数据进行分类， 目前只实现了权限组的管理。
+// InheritMode 权限继承模式，用于描述角色在角色树中如何继承其它角色的权限。
+type InheritMode int
+
+const (
+	InheritNone        InheritMode = 0 // 不继承，角色只拥有直接授予给它的权限
+	InheritDescendants InheritMode = 1 // 角色拥有其所有子孙角色的权限
+	InheritAncestors   InheritMode = 2 // 角色拥有其所有祖先角色的权限
+)
+
+// FailurePolicy 验证类方法（如 CheckPermission）在访问数据库或者缓存出错时的处理策略，需要获取具体错误信息时使用对应的 E 方法，如 CheckPermissionE
+type FailurePolicy int
+
+const (
+	FailClosed FailurePolicy = 0 // 出错时拒绝，即认为没有权限、没有角色或者角色互斥
+	FailOpen   FailurePolicy = 1 // 出错时放行，即认为拥有权限、拥有角色或者角色不互斥
+)
+
+// GroupType 组的类型，目前分为权限组和角色组，组没有实质的意义，主要是对权限数据或者角色数据进行分类。
 type GroupType int
 
 const (
 	GroupPermission GroupType = 1 // 权限组
 	GroupRole       GroupType = 2 // 角色组
+	GroupTarget     GroupType = 3 // 授权对象组，授予给组的角色对组内所有成员（target）有效
 )
 
+// TargetGroupPrefix 授权对象组作为 target 时使用的前缀，普通的 target 不能使用该前缀
+const TargetGroupPrefix = "@group:"
+
+// TargetOfGroup 获取授权对象组作为 target 时的标识，授予给组的角色以该标识作为 target 存储
+func TargetOfGroup(groupId int64) string {
+	return TargetGroupPrefix + strconv.FormatInt(groupId, 10)
+}
+
+// ParseTargetOfGroup 解析授权对象组作为 target 时的标识，target 不是授权对象组的标识时 ok 为 false
+func ParseTargetOfGroup(target string) (groupId int64, ok bool) {
+	if strings.HasPrefix(target, TargetGroupPrefix) == false {
+		return 0, false
+	}
+	groupId, err := strconv.ParseInt(strings.TrimPrefix(target, TargetGroupPrefix), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return groupId, true
+}
+
 // Group 组数据结构，用于描述组信息。
 type Group struct {
 	Id             int64         `json:"id,string"                       sql:"id"`
@@ -29,6 +71,7 @@ type Group struct {
 	CreatedOn      *time.Time    `json:"created_on"                      sql:"created_on"`
 	UpdatedOn      *time.Time    `json:"updated_on"                      sql:"updated_on"`
 	PermissionList []*Permission `json:"permission_list,omitempty"       sql:"-"`
+	RoleList       []*Role       `json:"role_list,omitempty"             sql:"-"`
 }
 
 // Permission 权限数据结构，用于描述权限信息。
@@ -41,6 +84,7 @@ type Permission struct {
 	Status            Status           `json:"status"                           sql:"status"`
 	Description       string           `json:"description"                      sql:"description"`
 	Granted           bool             `json:"granted"                          sql:"granted"` // 权限是否授予给指定角色
+	Cond              string           `json:"cond,omitempty"                   sql:"cond"`    // 权限授予给指定角色时的附加条件，参考 Condition
 	CreatedOn         *time.Time       `json:"created_on"                       sql:"created_on"`
 	UpdatedOn         *time.Time       `json:"updated_on"                       sql:"updated_on"`
 	PrePermissionList []*PrePermission `json:"pre_permission_list,omitempty"    sql:"-"`
@@ -49,6 +93,7 @@ type Permission struct {
 // Role 角色数据结构，用于描述角色信息。
 type Role struct {
 	Id             int64         `json:"id,string"                       sql:"id"`
+	GroupId        int64         `json:"group_id,string"                 sql:"group_id"`
 	Ctx            int64         `json:"ctx,string"                      sql:"ctx"`
 	Name           string        `json:"name"                            sql:"name"`
 	AliasName      string        `json:"alias_name"                      sql:"alias_name"`
@@ -60,6 +105,7 @@ type Role struct {
 	LeftValue      int64         `json:"left_value,string"               sql:"left_value"`
 	RightValue     int64         `json:"right_value,string"              sql:"right_value"`
 	Depth          int           `json:"depth"                           sql:"depth"`
+	MaxTargets     int           `json:"max_targets"                     sql:"max_targets"` // 角色最多可以授予给多少个 target，为 0 表示不限制
 	CreatedOn      *time.Time    `json:"created_on"                      sql:"created_on"`
 	UpdatedOn      *time.Time    `json:"updated_on"                      sql:"updated_on"`
 	PermissionList []*Permission `json:"permission_list,omitempty"       sql:"-"`
@@ -72,6 +118,7 @@ type RolePermission struct {
 	Ctx          int64      `json:"ctx,string"             sql:"ctx"`
 	RoleId       int64      `json:"role_id,string"         sql:"role_id"`
 	PermissionId int64      `json:"permission_id,string"   sql:"permission_id"`
+	Cond         string     `json:"cond,omitempty"         sql:"cond"` // 附加条件，为空表示无条件，参考 Condition
 	CreatedOn    *time.Time `json:"created_on"             sql:"created_on"`
 }
 
@@ -89,6 +136,25 @@ type RoleMutex struct {
 	CreatedOn          *time.Time `json:"created_on"                sql:"created_on"`
 }
 
+// Session 会话数据结构，用于实现动态职责分离：target 可以同时拥有动态互斥的角色，但是不能在同一个会话中同时激活它们。
+//
+// 会话不会被持久化，由调用方负责保存，验证权限时只考虑会话中已激活并且仍然授予给 target 的角色，并且会重新验证已激活的角色之间的动态互斥关系。
+type Session struct {
+	Ctx       int64      `json:"ctx,string"`
+	Target    string     `json:"target"`
+	RoleList  []*Role    `json:"role_list"`
+	CreatedOn *time.Time `json:"created_on"`
+}
+
+// RoleIds 获取会话中已激活的角色 id 列表
+func (this *Session) RoleIds() []int64 {
+	var ids = make([]int64, 0, len(this.RoleList))
+	for _, role := range this.RoleList {
+		ids = append(ids, role.Id)
+	}
+	return ids
+}
+
 // PreRole 角色先决条件数据结构。
 // 主要应用于更新（授予）某一 target 的角色时，判断该 target 是否已经拥有某一角色。
 //
@@ -122,10 +188,100 @@ type PrePermission struct {
 
 // Grant 用于描述 target、角色、权限之间的关系。
 type Grant struct {
-	Ctx            int64  `json:"ctx,string"                sql:"ctx"`
-	Target         string `json:"target"                    sql:"target"`
-	RoleId         int64  `json:"role_id,string"            sql:"role_id"`
-	RoleName       string `json:"role_name"                 sql:"role_name"`
-	PermissionId   int64  `json:"permission_id,string"      sql:"permission_id"`
-	PermissionName string `json:"permission_name"           sql:"permission_name"`
+	Ctx            int64      `json:"ctx,string"                sql:"ctx"`
+	Target         string     `json:"target"                    sql:"target"`
+	RoleId         int64      `json:"role_id,string"            sql:"role_id"`
+	RoleName       string     `json:"role_name"                 sql:"role_name"`
+	PermissionId   int64      `json:"permission_id,string"      sql:"permission_id"`
+	PermissionName string     `json:"permission_name"           sql:"permission_name"`
+	NotBefore      *time.Time `json:"not_before,omitempty"      sql:"not_before"` // 授权生效时间，为空表示立即生效
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"      sql:"expires_at"` // 授权过期时间，为空表示永不过期
+}
+
+// GroupMember 授权对象组成员数据结构，用于描述 target 与授权对象组之间的关系。
+type GroupMember struct {
+	Ctx       int64      `json:"ctx,string"                sql:"ctx"`
+	GroupId   int64      `json:"group_id,string"           sql:"group_id"`
+	Target    string     `json:"target"                    sql:"target"`
+	CreatedOn *time.Time `json:"created_on"                sql:"created_on"`
+}
+
+// Delegation 角色委托数据结构，用于描述 target 将自己拥有的角色临时委托给其它 target。
+//
+// 委托会为 ToTarget 添加一条在 ExpiresAt 过期的角色授权，FromTarget 失去该角色时，委托会被自动取消。
+// 接受委托的 target 可以继续委托该角色，沿 ToTarget -> FromTarget 回溯即可得到完整的委托链。
+type Delegation struct {
+	Ctx        int64      `json:"ctx,string"                sql:"ctx"`
+	RoleId     int64      `json:"role_id,string"            sql:"role_id"`
+	RoleName   string     `json:"role_name"                 sql:"role_name"`
+	FromTarget string     `json:"from_target"               sql:"from_target"`
+	ToTarget   string     `json:"to_target"                 sql:"to_target"`
+	ExpiresAt  *time.Time `json:"expires_at"                sql:"expires_at"`
+	CreatedOn  *time.Time `json:"created_on"                sql:"created_on"`
+}
+
+// Deny 禁止权限数据结构，用于在不调整角色的情况下禁止 target 或者角色使用某一权限。
+//
+// Target 不为空时表示禁止该 target 使用该权限；RoleId 不为 0 时表示禁止拥有该角色的 target 使用该权限。
+// 禁止权限的优先级高于授权，即使 target 通过其它角色获得了该权限，验证权限时依然会返回 false。
+type Deny struct {
+	Ctx            int64      `json:"ctx,string"                sql:"ctx"`
+	Target         string     `json:"target"                    sql:"target"`
+	RoleId         int64      `json:"role_id,string"            sql:"role_id"`
+	RoleName       string     `json:"role_name"                 sql:"role_name"`
+	PermissionId   int64      `json:"permission_id,string"      sql:"permission_id"`
+	PermissionName string     `json:"permission_name"           sql:"permission_name"`
+	CreatedOn      *time.Time `json:"created_on"                sql:"created_on"`
+}
+
+// DecisionReason 权限验证结果的原因
+type DecisionReason string
+
+const (
+	ReasonGranted            DecisionReason = "granted"              // 通过已授予的角色拥有该权限
+	ReasonNotGranted         DecisionReason = "not_granted"          // 没有任何已授予的角色拥有该权限
+	ReasonPermissionNotExist DecisionReason = "permission_not_exist" // 权限不存在
+	ReasonPermissionDisabled DecisionReason = "permission_disabled"  // 权限已禁用
+	ReasonRoleDisabled       DecisionReason = "role_disabled"        // 拥有该权限的角色（或者授予给 target 的角色）已禁用
+	ReasonGroupDisabled      DecisionReason = "group_disabled"       // 角色授予给了 target 所属的授权对象组，但是该组已禁用
+	ReasonGrantInactive      DecisionReason = "grant_inactive"       // 角色授权尚未生效或者已经过期
+	ReasonConditional        DecisionReason = "conditional"          // 角色拥有该权限时带有附加条件，需要使用 CheckPermissionWithAttrs 进行验证
+	ReasonDenied             DecisionReason = "denied"               // 权限被禁止使用，参考 Deny
+)
+
+// Decision 权限验证结果的详细说明，用于解释 target 为什么拥有或者没有某一权限。
+//
+// Allowed 与 CheckPermission 的结果一致；SourceList 包含所有授予给 target（包括 target 所属的授权对象组）并且拥有该权限的角色，
+// 无论该授权是否有效，每一项的 Reason 说明该项是否有效及其原因；DenyList 包含对 target 生效的禁止信息。
+type Decision struct {
+	Ctx            int64             `json:"ctx,string"`
+	Target         string            `json:"target"`
+	PermissionId   int64             `json:"permission_id,string"`
+	PermissionName string            `json:"permission_name"`
+	Allowed        bool              `json:"allowed"`
+	Reason         DecisionReason    `json:"reason"`
+	SourceList     []*DecisionSource `json:"source_list,omitempty"`
+	DenyList       []*Deny           `json:"deny_list,omitempty"`
+}
+
+// DecisionSource 用于描述 target 通过哪个授权及角色获得（或者本应获得）某一权限。
+type DecisionSource struct {
+	Target            string         `json:"target"                         sql:"target"`              // 授权信息中的 target，为授权对象组的标识时表示通过授权对象组获得
+	GroupId           int64          `json:"group_id,string,omitempty"      sql:"group_id"`            // 授权对象组 id，不是通过授权对象组获得时为 0
+	GroupName         string         `json:"group_name,omitempty"           sql:"group_name"`          // 授权对象组名称
+	GroupStatus       Status         `json:"group_status,omitempty"         sql:"group_status"`        // 授权对象组状态
+	GrantedRoleId     int64          `json:"granted_role_id,string"         sql:"granted_role_id"`     // 授予给 target 的角色
+	GrantedRoleName   string         `json:"granted_role_name"              sql:"granted_role_name"`   // 授予给 target 的角色名称
+	GrantedRoleStatus Status         `json:"granted_role_status"            sql:"granted_role_status"` // 授予给 target 的角色状态
+	RoleId            int64          `json:"role_id,string"                 sql:"role_id"`             // 实际拥有该权限的角色，启用权限继承时可能与 GrantedRoleId 不同
+	RoleName          string         `json:"role_name"                      sql:"role_name"`           // 实际拥有该权限的角色名称
+	RoleStatus        Status         `json:"role_status"                    sql:"role_status"`         // 实际拥有该权限的角色状态
+	RolePath          []string       `json:"role_path"                      sql:"-"`                   // 从根角色到 RoleId 的角色名称列表
+	PermissionId      int64          `json:"permission_id,string"           sql:"permission_id"`       // 角色拥有的权限，启用权限名称匹配器时可能为与之匹配的通配权限
+	PermissionName    string         `json:"permission_name"                sql:"permission_name"`     // 角色拥有的权限名称
+	PermissionStatus  Status         `json:"permission_status"              sql:"permission_status"`   // 角色拥有的权限状态
+	Cond              string         `json:"cond,omitempty"                 sql:"cond"`                // 角色拥有该权限时的附加条件
+	NotBefore         *time.Time     `json:"not_before,omitempty"           sql:"not_before"`          // 授权生效时间
+	ExpiresAt         *time.Time     `json:"expires_at,omitempty"           sql:"expires_at"`          // 授权过期时间
+	Reason            DecisionReason `json:"reason"                         sql:"-"`                   // 该授权是否有效及其原因
 }
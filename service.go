@@ -1,8 +1,11 @@
 package odin
 
 import (
-	"fmt"
+	"context"
 	"github.com/smartwalle/dbs"
+	"sort"
+	"strings"
+	"time"
 )
 
 type Repository interface {
@@ -10,9 +13,33 @@ type Repository interface {
 
 	WithTx(tx dbs.TX) Repository
 
+	// WithContext 返回使用 ctx 执行所有数据库及缓存操作的 Repository，ctx 被取消或者超时之后，正在执行的操作会返回错误
+	WithContext(ctx context.Context) Repository
+
+	// Context 获取执行数据库及缓存操作时使用的 context.Context，未设置时为 context.Background()
+	Context() context.Context
+
 	// UseIdGenerator 设置 id 生成器，默认使用 dbs 库提供的 id 生成器
 	UseIdGenerator(g dbs.IdGenerator)
 
+	// UseInheritMode 设置权限继承模式，默认为 InheritNone
+	UseInheritMode(mode InheritMode)
+
+	// InheritMode 获取权限继承模式
+	InheritMode() InheritMode
+
+	// UseInheritConstraint 设置角色互斥关系及先决条件是否作用到子孙角色上，默认为 false
+	UseInheritConstraint(inherit bool)
+
+	// InheritConstraint 获取角色互斥关系及先决条件是否作用到子孙角色上
+	InheritConstraint() bool
+
+	// UsePermissionMatcher 设置权限名称匹配器，默认为 nil，即权限名称需要完全相同
+	UsePermissionMatcher(matcher *PermissionMatcher)
+
+	// PermissionMatcher 获取权限名称匹配器
+	PermissionMatcher() *PermissionMatcher
+
 	// InitTable 初始化数据库表
 	InitTable() error
 
@@ -34,6 +61,27 @@ type Repository interface {
 	// UpdateGroupStatus 更新组状态
 	UpdateGroupStatus(ctx int64, gType GroupType, groupId int64, status Status) (err error)
 
+	// UpdateGroupName 更新组名称
+	UpdateGroupName(ctx int64, gType GroupType, groupId int64, name string) (err error)
+
+	// DeleteGroup 删除组信息
+	DeleteGroup(ctx int64, gType GroupType, groupId int64) (err error)
+
+	// GetGroupMembers 获取授权对象组的成员列表
+	GetGroupMembers(ctx, groupId int64) (result []*GroupMember, err error)
+
+	// GetGroupsWithTarget 获取 target 所属的授权对象组列表
+	GetGroupsWithTarget(ctx int64, target string) (result []*Group, err error)
+
+	// AddGroupMembers 添加授权对象组成员
+	AddGroupMembers(ctx, groupId int64, targets []string) (err error)
+
+	// RemoveGroupMembers 移除授权对象组成员
+	RemoveGroupMembers(ctx, groupId int64, targets []string) (err error)
+
+	// CleanGroupMembers 移除授权对象组的所有成员
+	CleanGroupMembers(ctx, groupId int64) (err error)
+
 	// GetPermissions 获取角色列表
 	// 如果参数 limitedInRole 的值大于 0，则返回的权限数据将限定在已授权给 limitedInRole 的权限范围之内
 	// 如果参数 isGrantedToRole 的值大于 0，则返回的权限数据中将附带该权限是否已授权给该 isGrantedToRole
@@ -63,6 +111,12 @@ type Repository interface {
 	// UpdatePermissionStatus 更新权限状态
 	UpdatePermissionStatus(ctx, permissionId int64, status Status) (err error)
 
+	// UpdatePermissionName 更新权限名称
+	UpdatePermissionName(ctx, permissionId int64, name string) (err error)
+
+	// DeletePermissionWithIds 删除权限，同时清除与之相关的角色权限及先决条件
+	DeletePermissionWithIds(ctx int64, permissionIds []int64) (err error)
+
 	// GrantPermissionWithIds 授予权限给角色
 	GrantPermissionWithIds(ctx, roleId int64, permissionIds []int64) (err error)
 
@@ -72,11 +126,17 @@ type Repository interface {
 	// RevokeAllPermission 权限对角色的所有权限授权
 	RevokeAllPermission(ctx, roleId int64) (err error)
 
-	// GetGrantedPermissions 获取指定 target 拥有的权限信息
+	// GetGrantedPermissions 获取指定 target 拥有的权限信息，不包含带有附加条件的权限
 	GetGrantedPermissions(ctx int64, target string) (result []*Permission, err error)
 
-	// AddPrePermission 添加权限先决条件
-	AddPrePermission(ctx, permissionId int64, prePermissionIds []int64) (err error)
+	// UpdateRolePermissionCond 更新角色权限绑定的附加条件，参数 cond 为空表示无条件
+	UpdateRolePermissionCond(ctx, roleId, permissionId int64, cond string) (err error)
+
+	// GetConditionalPermissions 获取 target 拥有的带有附加条件的权限绑定，每一个绑定对应一条数据，Cond 字段为附加条件
+	GetConditionalPermissions(ctx int64, target string, permissionName string) (result []*Permission, err error)
+
+	// AddPrePermission 添加权限先决条件，如果参数 autoGrant 的值为 true，则授予权限时会自动授予缺失的先决权限
+	AddPrePermission(ctx, permissionId int64, prePermissionIds []int64, autoGrant bool) (err error)
 
 	// RemovePrePermission 移除权限先决条件
 	RemovePrePermission(ctx, permissionId int64, prePermissionIds []int64) (err error)
@@ -90,6 +150,9 @@ type Repository interface {
 	// GetPrePermissionsWithIds 获取指定权限列表的所有先决条件
 	GetPrePermissionsWithIds(ctx int64, permissionIds []int64) (result []*PrePermission, err error)
 
+	// GetPrePermissionsWithPreIds 获取将指定权限列表作为先决条件的权限信息
+	GetPrePermissionsWithPreIds(ctx int64, prePermissionIds []int64) (result []*PrePermission, err error)
+
 	// GetRoles 获取角色列表
 	// 如果参数 parentId 的值大于等于 0，则表示查询 parentId 的子角色列表
 	// 如果参数 isGrantedToTarget 的值不为空字符串，则返回的角色数据中将包含该角色（通过 Granted 判断）是否已授权给 isGrantedToTarget
@@ -115,12 +178,61 @@ type Repository interface {
 	// AddRole 添加角色
 	AddRole(ctx int64, parent *Role, name, aliasName, description string, status Status) (result int64, err error)
 
+	// AddRoleBefore 添加角色，新添加的角色将与 sibling 拥有相同的父角色，并且位于 sibling 之前
+	AddRoleBefore(ctx int64, sibling *Role, name, aliasName, description string, status Status) (result int64, err error)
+
+	// AddRoleAfter 添加角色，新添加的角色将与 sibling 拥有相同的父角色，并且位于 sibling 之后
+	AddRoleAfter(ctx int64, sibling *Role, name, aliasName, description string, status Status) (result int64, err error)
+
 	// UpdateRole 更新角色
 	UpdateRole(ctx, roleId int64, aliasName, description string, status Status) (err error)
 
 	// UpdateRoleStatus 更新角色状态
 	UpdateRoleStatus(ctx, roleId int64, status Status) (err error)
 
+	// UpdateRoleMaxTargets 更新角色最多可以授予给多少个 target，为 0 表示不限制
+	UpdateRoleMaxTargets(ctx, roleId int64, maxTargets int) (err error)
+
+	// LockRolesWithIds 获取角色信息并锁定角色记录直到事务结束
+	LockRolesWithIds(ctx int64, roleIds []int64) (result []*Role, err error)
+
+	// CountRoleTargets 统计角色当前授予给了多少个 target（不包括 excludeTarget），已经过期的授权不计算在内，统计时会锁定相关的授权记录直到事务结束
+	CountRoleTargets(ctx, roleId int64, excludeTarget string) (result int, err error)
+
+	// LockGrantsWithTarget 获取 target 的所有授权信息（包括授予给 target 所属的授权对象组的授权）并锁定授权记录直到事务结束
+	LockGrantsWithTarget(ctx int64, target string) (result []*Grant, err error)
+
+	// GetMaxRolesPerTarget 获取每个 target 最多可以拥有的角色数量，为 0 表示不限制
+	GetMaxRolesPerTarget(ctx int64) (result int, err error)
+
+	// LockMaxRolesPerTarget 获取每个 target 最多可以拥有的角色数量并锁定记录直到事务结束
+	LockMaxRolesPerTarget(ctx int64) (result int, err error)
+
+	// SetMaxRolesPerTarget 设置每个 target 最多可以拥有的角色数量，为 0 表示不限制
+	SetMaxRolesPerTarget(ctx int64, maxRoles int) (err error)
+
+	// UpdateRoleName 更新角色名称
+	UpdateRoleName(ctx, roleId int64, name string) (err error)
+
+	// UpdateRoleGroupWithIds 将角色列表添加到指定组，如果参数 groupId 的值为 0，则表示将角色从其所在的组中移除
+	UpdateRoleGroupWithIds(ctx, groupId int64, roleIds []int64) (err error)
+
+	// GetRolesWithGroupIds 获取指定组列表中的角色列表，返回的角色列表按照 left_value 排序
+	GetRolesWithGroupIds(ctx int64, status Status, groupIds []int64) (result []*Role, err error)
+
+	// MoveRole 将角色及其子角色移动到 parent 下，如果参数 parent 的值为 nil，则移动为顶级角色
+	MoveRole(ctx int64, role, parent *Role) (err error)
+
+	// MoveRoleBefore 将角色及其子角色移动到 sibling 之前，移动之后将与 sibling 拥有相同的父角色
+	MoveRoleBefore(ctx int64, role, sibling *Role) (err error)
+
+	// MoveRoleAfter 将角色及其子角色移动到 sibling 之后，移动之后将与 sibling 拥有相同的父角色
+	MoveRoleAfter(ctx int64, role, sibling *Role) (err error)
+
+	// DeleteRole 删除角色，同时清除与之相关的授权、权限、互斥关系及先决条件
+	// 如果参数 withChildren 的值为 true，则会同时删除该角色的所有子角色，否则该角色的子角色将挂载到该角色的父角色下
+	DeleteRole(ctx int64, role *Role, withChildren bool) (err error)
+
 	// AddRoleMutex 添加角色互斥关系
 	AddRoleMutex(ctx, roleId int64, mutexRoleIds []int64) (err error)
 
@@ -139,6 +251,24 @@ type Repository interface {
 	// CheckRoleMutex 验证角色是否是互斥关系
 	CheckRoleMutex(ctx, roleId, mutexRoleId int64) bool
 
+	// CheckRoleMutexE 与 CheckRoleMutex 相同，访问数据库或者缓存出错时返回错误
+	CheckRoleMutexE(ctx, roleId, mutexRoleId int64) (bool, error)
+
+	// AddRoleDynamicMutex 添加角色动态互斥关系
+	AddRoleDynamicMutex(ctx, roleId int64, mutexRoleIds []int64) (err error)
+
+	// RemoveRoleDynamicMutex 移除角色动态互斥关系
+	RemoveRoleDynamicMutex(ctx, roleId int64, mutexRoleIds []int64) (err error)
+
+	// CleanRoleDynamicMutex 清除角色动态互斥关系，即移除该角色的所有动态互斥角色
+	CleanRoleDynamicMutex(ctx, roleId int64) (err error)
+
+	// GetDynamicMutexRoles 获取指定角色的所有动态互斥角色
+	GetDynamicMutexRoles(ctx, roleId int64) (result []*RoleMutex, err error)
+
+	// GetDynamicMutexRolesWithIds 获取指定角色列表的所有动态互斥角色
+	GetDynamicMutexRolesWithIds(ctx int64, roleIds []int64) (result []*RoleMutex, err error)
+
 	// AddPreRole 添加角色先决条件
 	AddPreRole(ctx, roleId int64, preRoleIds []int64) (err error)
 
@@ -154,49 +284,157 @@ type Repository interface {
 	// GetPreRolesWithIds 获取指定角色列表的所有先决条件
 	GetPreRolesWithIds(ctx int64, roleIds []int64) (result []*PreRole, err error)
 
+	// GetPreRolesWithPreIds 获取将指定角色列表作为先决条件的角色信息
+	GetPreRolesWithPreIds(ctx int64, preRoleIds []int64) (result []*PreRole, err error)
+
 	// GetGrantedRoles 获取已授权给 target 的角色列表
 	// 如果参数 withChildren 的值为 true，则返回的角色数据中将包含该角色的子角色列表（子角色列表不一定授权给 target）
 	GetGrantedRoles(ctx int64, target string, withChildren bool) (result []*Role, err error)
 
-	// GrantRoleWithIds 授予角色给 target
+	// GrantRoleWithIds 授予角色给 target，授权永久有效
+	// 如果角色已经授予给 target 并且尚未过期，则保持原有的有效期不变
 	GrantRoleWithIds(ctx int64, target string, roleIds ...int64) (err error)
 
-	// RevokeRoleWithIds 取消对 target 的角色授权
+	// GrantRoleWithIdsBetween 授予角色给 target，授权只在 notBefore 与 expiresAt 之间有效，参数 notBefore 或者 expiresAt 的值为 nil 时表示不限制
+	// 如果角色已经授予给 target，则更新其有效期
+	GrantRoleWithIdsBetween(ctx int64, target string, notBefore, expiresAt *time.Time, roleIds ...int64) (err error)
+
+	// GetTargetsWithRoleIds 获取拥有指定角色的 target 列表（包括授权对象组），启用权限继承时包括通过继承关系拥有这些角色的权限的 target，用于清除受影响的缓存
+	GetTargetsWithRoleIds(ctx int64, roleIds []int64) (result []string, err error)
+
+	// GetTargetsWithPermissionIds 获取通过角色拥有指定权限的 target 列表（包括授权对象组），启用权限继承时包括通过继承关系拥有这些权限的 target，用于清除受影响的缓存
+	GetTargetsWithPermissionIds(ctx int64, permissionIds []int64) (result []string, err error)
+
+	// GetGrantsWithTarget 获取 target 的所有授权信息（包括授予给 target 所属的授权对象组的授权），包括尚未生效及已经过期的授权
+	GetGrantsWithTarget(ctx int64, target string) (result []*Grant, err error)
+
+	// CleanExpiredGrants 删除已经过期的授权信息及角色委托信息
+	CleanExpiredGrants(ctx int64) (err error)
+
+	// RevokeRoleWithIds 取消对 target 的角色授权，同时删除委托给 target 的相应委托记录
 	RevokeRoleWithIds(ctx int64, target string, roleIds ...int64) (err error)
 
-	// RevokeAllRole 取消对 target 的所有角色授权
+	// RevokeAllRole 取消对 target 的所有角色授权，同时删除委托给 target 的所有委托记录
 	RevokeAllRole(ctx int64, target string) (err error)
 
+	// GetGrantedRolesOn 获取在资源 resource 上授权给 target 的角色列表，不包含全局授权的角色
+	GetGrantedRolesOn(ctx int64, target, resource string) (result []*Role, err error)
+
+	// GrantRoleOnWithIds 在资源 resource 上授予角色给 target
+	GrantRoleOnWithIds(ctx int64, target, resource string, roleIds ...int64) (err error)
+
+	// RevokeRoleOnWithIds 取消对 target 在资源 resource 上的角色授权
+	RevokeRoleOnWithIds(ctx int64, target, resource string, roleIds ...int64) (err error)
+
+	// GetDelegations 获取未过期的角色委托信息，参数 fromTarget 及 toTarget 不为空时只返回匹配的委托信息
+	GetDelegations(ctx int64, fromTarget, toTarget string) (result []*Delegation, err error)
+
+	// AddDelegation 添加角色委托记录，如果委托记录已经存在，则更新其过期时间
+	AddDelegation(ctx, roleId int64, fromTarget, toTarget string, expiresAt time.Time) (err error)
+
+	// RemoveDelegation 删除角色委托记录
+	RemoveDelegation(ctx, roleId int64, fromTarget, toTarget string) (err error)
+
+	// RemoveDelegationsWithTarget 删除委托给 toTarget 的委托记录，参数 roleIds 为空时删除委托给 toTarget 的所有委托记录
+	RemoveDelegationsWithTarget(ctx int64, toTarget string, roleIds []int64) (err error)
+
+	// GetDenies 获取禁止权限信息，参数 target 不为空时只返回禁止该 target 使用的权限，参数 roleId 大于 0 时只返回禁止该角色使用的权限
+	GetDenies(ctx int64, target string, roleId int64) (result []*Deny, err error)
+
+	// AddDenyWithIds 禁止 target 或者角色使用权限，参数 target 与 roleId 只能有一个有效
+	AddDenyWithIds(ctx int64, target string, roleId int64, permissionIds []int64) (err error)
+
+	// RemoveDenyWithIds 取消禁止 target 或者角色使用权限
+	RemoveDenyWithIds(ctx int64, target string, roleId int64, permissionIds []int64) (err error)
+
 	// CheckPermission 验证 target 是否拥有指定权限
 	CheckPermission(ctx int64, target string, permissionName string) bool
 
+	// CheckPermissionE 与 CheckPermission 相同，访问数据库或者缓存出错时返回错误
+	CheckPermissionE(ctx int64, target string, permissionName string) (bool, error)
+
 	// CheckPermissionWithId 验证 target 是否拥有指定权限
 	CheckPermissionWithId(ctx int64, target string, permissionId int64) bool
 
+	// CheckPermissionWithIdE 与 CheckPermissionWithId 相同，访问数据库或者缓存出错时返回错误
+	CheckPermissionWithIdE(ctx int64, target string, permissionId int64) (bool, error)
+
+	// CheckPermissions 批量验证 target 是否拥有指定权限，返回结果包含所有 permissionNames
+	CheckPermissions(ctx int64, target string, permissionNames []string) (result map[string]bool, err error)
+
+	// ExplainPermission 获取 target 是否拥有指定权限的详细说明
+	ExplainPermission(ctx int64, target string, permissionName string) (result *Decision, err error)
+
+	// ExplainPermissionWithId 获取 target 是否拥有指定权限的详细说明
+	ExplainPermissionWithId(ctx int64, target string, permissionId int64) (result *Decision, err error)
+
+	// CheckSessionPermission 验证 target 是否通过已激活的角色 roleIds 拥有指定权限
+	CheckSessionPermission(ctx int64, target string, roleIds []int64, permissionName string) bool
+
+	// CheckSessionPermissionE 与 CheckSessionPermission 相同，访问数据库或者缓存出错时返回错误
+	CheckSessionPermissionE(ctx int64, target string, roleIds []int64, permissionName string) (bool, error)
+
+	// CheckSessionPermissionWithId 验证 target 是否通过已激活的角色 roleIds 拥有指定权限
+	CheckSessionPermissionWithId(ctx int64, target string, roleIds []int64, permissionId int64) bool
+
+	// CheckSessionPermissionWithIdE 与 CheckSessionPermissionWithId 相同，访问数据库或者缓存出错时返回错误
+	CheckSessionPermissionWithIdE(ctx int64, target string, roleIds []int64, permissionId int64) (bool, error)
+
+	// CheckPermissionOn 验证 target 是否通过资源授权在资源 resource 上拥有指定权限，不包含全局授权
+	CheckPermissionOn(ctx int64, target string, permissionName string, resource string) bool
+
+	// CheckPermissionOnE 与 CheckPermissionOn 相同，访问数据库或者缓存出错时返回错误
+	CheckPermissionOnE(ctx int64, target string, permissionName string, resource string) (bool, error)
+
+	// CheckPermissionOnWithId 验证 target 是否通过资源授权在资源 resource 上拥有指定权限，不包含全局授权
+	CheckPermissionOnWithId(ctx int64, target string, permissionId int64, resource string) bool
+
+	// CheckPermissionOnWithIdE 与 CheckPermissionOnWithId 相同，访问数据库或者缓存出错时返回错误
+	CheckPermissionOnWithIdE(ctx int64, target string, permissionId int64, resource string) (bool, error)
+
 	// CheckRole 验证 target 是否拥有指定角色
 	CheckRole(ctx int64, target string, roleName string) bool
 
+	// CheckRoleE 与 CheckRole 相同，访问数据库或者缓存出错时返回错误
+	CheckRoleE(ctx int64, target string, roleName string) (bool, error)
+
 	// CheckRoleWithId 验证 target 是否拥有指定角色
 	CheckRoleWithId(ctx int64, target string, roleId int64) bool
 
+	// CheckRoleWithIdE 与 CheckRoleWithId 相同，访问数据库或者缓存出错时返回错误
+	CheckRoleWithIdE(ctx int64, target string, roleId int64) (bool, error)
+
 	// CheckRoleAccessible 验证 target 是否拥有指定角色的操作权限
 	CheckRoleAccessible(ctx int64, target string, roleName string) bool
 
+	// CheckRoleAccessibleE 与 CheckRoleAccessible 相同，访问数据库或者缓存出错时返回错误
+	CheckRoleAccessibleE(ctx int64, target string, roleName string) (bool, error)
+
 	// CheckRoleAccessibleWithId 验证 target 是否拥有指定角色的操作权限
 	CheckRoleAccessibleWithId(ctx int64, target string, roleId int64) bool
 
+	// CheckRoleAccessibleWithIdE 与 CheckRoleAccessibleWithId 相同，访问数据库或者缓存出错时返回错误
+	CheckRoleAccessibleWithIdE(ctx int64, target string, roleId int64) (bool, error)
+
 	// CheckRolePermission 验证角色是否拥有指定权限
 	CheckRolePermission(ctx int64, roleName, permissionName string) bool
 
+	// CheckRolePermissionE 与 CheckRolePermission 相同，访问数据库或者缓存出错时返回错误
+	CheckRolePermissionE(ctx int64, roleName, permissionName string) (bool, error)
+
 	// CheckRolePermissionWithId 验证角色是否拥有指定权限
 	CheckRolePermissionWithId(ctx, roleId, permissionId int64) bool
 
+	// CheckRolePermissionWithIdE 与 CheckRolePermissionWithId 相同，访问数据库或者缓存出错时返回错误
+	CheckRolePermissionWithIdE(ctx, roleId, permissionId int64) (bool, error)
+
 	// CleanCache 清除缓存
 	CleanCache(ctx int64, target string)
 }
 
 type Service struct {
-	repo Repository
+	repo          Repository
+	failurePolicy FailurePolicy
 }
 
 func NewService(repo Repository) *Service {
@@ -205,6 +443,62 @@ func NewService(repo Repository) *Service {
 	return s
 }
 
+// WithContext 返回使用 ctx 执行所有数据库及缓存操作的 Service，原 Service 不受影响
+//
+// 所有方法的参数 ctx int64 为业务上下文（租户）标识，与 context.Context 无关；需要取消操作、设置超时或者传递追踪信息时，
+// 使用 WithContext 获取新的 Service 之后再调用相应的方法，如 s.WithContext(r.Context()).CheckPermission(1, "u1", "order:read")
+func (this *Service) WithContext(ctx context.Context) *Service {
+	var nService = *this
+	nService.repo = this.repo.WithContext(ctx)
+	return &nService
+}
+
+// Context 获取执行数据库及缓存操作时使用的 context.Context，未设置时为 context.Background()
+func (this *Service) Context() context.Context {
+	return this.repo.Context()
+}
+
+// UseInheritMode 设置权限继承模式，默认为 InheritNone，即角色只拥有直接授予给它的权限
+//
+// 设置之后 CheckPermission、CheckPermissionWithId 及 GetGrantedPermissions 等方法都将按照该模式计算 target 拥有的权限
+func (this *Service) UseInheritMode(mode InheritMode) {
+	this.repo.UseInheritMode(mode)
+}
+
+// UseInheritConstraint 设置角色互斥关系及先决条件是否沿角色树作用到子孙角色上，默认为 false，即只作用于设置了互斥关系或者先决条件的角色本身
+//
+// 设置之后角色 A 与角色 B 互斥时，角色 A 及其子孙角色与角色 B 及其子孙角色都互斥（动态互斥关系同样如此）；
+// 授予角色 A 需要先授予角色 P 时，授予角色 A 的子孙角色同样需要先授予角色 P，GrantRole 等方法都将按照该规则进行验证
+func (this *Service) UseInheritConstraint(inherit bool) {
+	this.repo.UseInheritConstraint(inherit)
+}
+
+// UsePermissionMatcher 设置权限名称匹配器，默认为 nil，即验证权限时权限名称需要完全相同
+//
+// 设置之后授予 order:* 权限的 target 同样拥有 order:refund 等与之匹配的权限，禁止权限同样支持通配；
+// GetGrantedPermissions 将返回通配权限展开之后的所有权限，参考 PermissionMatcher
+func (this *Service) UsePermissionMatcher(matcher *PermissionMatcher) {
+	this.repo.UsePermissionMatcher(matcher)
+}
+
+// UseFailurePolicy 设置所有 Check 开头的验证方法（如 CheckPermission、CheckPermissionOn、CheckPermissionWithAttrs、CheckSessionPermission、CheckRole 及 CheckRoleMutex 等）访问数据库或者缓存出错时的处理策略，默认为 FailClosed
+//
+// 需要区分验证失败与访问出错时使用对应的 E 方法，如 CheckPermissionE，E 方法不受该策略影响
+func (this *Service) UseFailurePolicy(policy FailurePolicy) {
+	this.failurePolicy = policy
+}
+
+// checkResult 根据处理策略得出验证结果，参数 denied 为拒绝时对应的验证结果，如验证权限时为 false，验证角色互斥时为 true
+func (this *Service) checkResult(ok bool, err error, denied bool) bool {
+	if err == nil {
+		return ok
+	}
+	if this.failurePolicy == FailOpen {
+		return !denied
+	}
+	return denied
+}
+
 // Init 执行初始化操作，目前主要功能为初始化数据库表。
 //
 // 虽然此方法可以被重复调用，但是外部应该尽量控制此方法只在需要的时候调用。
@@ -284,6 +578,10 @@ func (this *Service) updateGroup(ctx int64, gType GroupType, groupName, aliasNam
 	}
 
 	tx.Commit()
+	// 授权对象组的状态会影响组内所有成员拥有的权限
+	if gType == GroupTarget {
+		this.CleanCache(ctx, TargetOfGroup(group.Id))
+	}
 	return nil
 }
 
@@ -309,6 +607,10 @@ func (this *Service) updateGroupWithId(ctx int64, gType GroupType, groupId int64
 	}
 
 	tx.Commit()
+	// 授权对象组的状态会影响组内所有成员拥有的权限
+	if gType == GroupTarget {
+		this.CleanCache(ctx, TargetOfGroup(group.Id))
+	}
 	return nil
 }
 
@@ -344,6 +646,10 @@ func (this *Service) updateGroupStatusWithId(ctx int64, gType GroupType, groupId
 	}
 
 	tx.Commit()
+	// 授权对象组的状态会影响组内所有成员拥有的权限
+	if gType == GroupTarget {
+		this.CleanCache(ctx, TargetOfGroup(group.Id))
+	}
 	return nil
 }
 
@@ -369,6 +675,10 @@ func (this *Service) updateGroupStatus(ctx int64, gType GroupType, groupName str
 	}
 
 	tx.Commit()
+	// 授权对象组的状态会影响组内所有成员拥有的权限
+	if gType == GroupTarget {
+		this.CleanCache(ctx, TargetOfGroup(group.Id))
+	}
 	return nil
 }
 
@@ -382,6 +692,157 @@ func (this *Service) UpdatePermissionGroupStatusWithId(ctx int64, groupId int64,
 	return this.updateGroupStatusWithId(ctx, GroupPermission, groupId, status)
 }
 
+func (this *Service) renameGroup(ctx int64, gType GroupType, groupName, newGroupName string) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	group, err := nRepo.GetGroupWithName(ctx, gType, groupName)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return ErrGroupNotExist
+	}
+
+	if err = this.updateGroupName(ctx, nRepo, gType, group, newGroupName); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+func (this *Service) renameGroupWithId(ctx int64, gType GroupType, groupId int64, newGroupName string) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	group, err := nRepo.GetGroupWithId(ctx, gType, groupId)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return ErrGroupNotExist
+	}
+
+	if err = this.updateGroupName(ctx, nRepo, gType, group, newGroupName); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+func (this *Service) updateGroupName(ctx int64, nRepo Repository, gType GroupType, group *Group, newGroupName string) (err error) {
+	// 验证 newGroupName 是否已经存在
+	nGroup, err := nRepo.GetGroupWithName(ctx, gType, newGroupName)
+	if err != nil {
+		return err
+	}
+	if nGroup != nil {
+		if nGroup.Id == group.Id {
+			return nil
+		}
+		return ErrGroupNameExists
+	}
+	return nRepo.UpdateGroupName(ctx, gType, group.Id, newGroupName)
+}
+
+// RenamePermissionGroup 将权限组 groupName 的名称修改为 newGroupName
+func (this *Service) RenamePermissionGroup(ctx int64, groupName, newGroupName string) (err error) {
+	return this.renameGroup(ctx, GroupPermission, groupName, newGroupName)
+}
+
+// RenamePermissionGroupWithId 将权限组 groupId 的名称修改为 newGroupName
+func (this *Service) RenamePermissionGroupWithId(ctx, groupId int64, newGroupName string) (err error) {
+	return this.renameGroupWithId(ctx, GroupPermission, groupId, newGroupName)
+}
+
+// DeletePermissionGroup 根据 groupName 删除权限组，同时删除该组下的所有权限
+//
+// 如果该组下的权限为组外其它权限的前置权限，并且参数 force 的值为 false，则返回 ErrPermissionIsRequired
+func (this *Service) DeletePermissionGroup(ctx int64, groupName string, force bool) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	group, err := nRepo.GetGroupWithName(ctx, GroupPermission, groupName)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return ErrGroupNotExist
+	}
+
+	targets, err := this.deletePermissionGroup(ctx, nRepo, group, force)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// DeletePermissionGroupWithId 根据 groupId 删除权限组，同时删除该组下的所有权限
+//
+// 如果该组下的权限为组外其它权限的前置权限，并且参数 force 的值为 false，则返回 ErrPermissionIsRequired
+func (this *Service) DeletePermissionGroupWithId(ctx, groupId int64, force bool) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	group, err := nRepo.GetGroupWithId(ctx, GroupPermission, groupId)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return ErrGroupNotExist
+	}
+
+	targets, err := this.deletePermissionGroup(ctx, nRepo, group, force)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// deletePermissionGroup 删除权限组及组内所有的权限，返回受影响的 target 列表
+func (this *Service) deletePermissionGroup(ctx int64, nRepo Repository, group *Group, force bool) (result []string, err error) {
+	permissionList, err := nRepo.GetPermissions(ctx, 0, "", []int64{group.Id}, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	var permissionIds = make([]int64, 0, len(permissionList))
+	for _, p := range permissionList {
+		permissionIds = append(permissionIds, p.Id)
+	}
+
+	if result, err = this.deletePermissions(ctx, nRepo, permissionIds, force); err != nil {
+		return nil, err
+	}
+	if err = nRepo.DeleteGroup(ctx, GroupPermission, group.Id); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // GetPermissions 获取权限列表
 func (this *Service) GetPermissions(ctx int64, status Status, keywords string, groupIds []int64) (result []*Permission, err error) {
 	return this.repo.GetPermissions(ctx, status, keywords, groupIds, 0, 0)
@@ -447,6 +908,10 @@ func (this *Service) AddPermissionWithGroup(ctx int64, groupName, permissionName
 	}
 
 	tx.Commit()
+	// 启用权限名称匹配器时，新添加的权限可能与已授予的通配权限匹配
+	if this.repo.PermissionMatcher() != nil {
+		this.CleanCache(ctx, "")
+	}
 	return result, nil
 }
 
@@ -482,6 +947,10 @@ func (this *Service) AddPermissionWithGroupId(ctx, groupId int64, permissionName
 	}
 
 	tx.Commit()
+	// 启用权限名称匹配器时，新添加的权限可能与已授予的通配权限匹配
+	if this.repo.PermissionMatcher() != nil {
+		this.CleanCache(ctx, "")
+	}
 	return result, nil
 }
 
@@ -607,16 +1076,36 @@ func (this *Service) UpdatePermissionStatusWithId(ctx, permissionId int64, statu
 	return nil
 }
 
-// GrantPermission 授予权限给角色
-func (this *Service) GrantPermission(ctx int64, roleName string, permissionNames ...string) (err error) {
-	if len(permissionNames) == 0 {
+// RenamePermission 将权限 permissionName 的名称修改为 newPermissionName
+func (this *Service) RenamePermission(ctx int64, permissionName, newPermissionName string) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 验证权限是否存在
+	permission, err := nRepo.GetPermissionWithName(ctx, permissionName)
+	if err != nil {
+		return err
+	}
+	if permission == nil {
 		return ErrPermissionNotExist
 	}
 
-	if roleName == "" {
-		return ErrRoleNotExist
+	targets, err := this.updatePermissionName(ctx, nRepo, permission, newPermissionName)
+	if err != nil {
+		return err
 	}
 
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// RenamePermissionWithId 将权限 permissionId 的名称修改为 newPermissionName
+func (this *Service) RenamePermissionWithId(ctx, permissionId int64, newPermissionName string) (err error) {
 	var tx, nRepo = this.repo.BeginTx()
 	defer func() {
 		if err != nil {
@@ -624,96 +1113,185 @@ func (this *Service) GrantPermission(ctx int64, roleName string, permissionNames
 		}
 	}()
 
-	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	// 验证权限是否存在
+	permission, err := nRepo.GetPermissionWithId(ctx, permissionId)
 	if err != nil {
 		return err
 	}
-	if role == nil {
-		return ErrRoleNotExist
+	if permission == nil {
+		return ErrPermissionNotExist
 	}
 
-	// 获取当前角色的父角色
-	if role.ParentId > 0 {
-		parent, err := nRepo.GetRoleWithId(ctx, role.ParentId)
-		if err != nil {
-			return err
-		}
-		if parent == nil || parent.Status != Enable {
-			return ErrInvalidParentRole
-		}
+	targets, err := this.updatePermissionName(ctx, nRepo, permission, newPermissionName)
+	if err != nil {
+		return err
+	}
 
-		// 验证将要授权的权限是否超出父角色的权限
-		parentPermissions, err := nRepo.GetPermissionsWithRoleId(ctx, parent.Id)
-		if err != nil {
-			return err
-		}
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
 
-		var permissionMap = make(map[string]struct{})
-		for _, p := range parentPermissions {
-			permissionMap[p.Name] = struct{}{}
+// updatePermissionName 修改权限名称，返回受影响的 target 列表
+func (this *Service) updatePermissionName(ctx int64, nRepo Repository, permission *Permission, newPermissionName string) (result []string, err error) {
+	// 验证 newPermissionName 是否已经存在
+	nPermission, err := nRepo.GetPermissionWithName(ctx, newPermissionName)
+	if err != nil {
+		return nil, err
+	}
+	if nPermission != nil {
+		if nPermission.Id == permission.Id {
+			return nil, nil
 		}
+		return nil, ErrPermissionNameExists
+	}
 
-		for _, pName := range permissionNames {
-			if _, ok := permissionMap[pName]; ok == false {
-				return ErrPermissionOutOfParent
-			}
-		}
+	// 缓存中存储的是权限名称，需要在修改之前查询出拥有该权限的 target
+	if result, err = this.getPermissionTargets(ctx, nRepo, []int64{permission.Id}); err != nil {
+		return nil, err
+	}
+	if err = nRepo.UpdatePermissionName(ctx, permission.Id, newPermissionName); err != nil {
+		return nil, err
 	}
+	return result, nil
+}
 
-	permissionList, err := nRepo.GetPermissionsWithNames(ctx, permissionNames...)
+// DeletePermission 根据 permissionName 删除权限，同时清除与之相关的角色权限及先决条件
+//
+// 如果该权限为其它权限的前置权限，并且参数 force 的值为 false，则返回 ErrPermissionIsRequired
+func (this *Service) DeletePermission(ctx int64, permissionName string, force bool) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 验证权限是否存在
+	permission, err := nRepo.GetPermissionWithName(ctx, permissionName)
 	if err != nil {
 		return err
 	}
-
-	var gIds = make([]int64, 0, len(permissionList)) // 本次新授权权限 id 列表加上原来已授权权限 id 列表
-	var nIds = make([]int64, 0, len(permissionList)) // 本次新授权权限 id 列表
-	var gIdm = make(map[int64]struct{})              // 本次新授权权限 id 加上原来已授权权限 id 组成的 map
-	for _, permission := range permissionList {
-		gIds = append(gIds, permission.Id)
-		nIds = append(nIds, permission.Id)
-		gIdm[permission.Id] = struct{}{}
-	}
-	if len(nIds) == 0 {
-		return ErrGrantFailed
+	if permission == nil {
+		return ErrPermissionNotExist
 	}
 
-	// 查询出已授予给该角色的权限
-	grantedPermissionList, err := nRepo.GetPermissionsWithRoleId(ctx, role.Id)
+	targets, err := this.deletePermissions(ctx, nRepo, []int64{permission.Id}, force)
 	if err != nil {
 		return err
 	}
-	for _, permission := range grantedPermissionList {
-		gIds = append(gIds, permission.Id)
-		gIdm[permission.Id] = struct{}{}
-	}
 
-	// 获取并验证所有权限所需要的权限先决条件
-	prePermissionList, err := nRepo.GetPrePermissionsWithIds(ctx, gIds)
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// DeletePermissionWithId 根据 permissionId 删除权限，同时清除与之相关的角色权限及先决条件
+//
+// 如果该权限为其它权限的前置权限，并且参数 force 的值为 false，则返回 ErrPermissionIsRequired
+func (this *Service) DeletePermissionWithId(ctx, permissionId int64, force bool) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 验证权限是否存在
+	permission, err := nRepo.GetPermissionWithId(ctx, permissionId)
 	if err != nil {
 		return err
 	}
-	for _, pPermission := range prePermissionList {
-		if _, ok := gIdm[pPermission.PrePermissionId]; ok == false {
-			return fmt.Errorf("授予权限 %s 时需要先授予权限 %s", pPermission.PermissionAliasName, pPermission.PrePermissionAliasName)
-		}
+	if permission == nil {
+		return ErrPermissionNotExist
 	}
 
-	if err = nRepo.GrantPermissionWithIds(ctx, role.Id, nIds); err != nil {
+	targets, err := this.deletePermissions(ctx, nRepo, []int64{permission.Id}, force)
+	if err != nil {
 		return err
 	}
 
 	tx.Commit()
+	this.cleanCaches(ctx, targets)
 	return nil
 }
 
+// deletePermissions 删除权限，返回受影响的 target 列表
+func (this *Service) deletePermissions(ctx int64, nRepo Repository, permissionIds []int64, force bool) (result []string, err error) {
+	if len(permissionIds) == 0 {
+		return nil, nil
+	}
+
+	if force == false {
+		// 验证待删除的权限是否为其它权限的前置权限
+		prePermissionList, err := nRepo.GetPrePermissionsWithPreIds(ctx, permissionIds)
+		if err != nil {
+			return nil, err
+		}
+		var permissionMap = make(map[int64]struct{}, len(permissionIds))
+		for _, pId := range permissionIds {
+			permissionMap[pId] = struct{}{}
+		}
+		for _, pp := range prePermissionList {
+			if _, ok := permissionMap[pp.PermissionId]; ok == false {
+				return nil, ErrPermissionIsRequired
+			}
+		}
+	}
+
+	// 删除之后无法再查询到受影响的 target，需要先查询出来
+	if result, err = this.getPermissionTargets(ctx, nRepo, permissionIds); err != nil {
+		return nil, err
+	}
+	if err = nRepo.DeletePermissionWithIds(ctx, permissionIds); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// getPermissionTargets 获取通过角色拥有指定权限的 target 列表，用于在事务提交之后清除受影响的缓存
+//
+// 启用权限名称匹配器时缓存中存储的是通配权限展开之后的权限名称，与之匹配的其它权限同样会受到影响，此时返回空字符串，即清除该 ctx 下所有的缓存
+func (this *Service) getPermissionTargets(ctx int64, nRepo Repository, permissionIds []int64) (result []string, err error) {
+	if nRepo.PermissionMatcher() != nil {
+		return []string{""}, nil
+	}
+	return nRepo.GetTargetsWithPermissionIds(ctx, permissionIds)
+}
+
+// GrantPermission 授予权限给角色
+//
+// 如果权限的先决权限被设置为自动授予（参考 AddAutoGrantPrePermission），并且角色还未拥有该先决权限，则会一并授予该先决权限（包括先决权限的先决权限）
+func (this *Service) GrantPermission(ctx int64, roleName string, permissionNames ...string) (err error) {
+	_, err = this.grantPermissionWithNames(ctx, roleName, permissionNames...)
+	return err
+}
+
+// GrantPermissionWithResult 同 GrantPermission，返回值 result 为自动授予的先决权限列表
+func (this *Service) GrantPermissionWithResult(ctx int64, roleName string, permissionNames ...string) (result []*Permission, err error) {
+	return this.grantPermissionWithNames(ctx, roleName, permissionNames...)
+}
+
 // GrantPermissionWithId 授予权限给角色
+//
+// 如果权限的先决权限被设置为自动授予（参考 AddAutoGrantPrePermissionWithId），并且角色还未拥有该先决权限，则会一并授予该先决权限（包括先决权限的先决权限）
 func (this *Service) GrantPermissionWithId(ctx int64, roleId int64, permissionIds ...int64) (err error) {
-	if len(permissionIds) == 0 {
-		return ErrPermissionNotExist
+	_, err = this.grantPermissionWithIds(ctx, roleId, permissionIds...)
+	return err
+}
+
+// GrantPermissionWithIdWithResult 同 GrantPermissionWithId，返回值 result 为自动授予的先决权限列表
+func (this *Service) GrantPermissionWithIdWithResult(ctx int64, roleId int64, permissionIds ...int64) (result []*Permission, err error) {
+	return this.grantPermissionWithIds(ctx, roleId, permissionIds...)
+}
+
+func (this *Service) grantPermissionWithNames(ctx int64, roleName string, permissionNames ...string) (result []*Permission, err error) {
+	if len(permissionNames) == 0 {
+		return nil, ErrPermissionNotExist
 	}
 
-	if roleId <= 0 {
-		return ErrRoleNotExist
+	if roleName == "" {
+		return nil, ErrRoleNotExist
 	}
 
 	var tx, nRepo = this.repo.BeginTx()
@@ -723,86 +1301,144 @@ func (this *Service) GrantPermissionWithId(ctx int64, roleId int64, permissionId
 		}
 	}()
 
-	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if role == nil {
-		return ErrRoleNotExist
+		return nil, ErrRoleNotExist
 	}
 
-	// 获取当前角色的父角色
-	if role.ParentId > 0 {
-		parent, err := nRepo.GetRoleWithId(ctx, role.ParentId)
-		if err != nil {
-			return err
-		}
-		if parent == nil || parent.Status != Enable {
-			return ErrInvalidParentRole
-		}
+	permissionList, err := nRepo.GetPermissionsWithNames(ctx, permissionNames...)
+	if err != nil {
+		return nil, err
+	}
+	if result, err = this.grantPermission(ctx, nRepo, role, permissionList); err != nil {
+		return nil, err
+	}
 
-		// 验证将要授权的权限是否超出父角色的权限
-		parentPermissions, err := nRepo.GetPermissionsWithRoleId(ctx, parent.Id)
-		if err != nil {
-			return err
-		}
+	tx.Commit()
+	return result, nil
+}
 
-		var permissionMap = make(map[int64]struct{})
-		for _, p := range parentPermissions {
-			permissionMap[p.Id] = struct{}{}
-		}
+func (this *Service) grantPermissionWithIds(ctx int64, roleId int64, permissionIds ...int64) (result []*Permission, err error) {
+	if len(permissionIds) == 0 {
+		return nil, ErrPermissionNotExist
+	}
 
-		for _, pId := range permissionIds {
-			if _, ok := permissionMap[pId]; ok == false {
-				return ErrPermissionOutOfParent
-			}
+	if roleId <= 0 {
+		return nil, ErrRoleNotExist
+	}
+
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
 		}
+	}()
+
+	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, ErrRoleNotExist
 	}
 
 	permissionList, err := nRepo.GetPermissionsWithIds(ctx, permissionIds...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if result, err = this.grantPermission(ctx, nRepo, role, permissionList); err != nil {
+		return nil, err
 	}
 
-	var gIds = make([]int64, 0, len(permissionList))
-	var nIds = make([]int64, 0, len(permissionList))
-	var gIdm = make(map[int64]struct{})
+	tx.Commit()
+	return result, nil
+}
+
+// grantPermission 授予权限给角色，并一并授予被设置为自动授予的先决权限，返回自动授予的先决权限列表
+func (this *Service) grantPermission(ctx int64, nRepo Repository, role *Role, permissionList []*Permission) (result []*Permission, err error) {
+	var gIds = make([]int64, 0, len(permissionList)) // 本次新授权权限 id 列表加上原来已授权权限 id 列表
+	var nIds = make([]int64, 0, len(permissionList)) // 本次新授权权限 id 列表
+	var gIdm = make(map[int64]struct{})              // 本次新授权权限 id 加上原来已授权权限 id 组成的 map
 	for _, permission := range permissionList {
 		gIds = append(gIds, permission.Id)
 		nIds = append(nIds, permission.Id)
 		gIdm[permission.Id] = struct{}{}
 	}
 	if len(nIds) == 0 {
-		return ErrGrantFailed
+		return nil, ErrGrantFailed
 	}
 
 	// 查询出已授予给该角色的权限
 	grantedPermissionList, err := nRepo.GetPermissionsWithRoleId(ctx, role.Id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	for _, permission := range grantedPermissionList {
 		gIds = append(gIds, permission.Id)
 		gIdm[permission.Id] = struct{}{}
 	}
 
-	// 获取并验证所有权限所需要的权限先决条件
-	prePermissionList, err := nRepo.GetPrePermissionsWithIds(ctx, gIds)
-	if err != nil {
-		return err
+	// 获取并验证所有权限所需要的权限先决条件，需要自动授予的先决权限也需要验证其先决条件
+	var aIds []int64 // 自动授予的权限 id 列表
+	var cIds = gIds  // 本轮需要验证先决条件的权限 id 列表
+	for len(cIds) > 0 {
+		prePermissionList, err := nRepo.GetPrePermissionsWithIds(ctx, cIds)
+		if err != nil {
+			return nil, err
+		}
+		cIds = nil
+		for _, pPermission := range prePermissionList {
+			if _, ok := gIdm[pPermission.PrePermissionId]; ok {
+				continue
+			}
+			if pPermission.AutoGrant == false {
+				return nil, newPrePermissionMissingError(pPermission)
+			}
+			gIdm[pPermission.PrePermissionId] = struct{}{}
+			nIds = append(nIds, pPermission.PrePermissionId)
+			aIds = append(aIds, pPermission.PrePermissionId)
+			cIds = append(cIds, pPermission.PrePermissionId)
+		}
 	}
-	for _, pPermission := range prePermissionList {
-		if _, ok := gIdm[pPermission.PrePermissionId]; ok == false {
-			return fmt.Errorf("授予权限 %s 时需要先授予权限 %s", pPermission.PermissionAliasName, pPermission.PrePermissionAliasName)
+
+	// 验证将要授权的权限（包括自动授予的先决权限）是否超出父角色的权限
+	if role.ParentId > 0 {
+		parent, err := nRepo.GetRoleWithId(ctx, role.ParentId)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil || parent.Status != Enable {
+			return nil, ErrInvalidParentRole
+		}
+
+		parentPermissions, err := nRepo.GetPermissionsWithRoleId(ctx, parent.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		var permissionMap = make(map[int64]struct{})
+		for _, p := range parentPermissions {
+			permissionMap[p.Id] = struct{}{}
+		}
+
+		if err = this.checkPermissionOutOfParent(ctx, nRepo, role, parent, permissionMap, nIds); err != nil {
+			return nil, err
 		}
 	}
 
-	if err = nRepo.GrantPermissionWithIds(ctx, roleId, nIds); err != nil {
-		return err
+	if err = nRepo.GrantPermissionWithIds(ctx, role.Id, nIds); err != nil {
+		return nil, err
 	}
 
-	tx.Commit()
-	return nil
+	if len(aIds) > 0 {
+		if result, err = nRepo.GetPermissionsWithIds(ctx, aIds...); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
 }
 
 // ReGrantPermission 授予权限给角色，会将原有的权限先取消掉
@@ -851,10 +1487,18 @@ func (this *Service) ReGrantPermission(ctx int64, roleName string, permissionNam
 			permissionMap[p.Name] = struct{}{}
 		}
 
+		var outNames []string
 		for _, pName := range permissionNames {
 			if _, ok := permissionMap[pName]; ok == false {
-				return ErrPermissionOutOfParent
+				outNames = append(outNames, pName)
+			}
+		}
+		if len(outNames) > 0 {
+			outPermissions, err := nRepo.GetPermissionsWithNames(ctx, outNames...)
+			if err != nil {
+				return err
 			}
+			return newPermissionOutOfParentError(role, parent, permissionAliasNames(outPermissions))
 		}
 	}
 
@@ -894,7 +1538,7 @@ func (this *Service) ReGrantPermission(ctx int64, roleName string, permissionNam
 	}
 	for _, pPermission := range prePermissionList {
 		if _, ok := gIdm[pPermission.PrePermissionId]; ok == false {
-			return fmt.Errorf("授予权限 %s 时需要先授予权限 %s", pPermission.PermissionAliasName, pPermission.PrePermissionAliasName)
+			return newPrePermissionMissingError(pPermission)
 		}
 	}
 
@@ -958,10 +1602,8 @@ func (this *Service) ReGrantPermissionWithId(ctx int64, roleId int64, permission
 			permissionMap[p.Id] = struct{}{}
 		}
 
-		for _, pId := range permissionIds {
-			if _, ok := permissionMap[pId]; ok == false {
-				return ErrPermissionOutOfParent
-			}
+		if err = this.checkPermissionOutOfParent(ctx, nRepo, role, parent, permissionMap, permissionIds); err != nil {
+			return err
 		}
 	}
 
@@ -1001,7 +1643,7 @@ func (this *Service) ReGrantPermissionWithId(ctx int64, roleId int64, permission
 	}
 	for _, pPermission := range prePermissionList {
 		if _, ok := gIdm[pPermission.PrePermissionId]; ok == false {
-			return fmt.Errorf("授予权限 %s 时需要先授予权限 %s", pPermission.PermissionAliasName, pPermission.PrePermissionAliasName)
+			return newPrePermissionMissingError(pPermission)
 		}
 	}
 
@@ -1082,7 +1724,7 @@ func (this *Service) RevokePermission(ctx int64, roleName string, permissionName
 		}
 		for _, pPermission := range prePermissionList {
 			if _, ok := gIdm[pPermission.PrePermissionId]; ok == false {
-				return fmt.Errorf("权限 %s 依赖于权限 %s", pPermission.PermissionAliasName, pPermission.PrePermissionAliasName)
+				return newPrePermissionRequiredError(pPermission)
 			}
 		}
 	}
@@ -1154,7 +1796,7 @@ func (this *Service) RevokePermissionWithId(ctx int64, roleId int64, permissionI
 		}
 		for _, pPermission := range prePermissionList {
 			if _, ok := gIdm[pPermission.PrePermissionId]; ok == false {
-				return fmt.Errorf("权限 %s 依赖于权限 %s", pPermission.PermissionAliasName, pPermission.PrePermissionAliasName)
+				return newPrePermissionRequiredError(pPermission)
 			}
 		}
 	}
@@ -1206,6 +1848,17 @@ func (this *Service) RevokeAllPermissionWithId(ctx, roleId int64) (err error) {
 
 // AddPrePermission 添加授予该权限时需要的先决条件
 func (this *Service) AddPrePermission(ctx int64, permissionName string, prePermissionNames ...string) (err error) {
+	return this.addPrePermissionWithNames(ctx, permissionName, false, prePermissionNames...)
+}
+
+// AddAutoGrantPrePermission 添加授予该权限时需要的先决条件，并将先决权限设置为自动授予
+//
+// 授予该权限时，如果角色还未拥有先决权限，将会自动授予先决权限
+func (this *Service) AddAutoGrantPrePermission(ctx int64, permissionName string, prePermissionNames ...string) (err error) {
+	return this.addPrePermissionWithNames(ctx, permissionName, true, prePermissionNames...)
+}
+
+func (this *Service) addPrePermissionWithNames(ctx int64, permissionName string, autoGrant bool, prePermissionNames ...string) (err error) {
 	if len(prePermissionNames) == 0 {
 		return ErrPrePermissionNotExist
 	}
@@ -1239,7 +1892,12 @@ func (this *Service) AddPrePermission(ctx int64, permissionName string, prePermi
 		return ErrPreRoleNotExist
 	}
 
-	if err = nRepo.AddPrePermission(ctx, permission.Id, preIds); err != nil {
+	// 验证先决条件是否会形成循环依赖
+	if err = this.checkPrePermissionCycle(ctx, nRepo, permission, prePermissionList); err != nil {
+		return err
+	}
+
+	if err = nRepo.AddPrePermission(ctx, permission.Id, preIds, autoGrant); err != nil {
 		return err
 	}
 
@@ -1249,6 +1907,17 @@ func (this *Service) AddPrePermission(ctx int64, permissionName string, prePermi
 
 // AddPrePermissionWithId 添加授予该权限时需要的先决条件
 func (this *Service) AddPrePermissionWithId(ctx, permissionId int64, prePermissionIds ...int64) (err error) {
+	return this.addPrePermissionWithIds(ctx, permissionId, false, prePermissionIds...)
+}
+
+// AddAutoGrantPrePermissionWithId 添加授予该权限时需要的先决条件，并将先决权限设置为自动授予
+//
+// 授予该权限时，如果角色还未拥有先决权限，将会自动授予先决权限
+func (this *Service) AddAutoGrantPrePermissionWithId(ctx, permissionId int64, prePermissionIds ...int64) (err error) {
+	return this.addPrePermissionWithIds(ctx, permissionId, true, prePermissionIds...)
+}
+
+func (this *Service) addPrePermissionWithIds(ctx, permissionId int64, autoGrant bool, prePermissionIds ...int64) (err error) {
 	if len(prePermissionIds) == 0 {
 		return ErrPrePermissionNotExist
 	}
@@ -1282,7 +1951,12 @@ func (this *Service) AddPrePermissionWithId(ctx, permissionId int64, prePermissi
 		return ErrPreRoleNotExist
 	}
 
-	if err = nRepo.AddPrePermission(ctx, permission.Id, preIds); err != nil {
+	// 验证先决条件是否会形成循环依赖
+	if err = this.checkPrePermissionCycle(ctx, nRepo, permission, prePermissionList); err != nil {
+		return err
+	}
+
+	if err = nRepo.AddPrePermission(ctx, permission.Id, preIds, autoGrant); err != nil {
 		return err
 	}
 
@@ -1428,111 +2102,2475 @@ func (this *Service) GetPrePermissionsWithId(ctx int64, permissionId int64) (res
 	return this.repo.GetPrePermissions(ctx, permission.Id)
 }
 
-// GetRoles 获取角色列表
-//
-// 如果参数 isGrantedToTarget 的值不为空字符串，则返回的角色数据中将包含该角色（通过 Granted 判断）是否已授权给 isGrantedToTarget
-//
-// 如果参数 limitedInTarget 的值不为空字符串， 则返回的角色数据将限定在 limitedInTarget 已拥有的角色及其子角色范围内
-//
-// 返回的角色数据的 Granted 字段参照的是 isGrantedToTarget
-//
-// 返回的角色数据的 Accessible 字段参照的是 limitedInTarget
-func (this *Service) GetRoles(ctx int64, status Status, keywords, isGrantedToTarget, limitedInTarget string) (result []*Role, err error) {
-	if limitedInTarget == "" {
-		return this.repo.GetRoles(ctx, -1, status, keywords, isGrantedToTarget)
+// GetRoleGroups 获取角色组列表
+func (this *Service) GetRoleGroups(ctx int64, status Status, keywords string) (result []*Group, err error) {
+	return this.repo.GetGroups(ctx, GroupRole, status, keywords)
+}
+
+// GetRoleGroup 根据 groupName 获取角色组信息
+func (this *Service) GetRoleGroup(ctx int64, groupName string) (result *Group, err error) {
+	return this.repo.GetGroupWithName(ctx, GroupRole, groupName)
+}
+
+// GetRoleGroupWithId 根据组 groupId 获取角色组信息
+func (this *Service) GetRoleGroupWithId(ctx, groupId int64) (result *Group, err error) {
+	return this.repo.GetGroupWithId(ctx, GroupRole, groupId)
+}
+
+// AddRoleGroup 添加角色组信息
+func (this *Service) AddRoleGroup(ctx int64, groupName, aliasName string, status Status) (result int64, err error) {
+	return this.addGroup(ctx, GroupRole, groupName, aliasName, status)
+}
+
+// UpdateRoleGroup 根据 groupName 更新角色组信息
+func (this *Service) UpdateRoleGroup(ctx int64, groupName string, aliasName string, status Status) (err error) {
+	return this.updateGroup(ctx, GroupRole, groupName, aliasName, status)
+}
+
+// UpdateRoleGroupWithId 根据 groupId 更新角色组信息
+func (this *Service) UpdateRoleGroupWithId(ctx, groupId int64, aliasName string, status Status) (err error) {
+	return this.updateGroupWithId(ctx, GroupRole, groupId, aliasName, status)
+}
+
+// UpdateRoleGroupStatus 根据 groupName 更新角色组状态
+func (this *Service) UpdateRoleGroupStatus(ctx int64, groupName string, status Status) (err error) {
+	return this.updateGroupStatus(ctx, GroupRole, groupName, status)
+}
+
+// UpdateRoleGroupStatusWithId 根据 groupId 更新角色组状态
+func (this *Service) UpdateRoleGroupStatusWithId(ctx int64, groupId int64, status Status) (err error) {
+	return this.updateGroupStatusWithId(ctx, GroupRole, groupId, status)
+}
+
+// RenameRoleGroup 将角色组 groupName 的名称修改为 newGroupName
+func (this *Service) RenameRoleGroup(ctx int64, groupName, newGroupName string) (err error) {
+	return this.renameGroup(ctx, GroupRole, groupName, newGroupName)
+}
+
+// RenameRoleGroupWithId 将角色组 groupId 的名称修改为 newGroupName
+func (this *Service) RenameRoleGroupWithId(ctx, groupId int64, newGroupName string) (err error) {
+	return this.renameGroupWithId(ctx, GroupRole, groupId, newGroupName)
+}
+
+// DeleteRoleGroup 根据 groupName 删除角色组，该组下的角色不会被删除，只会从该组中移除
+func (this *Service) DeleteRoleGroup(ctx int64, groupName string) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	group, err := nRepo.GetGroupWithName(ctx, GroupRole, groupName)
+	if err != nil {
+		return err
 	}
-	return this.repo.GetRolesInTarget(ctx, limitedInTarget, status, keywords, isGrantedToTarget)
+	if group == nil {
+		return ErrGroupNotExist
+	}
+
+	if err = this.deleteRoleGroup(ctx, nRepo, group); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
 }
 
-// GetRolesWithParent 获取角色列表
+// DeleteRoleGroupWithId 根据 groupId 删除角色组，该组下的角色不会被删除，只会从该组中移除
+func (this *Service) DeleteRoleGroupWithId(ctx, groupId int64) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	group, err := nRepo.GetGroupWithId(ctx, GroupRole, groupId)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return ErrGroupNotExist
+	}
+
+	if err = this.deleteRoleGroup(ctx, nRepo, group); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+func (this *Service) deleteRoleGroup(ctx int64, nRepo Repository, group *Group) (err error) {
+	roleList, err := nRepo.GetRolesWithGroupIds(ctx, 0, []int64{group.Id})
+	if err != nil {
+		return err
+	}
+	var roleIds = make([]int64, 0, len(roleList))
+	for _, role := range roleList {
+		roleIds = append(roleIds, role.Id)
+	}
+	if err = nRepo.UpdateRoleGroupWithIds(ctx, 0, roleIds); err != nil {
+		return err
+	}
+	return nRepo.DeleteGroup(ctx, GroupRole, group.Id)
+}
+
+// SetRoleGroup 将角色列表添加到角色组 groupName 中，如果参数 groupName 的值为空字符串，则表示将角色从其所在的组中移除
 //
-// 如果参数 isGrantedToTarget 的值不为空字符串，则返回的角色数据中将包含该角色（通过 Granted 判断）是否已授权给 isGrantedToTarget
-func (this *Service) GetRolesWithParent(ctx int64, parentRoleName string, status Status, keywords, isGrantedToTarget string) (result []*Role, err error) {
-	var parentRoleId int64 = 0
-	if parentRoleName != "" {
-		// 验证 parentRoleName 是否存在
-		role, err := this.repo.GetRoleWithName(ctx, parentRoleName)
+// 一个角色只能属于一个角色组，如果角色已经属于其它角色组，则会从原来的角色组中移除
+func (this *Service) SetRoleGroup(ctx int64, groupName string, roleNames ...string) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
 		if err != nil {
-			return nil, err
+			tx.Rollback()
 		}
-		if role == nil {
-			return nil, ErrRoleNotExist
+	}()
+
+	var groupId int64
+	if groupName != "" {
+		group, err := nRepo.GetGroupWithName(ctx, GroupRole, groupName)
+		if err != nil {
+			return err
 		}
-		parentRoleId = role.Id
+		if group == nil {
+			return ErrGroupNotExist
+		}
+		groupId = group.Id
 	}
-	return this.repo.GetRoles(ctx, parentRoleId, status, keywords, isGrantedToTarget)
+
+	if len(roleNames) == 0 {
+		tx.Commit()
+		return nil
+	}
+
+	roleList, err := nRepo.GetRolesWithNames(ctx, roleNames...)
+	if err != nil {
+		return err
+	}
+	if len(roleList) != len(roleNames) {
+		return ErrRoleNotExist
+	}
+	var roleIds = make([]int64, 0, len(roleList))
+	for _, role := range roleList {
+		roleIds = append(roleIds, role.Id)
+	}
+
+	if err = nRepo.UpdateRoleGroupWithIds(ctx, groupId, roleIds); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
 }
 
-// GetRolesWithParentId 获取角色列表
+// SetRoleGroupWithId 将角色列表添加到角色组 groupId 中，如果参数 groupId 的值为 0，则表示将角色从其所在的组中移除
 //
-// 如果参数 isGrantedToTarget 的值不为空字符串，则返回的角色数据中将包含该角色（通过 Granted 判断）是否已授权给 isGrantedToTarget
-func (this *Service) GetRolesWithParentId(ctx, parentRoleId int64, status Status, keywords, isGrantedToTarget string) (result []*Role, err error) {
-	if parentRoleId < 0 {
-		parentRoleId = 0
+// 一个角色只能属于一个角色组，如果角色已经属于其它角色组，则会从原来的角色组中移除
+func (this *Service) SetRoleGroupWithId(ctx, groupId int64, roleIds ...int64) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if groupId < 0 {
+		return ErrGroupNotExist
 	}
-	if parentRoleId > 0 {
-		// 验证 parentRoleId 是否存在
-		role, err := this.repo.GetRoleWithId(ctx, parentRoleId)
+
+	if groupId > 0 {
+		group, err := nRepo.GetGroupWithId(ctx, GroupRole, groupId)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		if role == nil {
-			return nil, ErrRoleNotExist
+		if group == nil {
+			return ErrGroupNotExist
 		}
-		parentRoleId = role.Id
 	}
-	return this.repo.GetRoles(ctx, parentRoleId, status, keywords, isGrantedToTarget)
+
+	if len(roleIds) == 0 {
+		tx.Commit()
+		return nil
+	}
+
+	roleList, err := nRepo.GetRolesWithIds(ctx, roleIds...)
+	if err != nil {
+		return err
+	}
+	if len(roleList) != len(roleIds) {
+		return ErrRoleNotExist
+	}
+
+	if err = nRepo.UpdateRoleGroupWithIds(ctx, groupId, roleIds); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
 }
 
-// GetRole 根据 roleName 获取角色信息
-func (this *Service) GetRole(ctx int64, name string) (result *Role, err error) {
-	result, err = this.repo.GetRoleWithName(ctx, name)
+// GetRolesTree 获取角色组列表，组中包含该组所有的角色信息，组中的角色按照 left_value 排序
+//
+// 未添加到任何角色组中的角色不会被返回
+func (this *Service) GetRolesTree(ctx int64, status Status) (result []*Group, err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	groupList, err := nRepo.GetGroups(ctx, GroupRole, status, "")
 	if err != nil {
 		return nil, err
 	}
-	if result != nil {
-		if result.PermissionList, err = this.repo.GetPermissionsWithRoleId(ctx, result.Id); err != nil {
-			return nil, err
-		}
-		if result.MutexRoleList, err = this.repo.GetMutexRoles(ctx, result.Id); err != nil {
-			return nil, err
-		}
-		if result.PreRoleList, err = this.repo.GetPreRoles(ctx, result.Id); err != nil {
-			return nil, err
+	if len(groupList) == 0 {
+		tx.Commit()
+		return nil, nil
+	}
+
+	var groupMap = make(map[int64]*Group)
+	var groupIds = make([]int64, 0, len(groupList))
+	for _, group := range groupList {
+		groupMap[group.Id] = group
+		groupIds = append(groupIds, group.Id)
+	}
+
+	rList, err := nRepo.GetRolesWithGroupIds(ctx, status, groupIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rList {
+		var group = groupMap[r.GroupId]
+		if group != nil {
+			group.RoleList = append(group.RoleList, r)
 		}
 	}
+
+	tx.Commit()
+	result = groupList
 	return result, nil
 }
 
-// GetRoleWithId 根据 roleId 获取角色信息
-func (this *Service) GetRoleWithId(ctx, roleId int64) (result *Role, err error) {
-	result, err = this.repo.GetRoleWithId(ctx, roleId)
+// GetTargetGroups 获取授权对象组列表
+func (this *Service) GetTargetGroups(ctx int64, status Status, keywords string) (result []*Group, err error) {
+	return this.repo.GetGroups(ctx, GroupTarget, status, keywords)
+}
+
+// GetTargetGroup 根据 groupName 获取授权对象组信息
+func (this *Service) GetTargetGroup(ctx int64, groupName string) (result *Group, err error) {
+	return this.repo.GetGroupWithName(ctx, GroupTarget, groupName)
+}
+
+// GetTargetGroupWithId 根据 groupId 获取授权对象组信息
+func (this *Service) GetTargetGroupWithId(ctx, groupId int64) (result *Group, err error) {
+	return this.repo.GetGroupWithId(ctx, GroupTarget, groupId)
+}
+
+// GetTargetGroupsWithTarget 获取 target 所属的授权对象组列表
+func (this *Service) GetTargetGroupsWithTarget(ctx int64, target string) (result []*Group, err error) {
+	return this.repo.GetGroupsWithTarget(ctx, target)
+}
+
+// AddTargetGroup 添加授权对象组，授予给组的角色对组内所有成员有效
+func (this *Service) AddTargetGroup(ctx int64, groupName, aliasName string, status Status) (result int64, err error) {
+	return this.addGroup(ctx, GroupTarget, groupName, aliasName, status)
+}
+
+// UpdateTargetGroup 根据 groupName 更新授权对象组信息，组处于禁用状态时，授予给组的角色对组内成员无效
+func (this *Service) UpdateTargetGroup(ctx int64, groupName string, aliasName string, status Status) (err error) {
+	return this.updateGroup(ctx, GroupTarget, groupName, aliasName, status)
+}
+
+// UpdateTargetGroupWithId 根据 groupId 更新授权对象组信息，组处于禁用状态时，授予给组的角色对组内成员无效
+func (this *Service) UpdateTargetGroupWithId(ctx, groupId int64, aliasName string, status Status) (err error) {
+	return this.updateGroupWithId(ctx, GroupTarget, groupId, aliasName, status)
+}
+
+// UpdateTargetGroupStatus 根据 groupName 更新授权对象组状态
+func (this *Service) UpdateTargetGroupStatus(ctx int64, groupName string, status Status) (err error) {
+	return this.updateGroupStatus(ctx, GroupTarget, groupName, status)
+}
+
+// UpdateTargetGroupStatusWithId 根据 groupId 更新授权对象组状态
+func (this *Service) UpdateTargetGroupStatusWithId(ctx int64, groupId int64, status Status) (err error) {
+	return this.updateGroupStatusWithId(ctx, GroupTarget, groupId, status)
+}
+
+// RenameTargetGroup 将授权对象组 groupName 的名称修改为 newGroupName
+func (this *Service) RenameTargetGroup(ctx int64, groupName, newGroupName string) (err error) {
+	return this.renameGroup(ctx, GroupTarget, groupName, newGroupName)
+}
+
+// RenameTargetGroupWithId 将授权对象组 groupId 的名称修改为 newGroupName
+func (this *Service) RenameTargetGroupWithId(ctx, groupId int64, newGroupName string) (err error) {
+	return this.renameGroupWithId(ctx, GroupTarget, groupId, newGroupName)
+}
+
+// DeleteTargetGroup 根据 groupName 删除授权对象组，同时取消授予给组的所有角色并移除组内所有成员
+func (this *Service) DeleteTargetGroup(ctx int64, groupName string) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	group, err := nRepo.GetGroupWithName(ctx, GroupTarget, groupName)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if result != nil {
-		if result.PermissionList, err = this.repo.GetPermissionsWithRoleId(ctx, result.Id); err != nil {
-			return nil, err
-		}
-		if result.MutexRoleList, err = this.repo.GetMutexRoles(ctx, result.Id); err != nil {
-			return nil, err
+	if group == nil {
+		return ErrGroupNotExist
+	}
+
+	targets, err := this.deleteTargetGroup(ctx, nRepo, group)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// DeleteTargetGroupWithId 根据 groupId 删除授权对象组，同时取消授予给组的所有角色并移除组内所有成员
+func (this *Service) DeleteTargetGroupWithId(ctx, groupId int64) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	group, err := nRepo.GetGroupWithId(ctx, GroupTarget, groupId)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return ErrGroupNotExist
+	}
+
+	targets, err := this.deleteTargetGroup(ctx, nRepo, group)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// deleteTargetGroup 删除授权对象组，返回受影响的 target 列表，包括组内所有的成员及因组内成员失去角色而被取消委托的 target
+func (this *Service) deleteTargetGroup(ctx int64, nRepo Repository, group *Group) (result []string, err error) {
+	var target = TargetOfGroup(group.Id)
+	if err = nRepo.RevokeAllRole(ctx, target); err != nil {
+		return nil, err
+	}
+	if result, err = this.cleanDelegations(ctx, nRepo, target); err != nil {
+		return nil, err
+	}
+
+	// 移除成员之后无法再查询到受影响的 target，需要先查询出组内所有的成员
+	memberList, err := nRepo.GetGroupMembers(ctx, group.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range memberList {
+		result = append(result, member.Target)
+	}
+	if err = nRepo.CleanGroupMembers(ctx, group.Id); err != nil {
+		return nil, err
+	}
+	if err = nRepo.DeleteGroup(ctx, GroupTarget, group.Id); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetGroupMembers 获取授权对象组 groupName 的成员列表
+func (this *Service) GetGroupMembers(ctx int64, groupName string) (result []*GroupMember, err error) {
+	group, err := this.repo.GetGroupWithName(ctx, GroupTarget, groupName)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, ErrGroupNotExist
+	}
+	return this.repo.GetGroupMembers(ctx, group.Id)
+}
+
+// GetGroupMembersWithId 获取授权对象组 groupId 的成员列表
+func (this *Service) GetGroupMembersWithId(ctx, groupId int64) (result []*GroupMember, err error) {
+	return this.repo.GetGroupMembers(ctx, groupId)
+}
+
+// AddGroupMembers 将 target 列表添加到授权对象组 groupName 中，target 将拥有授予给该组的所有角色
+//
+// 添加成员时会将成员已拥有的角色与组的角色一起验证互斥关系、角色先决条件及数量限制，任意成员验证失败时不会添加任何成员
+func (this *Service) AddGroupMembers(ctx int64, groupName string, targets ...string) (err error) {
+	group, err := this.repo.GetGroupWithName(ctx, GroupTarget, groupName)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return ErrGroupNotExist
+	}
+	return this.addGroupMembers(ctx, group.Id, targets)
+}
+
+// AddGroupMembersWithId 将 target 列表添加到授权对象组 groupId 中，target 将拥有授予给该组的所有角色
+//
+// 添加成员时会将成员已拥有的角色与组的角色一起验证互斥关系、角色先决条件及数量限制，任意成员验证失败时不会添加任何成员
+func (this *Service) AddGroupMembersWithId(ctx, groupId int64, targets ...string) (err error) {
+	group, err := this.repo.GetGroupWithId(ctx, GroupTarget, groupId)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return ErrGroupNotExist
+	}
+	return this.addGroupMembers(ctx, group.Id, targets)
+}
+
+func (this *Service) addGroupMembers(ctx, groupId int64, targets []string) (err error) {
+	if len(targets) == 0 {
+		return ErrTargetNotAllowed
+	}
+	for _, target := range targets {
+		if target == "" || strings.HasPrefix(target, TargetGroupPrefix) {
+			return ErrTargetNotAllowed
+		}
+	}
+
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	groupRoleIds, groupActiveIds, err := this.getHeldRoleIds(ctx, nRepo, TargetOfGroup(groupId))
+	if err != nil {
+		return err
+	}
+	if len(groupRoleIds) > 0 {
+		for _, target := range targets {
+			if err = this.checkGroupMember(ctx, nRepo, target, groupRoleIds, groupActiveIds); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = nRepo.AddGroupMembers(ctx, groupId, targets); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// checkGroupMember 验证 target 加入授权对象组之后，target 已拥有的角色与组的角色 groupRoleIds 是否满足互斥关系、角色先决条件及数量限制
+//
+// 参数 groupActiveIds 为组的角色中已经生效的角色 id 列表
+func (this *Service) checkGroupMember(ctx int64, nRepo Repository, target string, groupRoleIds, groupActiveIds []int64) (err error) {
+	gIds, aIds, err := this.getHeldRoleIds(ctx, nRepo, target)
+	if err != nil {
+		return err
+	}
+	var gIdm = make(map[int64]struct{}, len(gIds))
+	for _, id := range gIds {
+		gIdm[id] = struct{}{}
+	}
+	var nIds = make([]int64, 0, len(groupRoleIds)) // target 通过组新获得的角色 id 列表
+	for _, id := range groupRoleIds {
+		if _, ok := gIdm[id]; ok {
+			continue
+		}
+		gIds = append(gIds, id)
+		nIds = append(nIds, id)
+	}
+	if len(nIds) == 0 {
+		return nil
+	}
+	aIds = append(aIds, groupActiveIds...)
+
+	if err = this.checkRoleConstraints(ctx, nRepo, gIds, aIds); err != nil {
+		return err
+	}
+	return this.checkCardinality(ctx, nRepo, target, nIds)
+}
+
+// RemoveGroupMembers 将 target 列表从授权对象组 groupName 中移除
+func (this *Service) RemoveGroupMembers(ctx int64, groupName string, targets ...string) (err error) {
+	group, err := this.repo.GetGroupWithName(ctx, GroupTarget, groupName)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return ErrGroupNotExist
+	}
+	return this.removeGroupMembers(ctx, group.Id, targets)
+}
+
+// RemoveGroupMembersWithId 将 target 列表从授权对象组 groupId 中移除
+func (this *Service) RemoveGroupMembersWithId(ctx, groupId int64, targets ...string) (err error) {
+	return this.removeGroupMembers(ctx, groupId, targets)
+}
+
+func (this *Service) removeGroupMembers(ctx, groupId int64, targets []string) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = nRepo.RemoveGroupMembers(ctx, groupId, targets); err != nil {
+		return err
+	}
+
+	// 成员通过组获得的角色委托出去之后，离开组时需要取消这些委托
+	dTargets, err := this.cleanDelegations(ctx, nRepo, targets...)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	this.cleanCaches(ctx, dTargets)
+	return nil
+}
+
+// GrantRoleToGroup 授权角色给授权对象组 groupName，组内所有成员都将拥有该角色
+//
+// 授权时只验证组已拥有的角色之间的互斥关系及先决条件，不会验证组内成员直接拥有的角色
+func (this *Service) GrantRoleToGroup(ctx int64, groupName string, roleNames ...string) (err error) {
+	group, err := this.repo.GetGroupWithName(ctx, GroupTarget, groupName)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return ErrGroupNotExist
+	}
+	return this.GrantRole(ctx, TargetOfGroup(group.Id), roleNames...)
+}
+
+// GrantRoleToGroupWithId 授权角色给授权对象组 groupId，组内所有成员都将拥有该角色
+func (this *Service) GrantRoleToGroupWithId(ctx, groupId int64, roleIds ...int64) (err error) {
+	group, err := this.repo.GetGroupWithId(ctx, GroupTarget, groupId)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return ErrGroupNotExist
+	}
+	return this.GrantRoleWithId(ctx, TargetOfGroup(group.Id), roleIds...)
+}
+
+// RevokeRoleFromGroup 取消对授权对象组 groupName 的角色授权
+func (this *Service) RevokeRoleFromGroup(ctx int64, groupName string, roleNames ...string) (err error) {
+	group, err := this.repo.GetGroupWithName(ctx, GroupTarget, groupName)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return ErrGroupNotExist
+	}
+	return this.RevokeRole(ctx, TargetOfGroup(group.Id), roleNames...)
+}
+
+// RevokeRoleFromGroupWithId 取消对授权对象组 groupId 的角色授权
+func (this *Service) RevokeRoleFromGroupWithId(ctx, groupId int64, roleIds ...int64) (err error) {
+	return this.RevokeRoleWithId(ctx, TargetOfGroup(groupId), roleIds...)
+}
+
+// GetGroupRoles 获取已授权给授权对象组 groupName 的角色列表
+func (this *Service) GetGroupRoles(ctx int64, groupName string) (result []*Role, err error) {
+	group, err := this.repo.GetGroupWithName(ctx, GroupTarget, groupName)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, ErrGroupNotExist
+	}
+	return this.repo.GetGrantedRoles(ctx, TargetOfGroup(group.Id), false)
+}
+
+// GetRoles 获取角色列表
+//
+// 如果参数 isGrantedToTarget 的值不为空字符串，则返回的角色数据中将包含该角色（通过 Granted 判断）是否已授权给 isGrantedToTarget
+//
+// 如果参数 limitedInTarget 的值不为空字符串， 则返回的角色数据将限定在 limitedInTarget 已拥有的角色及其子角色范围内
+//
+// 返回的角色数据的 Granted 字段参照的是 isGrantedToTarget
+//
+// 返回的角色数据的 Accessible 字段参照的是 limitedInTarget
+func (this *Service) GetRoles(ctx int64, status Status, keywords, isGrantedToTarget, limitedInTarget string) (result []*Role, err error) {
+	if limitedInTarget == "" {
+		return this.repo.GetRoles(ctx, -1, status, keywords, isGrantedToTarget)
+	}
+	return this.repo.GetRolesInTarget(ctx, limitedInTarget, status, keywords, isGrantedToTarget)
+}
+
+// GetRolesInPreOrder 与 GetRoles 相同，返回的角色列表按照角色树的先序遍历顺序（即 left_value）排序，可以直接用于展示角色的层级结构
+func (this *Service) GetRolesInPreOrder(ctx int64, status Status, keywords, isGrantedToTarget, limitedInTarget string) (result []*Role, err error) {
+	if result, err = this.GetRoles(ctx, status, keywords, isGrantedToTarget, limitedInTarget); err != nil {
+		return nil, err
+	}
+	sortRolesInPreOrder(result)
+	return result, nil
+}
+
+// GetRolesWithParent 获取角色列表
+//
+// 如果参数 isGrantedToTarget 的值不为空字符串，则返回的角色数据中将包含该角色（通过 Granted 判断）是否已授权给 isGrantedToTarget
+func (this *Service) GetRolesWithParent(ctx int64, parentRoleName string, status Status, keywords, isGrantedToTarget string) (result []*Role, err error) {
+	var parentRoleId int64 = 0
+	if parentRoleName != "" {
+		// 验证 parentRoleName 是否存在
+		role, err := this.repo.GetRoleWithName(ctx, parentRoleName)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return nil, ErrRoleNotExist
+		}
+		parentRoleId = role.Id
+	}
+	return this.repo.GetRoles(ctx, parentRoleId, status, keywords, isGrantedToTarget)
+}
+
+// GetRolesWithParentId 获取角色列表
+//
+// 如果参数 isGrantedToTarget 的值不为空字符串，则返回的角色数据中将包含该角色（通过 Granted 判断）是否已授权给 isGrantedToTarget
+func (this *Service) GetRolesWithParentId(ctx, parentRoleId int64, status Status, keywords, isGrantedToTarget string) (result []*Role, err error) {
+	if parentRoleId < 0 {
+		parentRoleId = 0
+	}
+	if parentRoleId > 0 {
+		// 验证 parentRoleId 是否存在
+		role, err := this.repo.GetRoleWithId(ctx, parentRoleId)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return nil, ErrRoleNotExist
+		}
+		parentRoleId = role.Id
+	}
+	return this.repo.GetRoles(ctx, parentRoleId, status, keywords, isGrantedToTarget)
+}
+
+// GetRole 根据 roleName 获取角色信息
+func (this *Service) GetRole(ctx int64, name string) (result *Role, err error) {
+	result, err = this.repo.GetRoleWithName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if result != nil {
+		if result.PermissionList, err = this.repo.GetPermissionsWithRoleId(ctx, result.Id); err != nil {
+			return nil, err
+		}
+		if result.MutexRoleList, err = this.repo.GetMutexRoles(ctx, result.Id); err != nil {
+			return nil, err
 		}
 		if result.PreRoleList, err = this.repo.GetPreRoles(ctx, result.Id); err != nil {
 			return nil, err
 		}
 	}
-	return result, nil
+	return result, nil
+}
+
+// GetRoleWithId 根据 roleId 获取角色信息
+func (this *Service) GetRoleWithId(ctx, roleId int64) (result *Role, err error) {
+	result, err = this.repo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return nil, err
+	}
+	if result != nil {
+		if result.PermissionList, err = this.repo.GetPermissionsWithRoleId(ctx, result.Id); err != nil {
+			return nil, err
+		}
+		if result.MutexRoleList, err = this.repo.GetMutexRoles(ctx, result.Id); err != nil {
+			return nil, err
+		}
+		if result.PreRoleList, err = this.repo.GetPreRoles(ctx, result.Id); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// AddRole 添加角色
+func (this *Service) AddRole(ctx int64, roleName, aliasName, description string, status Status) (result int64, err error) {
+	return this.AddRoleWithParentId(ctx, 0, roleName, aliasName, description, status)
+}
+
+// AddRoleWithParent 添加角色，新添加的角色将作为 parentRoleName 的子角色
+//
+// 调用时应该确认操作者是否有访问 parentRoleName 的权限，即 parentRoleName 是否为当前操作者拥有的角色及其子角色
+func (this *Service) AddRoleWithParent(ctx int64, parentRoleName, roleName, aliasName, description string, status Status) (result int64, err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var parentRole *Role
+	if parentRoleName != "" {
+		// 验证 parentRoleName 是否存在
+		parentRole, err = nRepo.GetRoleWithName(ctx, parentRoleName)
+		if err != nil {
+			return 0, err
+		}
+		if parentRole == nil {
+			return 0, ErrParentRoleNotExist
+		}
+	}
+
+	// 验证 name 是否已经存在
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return 0, err
+	}
+	if role != nil {
+		return 0, ErrRoleNameExists
+	}
+
+	if result, err = nRepo.AddRole(ctx, parentRole, roleName, aliasName, description, status); err != nil {
+		return 0, err
+	}
+
+	tx.Commit()
+	return result, nil
+}
+
+// AddRoleWithParentId 添加角色，新添加的角色将作为 parentRoleId 的子角色
+//
+// 调用时应该确认操作者是否有访问 parentRoleId 的权限，即 parentRoleId 是否为当前操作者拥有的角色及其子角色
+func (this *Service) AddRoleWithParentId(ctx, parentRoleId int64, roleName, aliasName, description string, status Status) (result int64, err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if parentRoleId < 0 {
+		return 0, ErrParentRoleNotExist
+	}
+
+	var parentRole *Role
+	if parentRoleId > 0 {
+		// 验证 parentRoleName 是否存在
+		parentRole, err = nRepo.GetRoleWithId(ctx, parentRoleId)
+		if err != nil {
+			return 0, err
+		}
+		if parentRole == nil {
+			return 0, ErrParentRoleNotExist
+		}
+	}
+
+	// 验证 name 是否已经存在
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return 0, err
+	}
+	if role != nil {
+		return 0, ErrRoleNameExists
+	}
+
+	if result, err = nRepo.AddRole(ctx, parentRole, roleName, aliasName, description, status); err != nil {
+		return 0, err
+	}
+
+	tx.Commit()
+	return result, nil
+}
+
+// AddRoleBefore 添加角色，新添加的角色将与 siblingRoleName 拥有相同的父角色，并且位于 siblingRoleName 之前
+//
+// 调用时应该确认操作者是否有访问 siblingRoleName 父角色的权限
+func (this *Service) AddRoleBefore(ctx int64, siblingRoleName, roleName, aliasName, description string, status Status) (result int64, err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	sibling, err := nRepo.GetRoleWithName(ctx, siblingRoleName)
+	if err != nil {
+		return 0, err
+	}
+	if result, err = this.addRoleNextTo(ctx, nRepo, sibling, true, roleName, aliasName, description, status); err != nil {
+		return 0, err
+	}
+
+	tx.Commit()
+	return result, nil
+}
+
+// AddRoleBeforeWithId 添加角色，新添加的角色将与 siblingRoleId 拥有相同的父角色，并且位于 siblingRoleId 之前
+//
+// 调用时应该确认操作者是否有访问 siblingRoleId 父角色的权限
+func (this *Service) AddRoleBeforeWithId(ctx, siblingRoleId int64, roleName, aliasName, description string, status Status) (result int64, err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	sibling, err := nRepo.GetRoleWithId(ctx, siblingRoleId)
+	if err != nil {
+		return 0, err
+	}
+	if result, err = this.addRoleNextTo(ctx, nRepo, sibling, true, roleName, aliasName, description, status); err != nil {
+		return 0, err
+	}
+
+	tx.Commit()
+	return result, nil
+}
+
+// AddRoleAfter 添加角色，新添加的角色将与 siblingRoleName 拥有相同的父角色，并且位于 siblingRoleName 之后
+//
+// 调用时应该确认操作者是否有访问 siblingRoleName 父角色的权限
+func (this *Service) AddRoleAfter(ctx int64, siblingRoleName, roleName, aliasName, description string, status Status) (result int64, err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	sibling, err := nRepo.GetRoleWithName(ctx, siblingRoleName)
+	if err != nil {
+		return 0, err
+	}
+	if result, err = this.addRoleNextTo(ctx, nRepo, sibling, false, roleName, aliasName, description, status); err != nil {
+		return 0, err
+	}
+
+	tx.Commit()
+	return result, nil
+}
+
+// AddRoleAfterWithId 添加角色，新添加的角色将与 siblingRoleId 拥有相同的父角色，并且位于 siblingRoleId 之后
+//
+// 调用时应该确认操作者是否有访问 siblingRoleId 父角色的权限
+func (this *Service) AddRoleAfterWithId(ctx, siblingRoleId int64, roleName, aliasName, description string, status Status) (result int64, err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	sibling, err := nRepo.GetRoleWithId(ctx, siblingRoleId)
+	if err != nil {
+		return 0, err
+	}
+	if result, err = this.addRoleNextTo(ctx, nRepo, sibling, false, roleName, aliasName, description, status); err != nil {
+		return 0, err
+	}
+
+	tx.Commit()
+	return result, nil
+}
+
+func (this *Service) addRoleNextTo(ctx int64, nRepo Repository, sibling *Role, before bool, roleName, aliasName, description string, status Status) (result int64, err error) {
+	if sibling == nil {
+		return 0, ErrSiblingRoleNotExist
+	}
+
+	// 验证 name 是否已经存在
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return 0, err
+	}
+	if role != nil {
+		return 0, ErrRoleNameExists
+	}
+
+	if before {
+		return nRepo.AddRoleBefore(ctx, sibling, roleName, aliasName, description, status)
+	}
+	return nRepo.AddRoleAfter(ctx, sibling, roleName, aliasName, description, status)
+}
+
+// UpdateRole 根据 roleName 更新角色信息
+func (this *Service) UpdateRole(ctx int64, roleName, aliasName, description string, status Status) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+
+	if err = nRepo.UpdateRole(ctx, role.Id, aliasName, description, status); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// UpdateRoleWithId 根据 roleId 更新角色信息
+func (this *Service) UpdateRoleWithId(ctx, roleId int64, aliasName, description string, status Status) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+
+	if err = nRepo.UpdateRole(ctx, roleId, aliasName, description, status); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// SetRoleMaxTargets 设置角色 roleName 最多可以授予给多少个 target，为 0 表示不限制
+//
+// 新的限制只对之后的授权生效，已有的授权不会被取消
+func (this *Service) SetRoleMaxTargets(ctx int64, roleName string, maxTargets int) (err error) {
+	if maxTargets < 0 {
+		return ErrInvalidLimit
+	}
+	role, err := this.repo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+	return this.repo.UpdateRoleMaxTargets(ctx, role.Id, maxTargets)
+}
+
+// SetRoleMaxTargetsWithId 设置角色 roleId 最多可以授予给多少个 target，为 0 表示不限制
+//
+// 新的限制只对之后的授权生效，已有的授权不会被取消
+func (this *Service) SetRoleMaxTargetsWithId(ctx, roleId int64, maxTargets int) (err error) {
+	if maxTargets < 0 {
+		return ErrInvalidLimit
+	}
+	role, err := this.repo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+	return this.repo.UpdateRoleMaxTargets(ctx, role.Id, maxTargets)
+}
+
+// GetMaxRolesPerTarget 获取每个 target 最多可以拥有的角色数量，为 0 表示不限制
+func (this *Service) GetMaxRolesPerTarget(ctx int64) (result int, err error) {
+	return this.repo.GetMaxRolesPerTarget(ctx)
+}
+
+// SetMaxRolesPerTarget 设置每个 target 最多可以拥有的角色数量，为 0 表示不限制
+//
+// 新的限制只对之后的授权生效，已有的授权不会被取消
+func (this *Service) SetMaxRolesPerTarget(ctx int64, maxRoles int) (err error) {
+	if maxRoles < 0 {
+		return ErrInvalidLimit
+	}
+	return this.repo.SetMaxRolesPerTarget(ctx, maxRoles)
+}
+
+// UpdateRoleStatus 根据 roleName 更新角色的状态
+func (this *Service) UpdateRoleStatus(ctx int64, roleName string, status Status) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+
+	if err = nRepo.UpdateRoleStatus(ctx, role.Id, status); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// UpdateRoleStatusWithId 根据 roleId 更新角色的状态
+func (this *Service) UpdateRoleStatusWithId(ctx, roleId int64, status Status) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+
+	if err = nRepo.UpdateRoleStatus(ctx, role.Id, status); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// RenameRole 将角色 roleName 的名称修改为 newRoleName
+func (this *Service) RenameRole(ctx int64, roleName, newRoleName string) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+
+	if err = this.updateRoleName(ctx, nRepo, role, newRoleName); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// RenameRoleWithId 将角色 roleId 的名称修改为 newRoleName
+func (this *Service) RenameRoleWithId(ctx, roleId int64, newRoleName string) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+
+	if err = this.updateRoleName(ctx, nRepo, role, newRoleName); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+func (this *Service) updateRoleName(ctx int64, nRepo Repository, role *Role, newRoleName string) (err error) {
+	// 验证 newRoleName 是否已经存在
+	nRole, err := nRepo.GetRoleWithName(ctx, newRoleName)
+	if err != nil {
+		return err
+	}
+	if nRole != nil {
+		if nRole.Id == role.Id {
+			return nil
+		}
+		return ErrRoleNameExists
+	}
+	return nRepo.UpdateRoleName(ctx, role.Id, newRoleName)
+}
+
+// MoveRole 将角色 roleName 及其子角色移动到 parentRoleName 下，如果参数 parentRoleName 的值为空字符串，则移动为顶级角色
+//
+// 不能将角色移动到其自身或者其子角色下，移动之后该角色拥有的权限需要在新的父角色的权限范围之内
+//
+// 调用时应该确认操作者是否有访问 roleName 及 parentRoleName 的权限
+func (this *Service) MoveRole(ctx int64, roleName, parentRoleName string) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+
+	var parentRole *Role
+	if parentRoleName != "" {
+		// 验证 parentRoleName 是否存在
+		parentRole, err = nRepo.GetRoleWithName(ctx, parentRoleName)
+		if err != nil {
+			return err
+		}
+		if parentRole == nil {
+			return ErrParentRoleNotExist
+		}
+	}
+
+	if err = this.checkMoveRole(ctx, nRepo, role, parentRole); err != nil {
+		return err
+	}
+
+	targets, err := this.moveRole(ctx, nRepo, role, parentRole)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// MoveRoleWithId 将角色 roleId 及其子角色移动到 parentRoleId 下，如果参数 parentRoleId 的值为 0，则移动为顶级角色
+//
+// 不能将角色移动到其自身或者其子角色下，移动之后该角色拥有的权限需要在新的父角色的权限范围之内
+//
+// 调用时应该确认操作者是否有访问 roleId 及 parentRoleId 的权限
+func (this *Service) MoveRoleWithId(ctx, roleId, parentRoleId int64) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if parentRoleId < 0 {
+		return ErrParentRoleNotExist
+	}
+
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+
+	var parentRole *Role
+	if parentRoleId > 0 {
+		// 验证 parentRoleId 是否存在
+		parentRole, err = nRepo.GetRoleWithId(ctx, parentRoleId)
+		if err != nil {
+			return err
+		}
+		if parentRole == nil {
+			return ErrParentRoleNotExist
+		}
+	}
+
+	if err = this.checkMoveRole(ctx, nRepo, role, parentRole); err != nil {
+		return err
+	}
+
+	targets, err := this.moveRole(ctx, nRepo, role, parentRole)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// MoveRoleBefore 将角色 roleName 及其子角色移动到 siblingRoleName 之前，移动之后将与 siblingRoleName 拥有相同的父角色
+//
+// 调用时应该确认操作者是否有访问 roleName 及 siblingRoleName 的权限
+func (this *Service) MoveRoleBefore(ctx int64, roleName, siblingRoleName string) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	sibling, err := nRepo.GetRoleWithName(ctx, siblingRoleName)
+	if err != nil {
+		return err
+	}
+	targets, err := this.moveRoleNextTo(ctx, nRepo, role, sibling, true)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// MoveRoleBeforeWithId 将角色 roleId 及其子角色移动到 siblingRoleId 之前，移动之后将与 siblingRoleId 拥有相同的父角色
+//
+// 调用时应该确认操作者是否有访问 roleId 及 siblingRoleId 的权限
+func (this *Service) MoveRoleBeforeWithId(ctx, roleId, siblingRoleId int64) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return err
+	}
+	sibling, err := nRepo.GetRoleWithId(ctx, siblingRoleId)
+	if err != nil {
+		return err
+	}
+	targets, err := this.moveRoleNextTo(ctx, nRepo, role, sibling, true)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// MoveRoleAfter 将角色 roleName 及其子角色移动到 siblingRoleName 之后，移动之后将与 siblingRoleName 拥有相同的父角色
+//
+// 调用时应该确认操作者是否有访问 roleName 及 siblingRoleName 的权限
+func (this *Service) MoveRoleAfter(ctx int64, roleName, siblingRoleName string) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	sibling, err := nRepo.GetRoleWithName(ctx, siblingRoleName)
+	if err != nil {
+		return err
+	}
+	targets, err := this.moveRoleNextTo(ctx, nRepo, role, sibling, false)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// MoveRoleAfterWithId 将角色 roleId 及其子角色移动到 siblingRoleId 之后，移动之后将与 siblingRoleId 拥有相同的父角色
+//
+// 调用时应该确认操作者是否有访问 roleId 及 siblingRoleId 的权限
+func (this *Service) MoveRoleAfterWithId(ctx, roleId, siblingRoleId int64) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return err
+	}
+	sibling, err := nRepo.GetRoleWithId(ctx, siblingRoleId)
+	if err != nil {
+		return err
+	}
+	targets, err := this.moveRoleNextTo(ctx, nRepo, role, sibling, false)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+func (this *Service) moveRoleNextTo(ctx int64, nRepo Repository, role, sibling *Role, before bool) (result []string, err error) {
+	if role == nil {
+		return nil, ErrRoleNotExist
+	}
+	if sibling == nil {
+		return nil, ErrSiblingRoleNotExist
+	}
+
+	// 不能移动到其自身或者其子角色的旁边
+	if sibling.LeftValue >= role.LeftValue && sibling.RightValue <= role.RightValue {
+		return nil, ErrInvalidSiblingRole
+	}
+
+	// 如果父角色发生了变化，需要验证新的父角色
+	if sibling.ParentId != role.ParentId {
+		var parentRole *Role
+		if sibling.ParentId > 0 {
+			if parentRole, err = nRepo.GetRoleWithId(ctx, sibling.ParentId); err != nil {
+				return nil, err
+			}
+			if parentRole == nil {
+				return nil, ErrParentRoleNotExist
+			}
+		}
+		if err = this.checkMoveRole(ctx, nRepo, role, parentRole); err != nil {
+			return nil, err
+		}
+	}
+
+	if result, err = this.getMoveRoleTargets(ctx, nRepo, role); err != nil {
+		return nil, err
+	}
+	if before {
+		err = nRepo.MoveRoleBefore(ctx, role, sibling)
+	} else {
+		err = nRepo.MoveRoleAfter(ctx, role, sibling)
+	}
+	if err != nil {
+		return nil, err
+	}
+	targets, err := this.getMoveRoleTargets(ctx, nRepo, role)
+	if err != nil {
+		return nil, err
+	}
+	return append(result, targets...), nil
+}
+
+// moveRole 将角色 role 及其子角色移动到 parent 下，返回受影响的 target 列表
+func (this *Service) moveRole(ctx int64, nRepo Repository, role, parent *Role) (result []string, err error) {
+	if result, err = this.getMoveRoleTargets(ctx, nRepo, role); err != nil {
+		return nil, err
+	}
+	if err = nRepo.MoveRole(ctx, role, parent); err != nil {
+		return nil, err
+	}
+	targets, err := this.getMoveRoleTargets(ctx, nRepo, role)
+	if err != nil {
+		return nil, err
+	}
+	return append(result, targets...), nil
+}
+
+// getMoveRoleTargets 启用权限继承时，角色在角色树中的位置会影响 target 通过继承关系拥有的权限，移动角色前后分别调用以获取受影响的 target 列表
+func (this *Service) getMoveRoleTargets(ctx int64, nRepo Repository, role *Role) (result []string, err error) {
+	if nRepo.InheritMode() == InheritNone {
+		return nil, nil
+	}
+	return this.getRoleTreeTargets(ctx, nRepo, role)
+}
+
+// checkMoveRole 验证角色 role 是否能够移动到 parent 下
+func (this *Service) checkMoveRole(ctx int64, nRepo Repository, role, parent *Role) (err error) {
+	if parent == nil {
+		return nil
+	}
+
+	// 不能移动到其自身或者其子角色下
+	if parent.LeftValue >= role.LeftValue && parent.RightValue <= role.RightValue {
+		return ErrInvalidParentRole
+	}
+
+	if parent.Status != Enable {
+		return ErrInvalidParentRole
+	}
+
+	// 验证该角色的权限是否超出新的父角色的权限
+	parentPermissions, err := nRepo.GetPermissionsWithRoleId(ctx, parent.Id)
+	if err != nil {
+		return err
+	}
+	var permissionMap = make(map[int64]struct{})
+	for _, p := range parentPermissions {
+		permissionMap[p.Id] = struct{}{}
+	}
+
+	rolePermissions, err := nRepo.GetPermissionsWithRoleId(ctx, role.Id)
+	if err != nil {
+		return err
+	}
+	var outNames = make([]string, 0, len(rolePermissions))
+	for _, p := range rolePermissions {
+		if _, ok := permissionMap[p.Id]; ok == false {
+			outNames = append(outNames, p.AliasName)
+		}
+	}
+	if len(outNames) > 0 {
+		return newPermissionOutOfParentError(role, parent, outNames)
+	}
+	return nil
+}
+
+// checkPermissionOutOfParent 验证 permissionIds 是否都在父角色的权限 permissionMap 范围之内
+func (this *Service) checkPermissionOutOfParent(ctx int64, nRepo Repository, role, parent *Role, permissionMap map[int64]struct{}, permissionIds []int64) error {
+	var outIds []int64
+	for _, pId := range permissionIds {
+		if _, ok := permissionMap[pId]; ok == false {
+			outIds = append(outIds, pId)
+		}
+	}
+	if len(outIds) == 0 {
+		return nil
+	}
+	outPermissions, err := nRepo.GetPermissionsWithIds(ctx, outIds...)
+	if err != nil {
+		return err
+	}
+	return newPermissionOutOfParentError(role, parent, permissionAliasNames(outPermissions))
+}
+
+func permissionAliasNames(permissions []*Permission) []string {
+	var names = make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		names = append(names, p.AliasName)
+	}
+	return names
+}
+
+// DeleteRole 根据 roleName 删除角色
+//
+// 如果参数 withChildren 的值为 true，则会同时删除该角色的所有子角色，否则该角色的子角色将挂载到该角色的父角色下
+//
+// 删除角色时会同时清除与之相关的授权、权限、互斥关系及先决条件
+func (this *Service) DeleteRole(ctx int64, roleName string, withChildren bool) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+
+	targets, err := this.deleteRole(ctx, nRepo, role, withChildren)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// DeleteRoleWithId 根据 roleId 删除角色
+//
+// 如果参数 withChildren 的值为 true，则会同时删除该角色的所有子角色，否则该角色的子角色将挂载到该角色的父角色下
+//
+// 删除角色时会同时清除与之相关的授权、权限、互斥关系及先决条件
+func (this *Service) DeleteRoleWithId(ctx, roleId int64, withChildren bool) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+
+	targets, err := this.deleteRole(ctx, nRepo, role, withChildren)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.cleanCaches(ctx, targets)
+	return nil
+}
+
+// deleteRole 删除角色，返回受影响的 target 列表
+func (this *Service) deleteRole(ctx int64, nRepo Repository, role *Role, withChildren bool) (result []string, err error) {
+	// 删除之后无法再查询到受影响的 target，需要先查询出来
+	if result, err = this.getRoleTreeTargets(ctx, nRepo, role); err != nil {
+		return nil, err
+	}
+	if err = nRepo.DeleteRole(ctx, role, withChildren); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// getRoleTreeTargets 获取拥有角色 role 及其子角色的 target 列表，启用权限继承时包括通过继承关系拥有这些角色的权限的 target
+func (this *Service) getRoleTreeTargets(ctx int64, nRepo Repository, role *Role) (result []string, err error) {
+	children, err := nRepo.GetRoles(ctx, role.Id, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	var roleIds = make([]int64, 0, len(children)+1)
+	roleIds = append(roleIds, role.Id)
+	for _, child := range children {
+		roleIds = append(roleIds, child.Id)
+	}
+	return nRepo.GetTargetsWithRoleIds(ctx, roleIds)
+}
+
+// GrantRole 授权角色给 target
+func (this *Service) GrantRole(ctx int64, target string, roleNames ...string) (err error) {
+	_, err = this.grantRoleWithNames(ctx, target, false, nil, nil, roleNames...)
+	return err
+}
+
+// GrantRoleWithId 授权角色给 target
+func (this *Service) GrantRoleWithId(ctx int64, target string, roleIds ...int64) (err error) {
+	_, err = this.grantRoleWithIds(ctx, target, false, nil, nil, roleIds...)
+	return err
+}
+
+// GrantRoleUntil 授权角色给 target，授权在 expiresAt 之后失效
+//
+// 如果角色已经授予给 target，则会更新该授权的有效期
+func (this *Service) GrantRoleUntil(ctx int64, target string, expiresAt time.Time, roleNames ...string) (err error) {
+	_, err = this.grantRoleWithNames(ctx, target, false, nil, &expiresAt, roleNames...)
+	return err
+}
+
+// GrantRoleUntilWithId 授权角色给 target，授权在 expiresAt 之后失效
+//
+// 如果角色已经授予给 target，则会更新该授权的有效期
+func (this *Service) GrantRoleUntilWithId(ctx int64, target string, expiresAt time.Time, roleIds ...int64) (err error) {
+	_, err = this.grantRoleWithIds(ctx, target, false, nil, &expiresAt, roleIds...)
+	return err
+}
+
+// GrantRoleBetween 授权角色给 target，授权只在 notBefore 与 expiresAt 之间有效
+//
+// 如果角色已经授予给 target，则会更新该授权的有效期
+func (this *Service) GrantRoleBetween(ctx int64, target string, notBefore, expiresAt time.Time, roleNames ...string) (err error) {
+	_, err = this.grantRoleWithNames(ctx, target, false, &notBefore, &expiresAt, roleNames...)
+	return err
+}
+
+// GrantRoleBetweenWithId 授权角色给 target，授权只在 notBefore 与 expiresAt 之间有效
+//
+// 如果角色已经授予给 target，则会更新该授权的有效期
+func (this *Service) GrantRoleBetweenWithId(ctx int64, target string, notBefore, expiresAt time.Time, roleIds ...int64) (err error) {
+	_, err = this.grantRoleWithIds(ctx, target, false, &notBefore, &expiresAt, roleIds...)
+	return err
+}
+
+// PurgeExpiredGrants 删除已经过期的授权信息
+//
+// 过期的授权不会影响权限验证的结果，此方法只用于清理数据，可以由外部定期调用
+func (this *Service) PurgeExpiredGrants(ctx int64) (err error) {
+	return this.repo.CleanExpiredGrants(ctx)
+}
+
+// AutoGrantRole 授权角色给 target，如果 target 还未拥有角色所需要的先决角色，则会一并授予先决角色（包括先决角色的先决角色）
+//
+// 所有角色（包括自动授予的先决角色）在同一个事务中授予，并且需要满足角色之间的互斥关系，返回值 result 为本次授予给 target 的所有角色
+func (this *Service) AutoGrantRole(ctx int64, target string, roleNames ...string) (result []*Role, err error) {
+	return this.grantRoleWithNames(ctx, target, true, nil, nil, roleNames...)
+}
+
+// AutoGrantRoleWithId 授权角色给 target，如果 target 还未拥有角色所需要的先决角色，则会一并授予先决角色（包括先决角色的先决角色）
+//
+// 所有角色（包括自动授予的先决角色）在同一个事务中授予，并且需要满足角色之间的互斥关系，返回值 result 为本次授予给 target 的所有角色
+func (this *Service) AutoGrantRoleWithId(ctx int64, target string, roleIds ...int64) (result []*Role, err error) {
+	return this.grantRoleWithIds(ctx, target, true, nil, nil, roleIds...)
+}
+
+func (this *Service) grantRoleWithNames(ctx int64, target string, autoGrant bool, notBefore, expiresAt *time.Time, roleNames ...string) (result []*Role, err error) {
+	if len(roleNames) == 0 {
+		return nil, ErrRoleNotExist
+	}
+
+	if target == "" {
+		return nil, ErrTargetNotAllowed
+	}
+
+	if err = checkGrantPeriod(notBefore, expiresAt); err != nil {
+		return nil, err
+	}
+
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	roleList, err := nRepo.GetRolesWithNames(ctx, roleNames...)
+	if err != nil {
+		return nil, err
+	}
+
+	if result, err = this.grantRole(ctx, nRepo, target, roleList, autoGrant, notBefore, expiresAt); err != nil {
+		return nil, err
+	}
+
+	// 直接授权会取代委托，委托人失去角色时不再取消该授权
+	if err = this.removeDelegations(ctx, nRepo, target, result, notBefore == nil && expiresAt == nil); err != nil {
+		return nil, err
+	}
+
+	tx.Commit()
+	return result, nil
+}
+
+func (this *Service) grantRoleWithIds(ctx int64, target string, autoGrant bool, notBefore, expiresAt *time.Time, roleIds ...int64) (result []*Role, err error) {
+	if len(roleIds) == 0 {
+		return nil, ErrRoleNotExist
+	}
+
+	if target == "" {
+		return nil, ErrTargetNotAllowed
+	}
+
+	if err = checkGrantPeriod(notBefore, expiresAt); err != nil {
+		return nil, err
+	}
+
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	roleList, err := nRepo.GetRolesWithIds(ctx, roleIds...)
+	if err != nil {
+		return nil, err
+	}
+
+	if result, err = this.grantRole(ctx, nRepo, target, roleList, autoGrant, notBefore, expiresAt); err != nil {
+		return nil, err
+	}
+
+	// 直接授权会取代委托，委托人失去角色时不再取消该授权
+	if err = this.removeDelegations(ctx, nRepo, target, result, notBefore == nil && expiresAt == nil); err != nil {
+		return nil, err
+	}
+
+	tx.Commit()
+	return result, nil
+}
+
+// checkCardinality 验证授予角色 roleIds 给 target 之后是否会超出数量限制，需要在事务中调用
+//
+// 验证时会锁定相关的角色记录、数量限制记录及授权记录，并发的授权会依次进行，不会超出数量限制；限制授权数量的角色不能授予给授权对象组
+func (this *Service) checkCardinality(ctx int64, nRepo Repository, target string, roleIds []int64) (err error) {
+	roleList, err := nRepo.LockRolesWithIds(ctx, roleIds)
+	if err != nil {
+		return err
+	}
+	for _, role := range roleList {
+		if role.MaxTargets <= 0 {
+			continue
+		}
+		if strings.HasPrefix(target, TargetGroupPrefix) {
+			return ErrTargetNotAllowed
+		}
+		count, err := nRepo.CountRoleTargets(ctx, role.Id, target)
+		if err != nil {
+			return err
+		}
+		if count >= role.MaxTargets {
+			return &CardinalityError{Role: role.Name, Limit: role.MaxTargets, Count: count}
+		}
+	}
+
+	maxRoles, err := nRepo.LockMaxRolesPerTarget(ctx)
+	if err != nil {
+		return err
+	}
+	if maxRoles <= 0 {
+		return nil
+	}
+	// 需要使用加锁读取，否则在等待锁的过程中其它事务提交的授权不可见
+	grantList, err := nRepo.LockGrantsWithTarget(ctx, target)
+	if err != nil {
+		return err
+	}
+	var heldIds, _ = heldRoleIds(grantList)
+	var gIdm = make(map[int64]struct{}, len(heldIds)+len(roleIds))
+	for _, id := range heldIds {
+		gIdm[id] = struct{}{}
+	}
+	for _, id := range roleIds {
+		gIdm[id] = struct{}{}
+	}
+	if len(gIdm) > maxRoles {
+		return &CardinalityError{Target: target, Limit: maxRoles, Count: len(heldIds)}
+	}
+	return nil
+}
+
+// checkRoleConstraints 验证 target 将要同时拥有的所有角色 roleIds（包括尚未生效的授权）之间的互斥关系及角色先决条件
+//
+// 角色先决条件只能由 activeIds 中的角色满足，即已经生效的授权及本次授予的角色，尚未生效的授权不能满足角色先决条件
+func (this *Service) checkRoleConstraints(ctx int64, nRepo Repository, roleIds, activeIds []int64) (err error) {
+	// 获取并验证互斥关系
+	mutexRoleList, err := nRepo.GetMutexRolesWithIds(ctx, roleIds)
+	if err != nil {
+		return err
+	}
+	for _, role := range mutexRoleList {
+		return newRoleMutexError(role, false)
+	}
+
+	// 获取并验证所有角色所需要的角色先决条件
+	preRoleList, err := nRepo.GetPreRolesWithIds(ctx, roleIds)
+	if err != nil {
+		return err
+	}
+	var idm = make(map[int64]struct{}, len(activeIds))
+	for _, id := range activeIds {
+		idm[id] = struct{}{}
+	}
+	for _, pRole := range preRoleList {
+		if _, ok := idm[pRole.PreRoleId]; ok == false {
+			return newPreRoleMissingError(pRole)
+		}
+	}
+	return nil
+}
+
+// getHeldRoleIds 获取已授予给 target（包括 target 所属的授权对象组）并且尚未过期的角色 id 列表，包括尚未生效的授权，返回值 active 为其中已经生效的角色 id 列表
+func (this *Service) getHeldRoleIds(ctx int64, nRepo Repository, target string) (result, active []int64, err error) {
+	grantList, err := nRepo.GetGrantsWithTarget(ctx, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, active = heldRoleIds(grantList)
+	return result, active, nil
+}
+
+// heldRoleIds 从授权信息列表中获取尚未过期的角色 id 列表，包括尚未生效的授权，返回值 active 为其中已经生效的角色 id 列表
+func heldRoleIds(grantList []*Grant) (result, active []int64) {
+	var now = time.Now()
+	var idm = make(map[int64]struct{}, len(grantList))
+	var aIdm = make(map[int64]struct{}, len(grantList))
+	for _, grant := range grantList {
+		if grant.ExpiresAt != nil && grant.ExpiresAt.After(now) == false {
+			continue
+		}
+		if _, ok := idm[grant.RoleId]; ok == false {
+			idm[grant.RoleId] = struct{}{}
+			result = append(result, grant.RoleId)
+		}
+		// 同一个角色可能同时直接授予给 target 及授予给 target 所属的授权对象组，任意一个授权已经生效即可
+		if grant.NotBefore != nil && grant.NotBefore.After(now) {
+			continue
+		}
+		if _, ok := aIdm[grant.RoleId]; ok == false {
+			aIdm[grant.RoleId] = struct{}{}
+			active = append(active, grant.RoleId)
+		}
+	}
+	return result, active
+}
+
+// removeDelegations 删除委托给 target 的角色 roleList 的委托记录
+//
+// 参数 clearPeriod 为 true 时表示直接授权未指定有效期，此时需要清除原来通过委托获得的授权的有效期，否则该授权仍然会在委托到期时失效
+func (this *Service) removeDelegations(ctx int64, nRepo Repository, target string, roleList []*Role, clearPeriod bool) (err error) {
+	var rIds = make([]int64, 0, len(roleList))
+	var rIdm = make(map[int64]struct{}, len(roleList))
+	for _, role := range roleList {
+		rIds = append(rIds, role.Id)
+		rIdm[role.Id] = struct{}{}
+	}
+	if len(rIds) == 0 {
+		return nil
+	}
+
+	if clearPeriod {
+		delegations, err := nRepo.GetDelegations(ctx, "", target)
+		if err != nil {
+			return err
+		}
+		var dIds []int64
+		for _, delegation := range delegations {
+			if _, ok := rIdm[delegation.RoleId]; ok {
+				dIds = append(dIds, delegation.RoleId)
+				delete(rIdm, delegation.RoleId)
+			}
+		}
+		if err = nRepo.GrantRoleWithIdsBetween(ctx, target, nil, nil, dIds...); err != nil {
+			return err
+		}
+	}
+	return nRepo.RemoveDelegationsWithTarget(ctx, target, rIds)
+}
+
+// checkGrantPeriod 验证授权的有效期
+func checkGrantPeriod(notBefore, expiresAt *time.Time) error {
+	if expiresAt != nil {
+		if expiresAt.Before(time.Now()) {
+			return ErrInvalidGrantPeriod
+		}
+		if notBefore != nil && expiresAt.After(*notBefore) == false {
+			return ErrInvalidGrantPeriod
+		}
+	}
+	return nil
+}
+
+// grantRole 授权角色给 target，如果参数 autoGrant 的值为 true，则会一并授予 target 缺失的先决角色，返回本次授予的所有角色
+//
+// 参数 notBefore 及 expiresAt 为授权的有效期，值为 nil 时表示不限制
+func (this *Service) grantRole(ctx int64, nRepo Repository, target string, roleList []*Role, autoGrant bool, notBefore, expiresAt *time.Time) (result []*Role, err error) {
+	var gIds = make([]int64, 0, len(roleList)) // 本次新授权角色 id 列表加上原来已授权角色 id 列表
+	var nIds = make([]int64, 0, len(roleList)) // 本次新授权角色 id 列表
+	var gIdm = make(map[int64]struct{})        // 本次新授权角色 id 加上原来已授权角色 id 组成的 map
+	for _, role := range roleList {
+		gIds = append(gIds, role.Id)
+		nIds = append(nIds, role.Id)
+		gIdm[role.Id] = struct{}{}
+	}
+	if len(nIds) == 0 {
+		return nil, ErrGrantFailed
+	}
+
+	// 查询出已授予给 target 并且尚未过期的角色，尚未生效的授权同样需要满足互斥关系及先决条件，但是不能满足其它角色的先决条件
+	heldIds, activeIds, err := this.getHeldRoleIds(ctx, nRepo, target)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range heldIds {
+		if _, ok := gIdm[id]; ok {
+			continue
+		}
+		gIds = append(gIds, id)
+		gIdm[id] = struct{}{}
+	}
+
+	// 展开本次授权角色所需要的先决角色
+	if autoGrant {
+		var cIds = nIds // 本轮需要展开先决条件的角色 id 列表
+		for len(cIds) > 0 {
+			preRoleList, err := nRepo.GetPreRolesWithIds(ctx, cIds)
+			if err != nil {
+				return nil, err
+			}
+			cIds = nil
+			for _, pRole := range preRoleList {
+				if _, ok := gIdm[pRole.PreRoleId]; ok {
+					continue
+				}
+				gIdm[pRole.PreRoleId] = struct{}{}
+				gIds = append(gIds, pRole.PreRoleId)
+				nIds = append(nIds, pRole.PreRoleId)
+				cIds = append(cIds, pRole.PreRoleId)
+			}
+		}
+	}
+
+	// 验证互斥关系及角色先决条件
+	if err = this.checkRoleConstraints(ctx, nRepo, gIds, append(activeIds, nIds...)); err != nil {
+		return nil, err
+	}
+
+	// 验证数量限制
+	if err = this.checkCardinality(ctx, nRepo, target, nIds); err != nil {
+		return nil, err
+	}
+
+	// 只有明确指定了有效期时才更新已有授权的有效期
+	if notBefore == nil && expiresAt == nil {
+		err = nRepo.GrantRoleWithIds(ctx, target, nIds...)
+	} else {
+		err = nRepo.GrantRoleWithIdsBetween(ctx, target, notBefore, expiresAt, nIds...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nIds) == len(roleList) {
+		return roleList, nil
+	}
+	if result, err = nRepo.GetRolesWithIds(ctx, nIds...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ReGrantRole 授权角色给 target，会将原有的角色授权先取消掉
+//
+// target 通过授权对象组获得的角色不会被取消，本次授予的角色需要与这些角色满足互斥关系及角色先决条件
+func (this *Service) ReGrantRole(ctx int64, target string, roleNames ...string) (err error) {
+	if len(roleNames) == 0 {
+		return ErrRoleNotExist
+	}
+
+	if target == "" {
+		return ErrTargetNotAllowed
+	}
+
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	roleList, err := nRepo.GetRolesWithNames(ctx, roleNames...)
+	if err != nil {
+		return err
+	}
+
+	var nIds = make([]int64, 0, len(roleList))
+	var gIdm = make(map[int64]struct{})
+	for _, role := range roleList {
+		nIds = append(nIds, role.Id)
+		gIdm[role.Id] = struct{}{}
+	}
+	if len(nIds) == 0 {
+		return ErrGrantFailed
+	}
+
+	if err = nRepo.RevokeAllRole(ctx, target); err != nil {
+		return err
+	}
+
+	// 取消原有的授权之后 target 仍然拥有通过授权对象组获得的角色，需要一并验证互斥关系及角色先决条件
+	heldIds, activeIds, err := this.getHeldRoleIds(ctx, nRepo, target)
+	if err != nil {
+		return err
+	}
+	var gIds = make([]int64, 0, len(nIds)+len(heldIds))
+	gIds = append(gIds, nIds...)
+	for _, id := range heldIds {
+		if _, ok := gIdm[id]; ok {
+			continue
+		}
+		gIds = append(gIds, id)
+		gIdm[id] = struct{}{}
+	}
+	if err = this.checkRoleConstraints(ctx, nRepo, gIds, append(activeIds, nIds...)); err != nil {
+		return err
+	}
+
+	// 验证数量限制
+	if err = this.checkCardinality(ctx, nRepo, target, nIds); err != nil {
+		return err
+	}
+
+	if err = nRepo.GrantRoleWithIds(ctx, target, nIds...); err != nil {
+		return err
+	}
+
+	targets, err := this.cleanDelegations(ctx, nRepo, target)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	for _, target := range targets {
+		this.CleanCache(ctx, target)
+	}
+	return nil
+}
+
+// ReGrantRoleWithId 授权角色给 target，会将原有的角色授权先取消掉
+//
+// target 通过授权对象组获得的角色不会被取消，本次授予的角色需要与这些角色满足互斥关系及角色先决条件
+func (this *Service) ReGrantRoleWithId(ctx int64, target string, roleIds ...int64) (err error) {
+	if len(roleIds) == 0 {
+		return ErrRoleNotExist
+	}
+
+	if target == "" {
+		return ErrTargetNotAllowed
+	}
+
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	roleList, err := nRepo.GetRolesWithIds(ctx, roleIds...)
+	if err != nil {
+		return err
+	}
+
+	var nIds = make([]int64, 0, len(roleList))
+	var gIdm = make(map[int64]struct{})
+	for _, role := range roleList {
+		nIds = append(nIds, role.Id)
+		gIdm[role.Id] = struct{}{}
+	}
+	if len(nIds) == 0 {
+		return ErrGrantFailed
+	}
+
+	if err = nRepo.RevokeAllRole(ctx, target); err != nil {
+		return err
+	}
+
+	// 取消原有的授权之后 target 仍然拥有通过授权对象组获得的角色，需要一并验证互斥关系及角色先决条件
+	heldIds, activeIds, err := this.getHeldRoleIds(ctx, nRepo, target)
+	if err != nil {
+		return err
+	}
+	var gIds = make([]int64, 0, len(nIds)+len(heldIds))
+	gIds = append(gIds, nIds...)
+	for _, id := range heldIds {
+		if _, ok := gIdm[id]; ok {
+			continue
+		}
+		gIds = append(gIds, id)
+		gIdm[id] = struct{}{}
+	}
+	if err = this.checkRoleConstraints(ctx, nRepo, gIds, append(activeIds, nIds...)); err != nil {
+		return err
+	}
+
+	// 验证数量限制
+	if err = this.checkCardinality(ctx, nRepo, target, nIds); err != nil {
+		return err
+	}
+
+	if err = nRepo.GrantRoleWithIds(ctx, target, nIds...); err != nil {
+		return err
+	}
+
+	targets, err := this.cleanDelegations(ctx, nRepo, target)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	for _, target := range targets {
+		this.CleanCache(ctx, target)
+	}
+	return nil
+}
+
+// RevokeRole 取消对 target 的角色授权
+func (this *Service) RevokeRole(ctx int64, target string, roleNames ...string) (err error) {
+	if len(roleNames) == 0 {
+		return ErrRoleNotExist
+	}
+
+	if target == "" {
+		return ErrTargetNotAllowed
+	}
+
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	rRoleList, err := nRepo.GetRolesWithNames(ctx, roleNames...)
+	if err != nil {
+		return err
+	}
+
+	var rIds = make([]int64, 0, len(rRoleList))
+	for _, role := range rRoleList {
+		rIds = append(rIds, role.Id)
+	}
+	if len(rIds) == 0 {
+		return ErrGrantFailed
+	}
+
+	if err = nRepo.RevokeRoleWithIds(ctx, target, rIds...); err != nil {
+		return err
+	}
+
+	var gIds = make([]int64, 0, len(rRoleList))
+	var gIdm = make(map[int64]struct{})
+
+	// 查询出已授予给 target 的角色
+	grantedRoleList, err := nRepo.GetGrantedRoles(ctx, target, false)
+	if err != nil {
+		return err
+	}
+	for _, role := range grantedRoleList {
+		gIds = append(gIds, role.Id)
+		gIdm[role.Id] = struct{}{}
+	}
+
+	// 获取并验证所有角色所需要的角色先决条件
+	if len(gIds) > 0 {
+		preRoleList, err := nRepo.GetPreRolesWithIds(ctx, gIds)
+		if err != nil {
+			return err
+		}
+		for _, pRole := range preRoleList {
+			if _, ok := gIdm[pRole.PreRoleId]; ok == false {
+				return newPreRoleRequiredError(pRole)
+			}
+		}
+	}
+
+	// 取消 target 委托出去的、已经不再拥有的角色
+	targets, err := this.cleanDelegations(ctx, nRepo, target)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	for _, target := range targets {
+		this.CleanCache(ctx, target)
+	}
+	return nil
+}
+
+// RevokeRoleWithId 取消对 target 的角色授权
+func (this *Service) RevokeRoleWithId(ctx int64, target string, roleIds ...int64) (err error) {
+	if len(roleIds) == 0 {
+		return ErrRoleNotExist
+	}
+
+	if target == "" {
+		return ErrTargetNotAllowed
+	}
+
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	rRoleList, err := nRepo.GetRolesWithIds(ctx, roleIds...)
+	if err != nil {
+		return err
+	}
+
+	var rIds = make([]int64, 0, len(rRoleList))
+	for _, role := range rRoleList {
+		rIds = append(rIds, role.Id)
+	}
+	if len(rIds) == 0 {
+		return ErrGrantFailed
+	}
+
+	if err = nRepo.RevokeRoleWithIds(ctx, target, rIds...); err != nil {
+		return err
+	}
+
+	var gIds = make([]int64, 0, len(rRoleList))
+	var gIdm = make(map[int64]struct{})
+
+	// 查询出已授予给 target 的角色
+	grantedRoleList, err := nRepo.GetGrantedRoles(ctx, target, false)
+	if err != nil {
+		return err
+	}
+	for _, role := range grantedRoleList {
+		gIds = append(gIds, role.Id)
+		gIdm[role.Id] = struct{}{}
+	}
+
+	// 获取并验证所有角色所需要的角色先决条件
+	if len(gIds) > 0 {
+		preRoleList, err := nRepo.GetPreRolesWithIds(ctx, gIds)
+		if err != nil {
+			return err
+		}
+		for _, pRole := range preRoleList {
+			if _, ok := gIdm[pRole.PreRoleId]; ok == false {
+				return newPreRoleRequiredError(pRole)
+			}
+		}
+	}
+
+	// 取消 target 委托出去的、已经不再拥有的角色
+	targets, err := this.cleanDelegations(ctx, nRepo, target)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	for _, target := range targets {
+		this.CleanCache(ctx, target)
+	}
+	return nil
+}
+
+// RevokeAllRole 取消对 target 的所有角色授权，target 委托出去的角色委托会被一并取消
+func (this *Service) RevokeAllRole(ctx int64, target string) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = nRepo.RevokeAllRole(ctx, target); err != nil {
+		return err
+	}
+
+	targets, err := this.cleanDelegations(ctx, nRepo, target)
+	if err != nil {
+		return err
+	}
+
+	tx.Commit()
+	for _, target := range targets {
+		this.CleanCache(ctx, target)
+	}
+	return nil
+}
+
+// DelegateRole 将 fromTarget 拥有（或者有权操作）的角色 roleName 委托给 toTarget，委托在 until 之后失效
+//
+// 委托会为 toTarget 添加一条角色授权，授权时需要满足 toTarget 已拥有的角色与该角色之间的互斥关系及先决条件；
+// 委托的有效期不会超过 fromTarget 自身拥有该角色的有效期，fromTarget 失去该角色时，委托（包括 toTarget 继续委托出去的委托）会被自动取消。
+//
+// 如果 fromTarget 已经将该角色委托给 toTarget，则更新委托的有效期
+func (this *Service) DelegateRole(ctx int64, fromTarget, toTarget, roleName string, until time.Time) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+
+	if err = this.delegateRole(ctx, nRepo, fromTarget, toTarget, role, until); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.CleanCache(ctx, toTarget)
+	return nil
+}
+
+// DelegateRoleWithId 将 fromTarget 拥有（或者有权操作）的角色 roleId 委托给 toTarget，委托在 until 之后失效
+//
+// 如果 fromTarget 已经将该角色委托给 toTarget，则更新委托的有效期
+func (this *Service) DelegateRoleWithId(ctx int64, fromTarget, toTarget string, roleId int64, until time.Time) (err error) {
+	var tx, nRepo = this.repo.BeginTx()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+
+	if err = this.delegateRole(ctx, nRepo, fromTarget, toTarget, role, until); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	this.CleanCache(ctx, toTarget)
+	return nil
+}
+
+func (this *Service) delegateRole(ctx int64, nRepo Repository, fromTarget, toTarget string, role *Role, until time.Time) (err error) {
+	if fromTarget == "" || toTarget == "" || fromTarget == toTarget {
+		return ErrTargetNotAllowed
+	}
+	if strings.HasPrefix(fromTarget, TargetGroupPrefix) || strings.HasPrefix(toTarget, TargetGroupPrefix) {
+		return ErrTargetNotAllowed
+	}
+
+	if err = checkGrantPeriod(nil, &until); err != nil {
+		return err
+	}
+
+	if role.Status != Enable {
+		return ErrRoleNotDelegable
+	}
+
+	// 委托的有效期不能超过 fromTarget 自身拥有该角色的有效期
+	expiresAt, ok, err := this.getRoleExpiresAt(ctx, nRepo, fromTarget, role)
+	if err != nil {
+		return err
+	}
+	if ok == false {
+		return ErrRoleNotDelegable
+	}
+	if expiresAt != nil && expiresAt.Before(until) {
+		until = *expiresAt
+	}
+
+	// toTarget 已经拥有该角色（包括尚未生效的授权）时，只允许原委托人更新委托的有效期，避免覆盖 toTarget 原有的授权
+	heldIds, _, err := this.getHeldRoleIds(ctx, nRepo, toTarget)
+	if err != nil {
+		return err
+	}
+	var held bool
+	for _, id := range heldIds {
+		if id == role.Id {
+			held = true
+			break
+		}
+	}
+	if held {
+		delegations, err := nRepo.GetDelegations(ctx, fromTarget, toTarget)
+		if err != nil {
+			return err
+		}
+		var delegated bool
+		for _, delegation := range delegations {
+			if delegation.RoleId == role.Id {
+				delegated = true
+				break
+			}
+		}
+		if delegated == false {
+			return ErrRoleAlreadyGranted
+		}
+	}
+
+	if _, err = this.grantRole(ctx, nRepo, toTarget, []*Role{role}, false, nil, &until); err != nil {
+		return err
+	}
+	return nRepo.AddDelegation(ctx, role.Id, fromTarget, toTarget, until)
+}
+
+// getRoleExpiresAt 获取 target 拥有（或者通过父角色有权操作）角色 role 的过期时间，返回值 ok 为 false 表示 target 当前未拥有该角色，expiresAt 为 nil 表示永不过期
+func (this *Service) getRoleExpiresAt(ctx int64, nRepo Repository, target string, role *Role) (expiresAt *time.Time, ok bool, err error) {
+	held, err := this.holdRoleWithId(ctx, nRepo, target, role.Id)
+	if err != nil {
+		return nil, false, err
+	}
+	if held == false {
+		return nil, false, nil
+	}
+
+	grants, err := nRepo.GetGrantsWithTarget(ctx, target)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var now = time.Now()
+	var gIds = make([]int64, 0, len(grants))
+	var gm = make(map[int64][]*Grant)
+	for _, grant := range grants {
+		if grant.NotBefore != nil && grant.NotBefore.After(now) {
+			continue
+		}
+		if grant.ExpiresAt != nil && grant.ExpiresAt.After(now) == false {
+			continue
+		}
+		if _, exists := gm[grant.RoleId]; exists == false {
+			gIds = append(gIds, grant.RoleId)
+		}
+		gm[grant.RoleId] = append(gm[grant.RoleId], grant)
+	}
+	if len(gIds) == 0 {
+		return nil, false, nil
+	}
+
+	roleList, err := nRepo.GetRolesWithIds(ctx, gIds...)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, gRole := range roleList {
+		if gRole.Id != role.Id && (gRole.LeftValue < role.LeftValue && gRole.RightValue > role.RightValue) == false {
+			continue
+		}
+		for _, grant := range gm[gRole.Id] {
+			if grant.ExpiresAt == nil {
+				return nil, true, nil
+			}
+			if ok == false || grant.ExpiresAt.After(*expiresAt) {
+				expiresAt = grant.ExpiresAt
+				ok = true
+			}
+		}
+	}
+	return expiresAt, ok, nil
 }
 
-// AddRole 添加角色
-func (this *Service) AddRole(ctx int64, roleName, aliasName, description string, status Status) (result int64, err error) {
-	return this.AddRoleWithParentId(ctx, 0, roleName, aliasName, description, status)
+// RevokeDelegation 取消 fromTarget 对 toTarget 的角色委托，toTarget 继续委托出去的委托会被一并取消
+func (this *Service) RevokeDelegation(ctx int64, fromTarget, toTarget, roleName string) (err error) {
+	role, err := this.repo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+	return this.revokeDelegation(ctx, fromTarget, toTarget, role.Id)
 }
 
-// AddRoleWithParent 添加角色，新添加的角色将作为 parentRoleName 的子角色
-//
-// 调用时应该确认操作者是否有访问 parentRoleName 的权限，即 parentRoleName 是否为当前操作者拥有的角色及其子角色
-func (this *Service) AddRoleWithParent(ctx int64, parentRoleName, roleName, aliasName, description string, status Status) (result int64, err error) {
+// RevokeDelegationWithId 取消 fromTarget 对 toTarget 的角色委托，toTarget 继续委托出去的委托会被一并取消
+func (this *Service) RevokeDelegationWithId(ctx int64, fromTarget, toTarget string, roleId int64) (err error) {
+	return this.revokeDelegation(ctx, fromTarget, toTarget, roleId)
+}
+
+func (this *Service) revokeDelegation(ctx int64, fromTarget, toTarget string, roleId int64) (err error) {
 	var tx, nRepo = this.repo.BeginTx()
 	defer func() {
 		if err != nil {
@@ -1540,81 +4578,172 @@ func (this *Service) AddRoleWithParent(ctx int64, parentRoleName, roleName, alia
 		}
 	}()
 
-	var parentRole *Role
-	if parentRoleName != "" {
-		// 验证 parentRoleName 是否存在
-		parentRole, err = nRepo.GetRoleWithName(ctx, parentRoleName)
-		if err != nil {
-			return 0, err
-		}
-		if parentRole == nil {
-			return 0, ErrParentRoleNotExist
+	delegations, err := nRepo.GetDelegations(ctx, fromTarget, toTarget)
+	if err != nil {
+		return err
+	}
+	var delegation *Delegation
+	for _, d := range delegations {
+		if d.RoleId == roleId {
+			delegation = d
+			break
 		}
 	}
+	if delegation == nil {
+		return ErrDelegationNotExist
+	}
 
-	// 验证 name 是否已经存在
-	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	if err = nRepo.RevokeRoleWithIds(ctx, toTarget, roleId); err != nil {
+		return err
+	}
+
+	targets, err := this.cleanDelegations(ctx, nRepo, toTarget)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	if role != nil {
-		return 0, ErrRoleNameExists
+
+	tx.Commit()
+	this.CleanCache(ctx, toTarget)
+	for _, target := range targets {
+		this.CleanCache(ctx, target)
 	}
+	return nil
+}
 
-	if result, err = nRepo.AddRole(ctx, parentRole, roleName, aliasName, description, status); err != nil {
-		return 0, err
+// GetDelegationsFrom 获取 fromTarget 委托出去的未过期的角色委托
+func (this *Service) GetDelegationsFrom(ctx int64, fromTarget string) (result []*Delegation, err error) {
+	if fromTarget == "" {
+		return nil, ErrTargetNotAllowed
 	}
+	return this.repo.GetDelegations(ctx, fromTarget, "")
+}
 
-	tx.Commit()
-	return result, nil
+// GetDelegationsTo 获取委托给 toTarget 的未过期的角色委托
+func (this *Service) GetDelegationsTo(ctx int64, toTarget string) (result []*Delegation, err error) {
+	if toTarget == "" {
+		return nil, ErrTargetNotAllowed
+	}
+	return this.repo.GetDelegations(ctx, "", toTarget)
 }
 
-// AddRoleWithParentId 添加角色，新添加的角色将作为 parentRoleId 的子角色
+// GetDelegationChain 获取 target 通过委托获得角色 roleName 的委托链，第一个元素为委托给 target 的委托，最后一个元素的 FromTarget 为最初的委托人
 //
-// 调用时应该确认操作者是否有访问 parentRoleId 的权限，即 parentRoleId 是否为当前操作者拥有的角色及其子角色
-func (this *Service) AddRoleWithParentId(ctx, parentRoleId int64, roleName, aliasName, description string, status Status) (result int64, err error) {
-	var tx, nRepo = this.repo.BeginTx()
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
-	if parentRoleId < 0 {
-		return 0, ErrParentRoleNotExist
+// target 不是通过委托获得该角色时，返回空列表
+func (this *Service) GetDelegationChain(ctx int64, target, roleName string) (result []*Delegation, err error) {
+	role, err := this.repo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, ErrRoleNotExist
 	}
+	return this.GetDelegationChainWithId(ctx, target, role.Id)
+}
 
-	var parentRole *Role
-	if parentRoleId > 0 {
-		// 验证 parentRoleName 是否存在
-		parentRole, err = nRepo.GetRoleWithId(ctx, parentRoleId)
+// GetDelegationChainWithId 获取 target 通过委托获得角色 roleId 的委托链，第一个元素为委托给 target 的委托，最后一个元素的 FromTarget 为最初的委托人
+//
+// target 不是通过委托获得该角色时，返回空列表
+func (this *Service) GetDelegationChainWithId(ctx int64, target string, roleId int64) (result []*Delegation, err error) {
+	var visited = make(map[string]struct{})
+	for target != "" {
+		if _, ok := visited[target]; ok {
+			break
+		}
+		visited[target] = struct{}{}
+
+		delegations, err := this.repo.GetDelegations(ctx, "", target)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		if parentRole == nil {
-			return 0, ErrParentRoleNotExist
+		var next string
+		for _, delegation := range delegations {
+			if delegation.RoleId == roleId {
+				result = append(result, delegation)
+				next = delegation.FromTarget
+				break
+			}
 		}
+		target = next
 	}
+	return result, nil
+}
 
-	// 验证 name 是否已经存在
-	role, err := nRepo.GetRoleWithName(ctx, roleName)
-	if err != nil {
-		return 0, err
-	}
-	if role != nil {
-		return 0, ErrRoleNameExists
+// cleanDelegations 在 targets 失去角色之后调用，取消 targets（或者组内成员）委托出去的、委托人已经不再拥有相应角色的委托，
+// 并逐级取消接受委托的 target 继续委托出去的委托，返回所有被取消委托的 target
+func (this *Service) cleanDelegations(ctx int64, nRepo Repository, targets ...string) (result []string, err error) {
+	for len(targets) > 0 {
+		var next []string
+		for _, target := range targets {
+			if groupId, ok := ParseTargetOfGroup(target); ok {
+				members, err := nRepo.GetGroupMembers(ctx, groupId)
+				if err != nil {
+					return nil, err
+				}
+				for _, member := range members {
+					next = append(next, member.Target)
+				}
+				continue
+			}
+
+			delegations, err := nRepo.GetDelegations(ctx, target, "")
+			if err != nil {
+				return nil, err
+			}
+			for _, delegation := range delegations {
+				held, err := this.holdRoleWithId(ctx, nRepo, target, delegation.RoleId)
+				if err != nil {
+					return nil, err
+				}
+				if held {
+					continue
+				}
+				if err = nRepo.RemoveDelegation(ctx, delegation.RoleId, delegation.FromTarget, delegation.ToTarget); err != nil {
+					return nil, err
+				}
+				if err = nRepo.RevokeRoleWithIds(ctx, delegation.ToTarget, delegation.RoleId); err != nil {
+					return nil, err
+				}
+				result = append(result, delegation.ToTarget)
+				next = append(next, delegation.ToTarget)
+			}
+		}
+		targets = next
 	}
+	return result, nil
+}
 
-	if result, err = nRepo.AddRole(ctx, parentRole, roleName, aliasName, description, status); err != nil {
-		return 0, err
+// holdRoleWithId 验证 target 是否拥有（或者通过父角色有权操作）角色 roleId，访问数据库或者缓存出错时返回错误
+func (this *Service) holdRoleWithId(ctx int64, nRepo Repository, target string, roleId int64) (bool, error) {
+	ok, err := nRepo.CheckRoleWithIdE(ctx, target, roleId)
+	if err != nil || ok {
+		return ok, err
 	}
+	return nRepo.CheckRoleAccessibleWithIdE(ctx, target, roleId)
+}
 
-	tx.Commit()
-	return result, nil
+// GetGrantedRolesOn 获取在资源 resource 上授权给 target 的角色列表，不包含全局授权的角色
+func (this *Service) GetGrantedRolesOn(ctx int64, target, resource string) (result []*Role, err error) {
+	return this.repo.GetGrantedRolesOn(ctx, target, resource)
 }
 
-// UpdateRole 根据 roleName 更新角色信息
-func (this *Service) UpdateRole(ctx int64, roleName, aliasName, description string, status Status) (err error) {
+// GrantRoleOn 在资源 resource 上授予角色给 target，如 GrantRoleOn(ctx, "u1", "project:42", "editor")
+//
+// 资源使用 : 分隔层级，在资源 project:* 上授予的角色对 project:42 及 project:42:doc:7 同样有效，在资源 * 上授予的角色对所有资源有效
+//
+// 互斥关系及先决条件会结合 target 全局拥有的角色以及在该资源上拥有的角色进行验证
+func (this *Service) GrantRoleOn(ctx int64, target, resource string, roleNames ...string) (err error) {
+	if len(roleNames) == 0 {
+		return ErrRoleNotExist
+	}
+
+	if target == "" {
+		return ErrTargetNotAllowed
+	}
+
+	if resource == "" {
+		return ErrResourceNotAllowed
+	}
+
 	var tx, nRepo = this.repo.BeginTx()
 	defer func() {
 		if err != nil {
@@ -1622,16 +4751,12 @@ func (this *Service) UpdateRole(ctx int64, roleName, aliasName, description stri
 		}
 	}()
 
-	// 验证角色是否存在
-	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	roleList, err := nRepo.GetRolesWithNames(ctx, roleNames...)
 	if err != nil {
 		return err
 	}
-	if role == nil {
-		return ErrRoleNotExist
-	}
 
-	if err = nRepo.UpdateRole(ctx, role.Id, aliasName, description, status); err != nil {
+	if err = this.grantRoleOn(ctx, nRepo, target, resource, roleList); err != nil {
 		return err
 	}
 
@@ -1639,8 +4764,20 @@ func (this *Service) UpdateRole(ctx int64, roleName, aliasName, description stri
 	return nil
 }
 
-// UpdateRoleWithId 根据 roleId 更新角色信息
-func (this *Service) UpdateRoleWithId(ctx, roleId int64, aliasName, description string, status Status) (err error) {
+// GrantRoleOnWithId 在资源 resource 上授予角色给 target
+func (this *Service) GrantRoleOnWithId(ctx int64, target, resource string, roleIds ...int64) (err error) {
+	if len(roleIds) == 0 {
+		return ErrRoleNotExist
+	}
+
+	if target == "" {
+		return ErrTargetNotAllowed
+	}
+
+	if resource == "" {
+		return ErrResourceNotAllowed
+	}
+
 	var tx, nRepo = this.repo.BeginTx()
 	defer func() {
 		if err != nil {
@@ -1648,16 +4785,12 @@ func (this *Service) UpdateRoleWithId(ctx, roleId int64, aliasName, description
 		}
 	}()
 
-	// 验证角色是否存在
-	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	roleList, err := nRepo.GetRolesWithIds(ctx, roleIds...)
 	if err != nil {
 		return err
 	}
-	if role == nil {
-		return ErrRoleNotExist
-	}
 
-	if err = nRepo.UpdateRole(ctx, roleId, aliasName, description, status); err != nil {
+	if err = this.grantRoleOn(ctx, nRepo, target, resource, roleList); err != nil {
 		return err
 	}
 
@@ -1665,34 +4798,82 @@ func (this *Service) UpdateRoleWithId(ctx, roleId int64, aliasName, description
 	return nil
 }
 
-// UpdateRoleStatus 根据 roleName 更新角色的状态
-func (this *Service) UpdateRoleStatus(ctx int64, roleName string, status Status) (err error) {
-	var tx, nRepo = this.repo.BeginTx()
-	defer func() {
-		if err != nil {
-			tx.Rollback()
+// grantedRolesOn 获取 target 全局拥有的角色以及在资源 resource 上拥有的角色
+func (this *Service) grantedRolesOn(ctx int64, nRepo Repository, target, resource string) (result []*Role, err error) {
+	grantedRoleList, err := nRepo.GetGrantedRoles(ctx, target, false)
+	if err != nil {
+		return nil, err
+	}
+	resourceRoleList, err := nRepo.GetGrantedRolesOn(ctx, target, resource)
+	if err != nil {
+		return nil, err
+	}
+	return append(grantedRoleList, resourceRoleList...), nil
+}
+
+func (this *Service) grantRoleOn(ctx int64, nRepo Repository, target, resource string, roleList []*Role) (err error) {
+	var gIds = make([]int64, 0, len(roleList)) // 本次新授权角色 id 列表加上原来已授权角色 id 列表
+	var nIds = make([]int64, 0, len(roleList)) // 本次新授权角色 id 列表
+	var gIdm = make(map[int64]struct{})        // 本次新授权角色 id 加上原来已授权角色 id 组成的 map
+	for _, role := range roleList {
+		gIds = append(gIds, role.Id)
+		nIds = append(nIds, role.Id)
+		gIdm[role.Id] = struct{}{}
+	}
+	if len(nIds) == 0 {
+		return ErrGrantFailed
+	}
+
+	// 查询出 target 全局拥有的角色以及在该资源上拥有的角色
+	grantedRoleList, err := this.grantedRolesOn(ctx, nRepo, target, resource)
+	if err != nil {
+		return err
+	}
+	for _, role := range grantedRoleList {
+		if _, ok := gIdm[role.Id]; ok {
+			continue
 		}
-	}()
+		gIds = append(gIds, role.Id)
+		gIdm[role.Id] = struct{}{}
+	}
 
-	// 验证角色是否存在
-	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	// 获取并验证互斥关系
+	mutexRoleList, err := nRepo.GetMutexRolesWithIds(ctx, gIds)
 	if err != nil {
 		return err
 	}
-	if role == nil {
-		return ErrRoleNotExist
+	for _, role := range mutexRoleList {
+		return newRoleMutexError(role, false)
 	}
 
-	if err = nRepo.UpdateRoleStatus(ctx, role.Id, status); err != nil {
+	// 获取并验证本次授权角色所需要的角色先决条件
+	preRoleList, err := nRepo.GetPreRolesWithIds(ctx, nIds)
+	if err != nil {
 		return err
 	}
+	for _, pRole := range preRoleList {
+		if _, ok := gIdm[pRole.PreRoleId]; ok == false {
+			return newPreRoleMissingError(pRole)
+		}
+	}
 
-	tx.Commit()
-	return nil
+	return nRepo.GrantRoleOnWithIds(ctx, target, resource, nIds...)
 }
 
-// UpdateRoleStatusWithId 根据 roleId 更新角色的状态
-func (this *Service) UpdateRoleStatusWithId(ctx, roleId int64, status Status) (err error) {
+// RevokeRoleOn 取消对 target 在资源 resource 上的角色授权，不会影响全局授权的角色
+func (this *Service) RevokeRoleOn(ctx int64, target, resource string, roleNames ...string) (err error) {
+	if len(roleNames) == 0 {
+		return ErrRoleNotExist
+	}
+
+	if target == "" {
+		return ErrTargetNotAllowed
+	}
+
+	if resource == "" {
+		return ErrResourceNotAllowed
+	}
+
 	var tx, nRepo = this.repo.BeginTx()
 	defer func() {
 		if err != nil {
@@ -1700,16 +4881,12 @@ func (this *Service) UpdateRoleStatusWithId(ctx, roleId int64, status Status) (e
 		}
 	}()
 
-	// 验证角色是否存在
-	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	roleList, err := nRepo.GetRolesWithNames(ctx, roleNames...)
 	if err != nil {
 		return err
 	}
-	if role == nil {
-		return ErrRoleNotExist
-	}
 
-	if err = nRepo.UpdateRoleStatus(ctx, role.Id, status); err != nil {
+	if err = this.revokeRoleOn(ctx, nRepo, target, resource, roleList); err != nil {
 		return err
 	}
 
@@ -1717,9 +4894,9 @@ func (this *Service) UpdateRoleStatusWithId(ctx, roleId int64, status Status) (e
 	return nil
 }
 
-// GrantRole 授权角色给 target
-func (this *Service) GrantRole(ctx int64, target string, roleNames ...string) (err error) {
-	if len(roleNames) == 0 {
+// RevokeRoleOnWithId 取消对 target 在资源 resource 上的角色授权，不会影响全局授权的角色
+func (this *Service) RevokeRoleOnWithId(ctx int64, target, resource string, roleIds ...int64) (err error) {
+	if len(roleIds) == 0 {
 		return ErrRoleNotExist
 	}
 
@@ -1727,6 +4904,10 @@ func (this *Service) GrantRole(ctx int64, target string, roleNames ...string) (e
 		return ErrTargetNotAllowed
 	}
 
+	if resource == "" {
+		return ErrResourceNotAllowed
+	}
+
 	var tx, nRepo = this.repo.BeginTx()
 	defer func() {
 		if err != nil {
@@ -1734,69 +4915,72 @@ func (this *Service) GrantRole(ctx int64, target string, roleNames ...string) (e
 		}
 	}()
 
-	roleList, err := nRepo.GetRolesWithNames(ctx, roleNames...)
+	roleList, err := nRepo.GetRolesWithIds(ctx, roleIds...)
 	if err != nil {
 		return err
 	}
 
-	var gIds = make([]int64, 0, len(roleList))
-	var nIds = make([]int64, 0, len(roleList))
-	var gIdm = make(map[int64]struct{})
+	if err = this.revokeRoleOn(ctx, nRepo, target, resource, roleList); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+func (this *Service) revokeRoleOn(ctx int64, nRepo Repository, target, resource string, roleList []*Role) (err error) {
+	var rIds = make([]int64, 0, len(roleList))
 	for _, role := range roleList {
-		gIds = append(gIds, role.Id)
-		nIds = append(nIds, role.Id)
-		gIdm[role.Id] = struct{}{}
+		rIds = append(rIds, role.Id)
 	}
-	if len(nIds) == 0 {
-		return ErrGrantFailed
+	if len(rIds) == 0 {
+		return ErrRevokeFailed
 	}
 
-	// 查询出已授予给 target 的角色
-	grantedRoleList, err := nRepo.GetGrantedRoles(ctx, target, false)
+	if err = nRepo.RevokeRoleOnWithIds(ctx, target, resource, rIds...); err != nil {
+		return err
+	}
+
+	// 验证该资源上剩余的角色所需要的角色先决条件
+	resourceRoleList, err := nRepo.GetGrantedRolesOn(ctx, target, resource)
 	if err != nil {
 		return err
 	}
-	for _, role := range grantedRoleList {
-		gIds = append(gIds, role.Id)
-		gIdm[role.Id] = struct{}{}
+	if len(resourceRoleList) == 0 {
+		return nil
 	}
 
-	// 获取并验证互斥关系
-	mutexRoleList, err := nRepo.GetMutexRolesWithIds(ctx, gIds)
+	grantedRoleList, err := nRepo.GetGrantedRoles(ctx, target, false)
 	if err != nil {
 		return err
 	}
-	for _, role := range mutexRoleList {
-		return fmt.Errorf("角色 %s 与角色 %s 互斥", role.RoleAliasName, role.MutexRoleAliasName)
+
+	var cIds = make([]int64, 0, len(resourceRoleList))
+	var gIdm = make(map[int64]struct{})
+	for _, role := range resourceRoleList {
+		cIds = append(cIds, role.Id)
+		gIdm[role.Id] = struct{}{}
+	}
+	for _, role := range grantedRoleList {
+		gIdm[role.Id] = struct{}{}
 	}
 
-	// 获取并验证所有角色所需要的角色先决条件
-	preRoleList, err := nRepo.GetPreRolesWithIds(ctx, gIds)
+	preRoleList, err := nRepo.GetPreRolesWithIds(ctx, cIds)
 	if err != nil {
 		return err
 	}
 	for _, pRole := range preRoleList {
 		if _, ok := gIdm[pRole.PreRoleId]; ok == false {
-			return fmt.Errorf("授予角色 %s 时需要先授予角色 %s", pRole.RoleAliasName, pRole.PreRoleAliasName)
+			return newPreRoleRequiredError(pRole)
 		}
 	}
-
-	if err = nRepo.GrantRoleWithIds(ctx, target, nIds...); err != nil {
-		return err
-	}
-
-	tx.Commit()
 	return nil
 }
 
-// GrantRoleWithId 授权角色给 target
-func (this *Service) GrantRoleWithId(ctx int64, target string, roleIds ...int64) (err error) {
-	if len(roleIds) == 0 {
-		return ErrRoleNotExist
-	}
-
-	if target == "" {
-		return ErrTargetNotAllowed
+// AddRoleMutex 添加角色互斥关系
+func (this *Service) AddRoleMutex(ctx int64, roleName string, mutexRoleNames ...string) (err error) {
+	if len(mutexRoleNames) == 0 {
+		return ErrMutexRoleNotExist
 	}
 
 	var tx, nRepo = this.repo.BeginTx()
@@ -1806,54 +4990,34 @@ func (this *Service) GrantRoleWithId(ctx int64, target string, roleIds ...int64)
 		}
 	}()
 
-	roleList, err := nRepo.GetRolesWithIds(ctx, roleIds...)
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
 	if err != nil {
 		return err
 	}
-
-	var gIds = make([]int64, 0, len(roleList)) // 本次新授权角色 id 列表加上原来已授权角色 id 列表
-	var nIds = make([]int64, 0, len(roleList)) // 本次新授权角色 id 列表
-	var gIdm = make(map[int64]struct{})        // 本次新授权角色 id 加上原来已授权角色 id 组成的 map
-	for _, role := range roleList {
-		gIds = append(gIds, role.Id)
-		nIds = append(nIds, role.Id)
-		gIdm[role.Id] = struct{}{}
-	}
-	if len(nIds) == 0 {
-		return ErrGrantFailed
+	if role == nil {
+		return ErrRoleNotExist
 	}
 
-	// 查询出已授予给 target 的角色
-	grantedRoleList, err := nRepo.GetGrantedRoles(ctx, target, false)
+	mutexRoleList, err := nRepo.GetRolesWithNames(ctx, mutexRoleNames...)
 	if err != nil {
 		return err
 	}
-	for _, role := range grantedRoleList {
-		gIds = append(gIds, role.Id)
-		gIdm[role.Id] = struct{}{}
-	}
 
-	// 获取并验证互斥关系
-	mutexRoleList, err := nRepo.GetMutexRolesWithIds(ctx, gIds)
-	if err != nil {
-		return err
-	}
+	var mutexIds = make([]int64, 0, len(mutexRoleList))
 	for _, role := range mutexRoleList {
-		return fmt.Errorf("角色 %s 与角色 %s 互斥", role.RoleAliasName, role.MutexRoleAliasName)
+		mutexIds = append(mutexIds, role.Id)
+	}
+	if len(mutexIds) == 0 {
+		return ErrMutexRoleNotExist
 	}
 
-	// 获取并验证所有角色所需要的角色先决条件
-	preRoleList, err := nRepo.GetPreRolesWithIds(ctx, gIds)
-	if err != nil {
+	// 验证互斥关系是否与先决条件冲突
+	if err = this.checkRoleMutexConflict(ctx, nRepo, role, mutexIds); err != nil {
 		return err
 	}
-	for _, pRole := range preRoleList {
-		if _, ok := gIdm[pRole.PreRoleId]; ok == false {
-			return fmt.Errorf("授予角色 %s 时需要先授予角色 %s", pRole.RoleAliasName, pRole.PreRoleAliasName)
-		}
-	}
 
-	if err = nRepo.GrantRoleWithIds(ctx, target, nIds...); err != nil {
+	if err = nRepo.AddRoleMutex(ctx, role.Id, mutexIds); err != nil {
 		return err
 	}
 
@@ -1861,14 +5025,10 @@ func (this *Service) GrantRoleWithId(ctx int64, target string, roleIds ...int64)
 	return nil
 }
 
-// ReGrantRole 授权角色给 target，会将原有的角色授权先取消掉
-func (this *Service) ReGrantRole(ctx int64, target string, roleNames ...string) (err error) {
-	if len(roleNames) == 0 {
-		return ErrRoleNotExist
-	}
-
-	if target == "" {
-		return ErrTargetNotAllowed
+// AddRoleMutexWithId 添加角色互斥关系
+func (this *Service) AddRoleMutexWithId(ctx, roleId int64, mutexRoleIds ...int64) (err error) {
+	if len(mutexRoleIds) == 0 {
+		return ErrMutexRoleNotExist
 	}
 
 	var tx, nRepo = this.repo.BeginTx()
@@ -1878,46 +5038,34 @@ func (this *Service) ReGrantRole(ctx int64, target string, roleNames ...string)
 		}
 	}()
 
-	roleList, err := nRepo.GetRolesWithNames(ctx, roleNames...)
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithId(ctx, roleId)
 	if err != nil {
 		return err
 	}
-
-	var nIds = make([]int64, 0, len(roleList))
-	var gIdm = make(map[int64]struct{})
-	for _, role := range roleList {
-		nIds = append(nIds, role.Id)
-		gIdm[role.Id] = struct{}{}
-	}
-	if len(nIds) == 0 {
-		return ErrGrantFailed
+	if role == nil {
+		return ErrRoleNotExist
 	}
 
-	// 获取并验证互斥关系
-	mutexRoleList, err := nRepo.GetMutexRolesWithIds(ctx, nIds)
+	mutexRoleList, err := nRepo.GetRolesWithIds(ctx, mutexRoleIds...)
 	if err != nil {
 		return err
 	}
-	for _, role := range mutexRoleList {
-		return fmt.Errorf("角色 %s 与角色 %s 互斥", role.RoleAliasName, role.MutexRoleAliasName)
-	}
 
-	// 获取并验证所有角色所需要的角色先决条件
-	preRoleList, err := nRepo.GetPreRolesWithIds(ctx, nIds)
-	if err != nil {
-		return err
+	var mutexIds = make([]int64, 0, len(mutexRoleList))
+	for _, role := range mutexRoleList {
+		mutexIds = append(mutexIds, role.Id)
 	}
-	for _, pRole := range preRoleList {
-		if _, ok := gIdm[pRole.PreRoleId]; ok == false {
-			return fmt.Errorf("授予角色 %s 时需要先授予角色 %s", pRole.RoleAliasName, pRole.PreRoleAliasName)
-		}
+	if len(mutexIds) == 0 {
+		return ErrMutexRoleNotExist
 	}
 
-	if err = nRepo.RevokeAllRole(ctx, target); err != nil {
+	// 验证互斥关系是否与先决条件冲突
+	if err = this.checkRoleMutexConflict(ctx, nRepo, role, mutexIds); err != nil {
 		return err
 	}
 
-	if err = nRepo.GrantRoleWithIds(ctx, target, nIds...); err != nil {
+	if err = nRepo.AddRoleMutex(ctx, role.Id, mutexIds); err != nil {
 		return err
 	}
 
@@ -1925,14 +5073,10 @@ func (this *Service) ReGrantRole(ctx int64, target string, roleNames ...string)
 	return nil
 }
 
-// ReGrantRoleWithId 授权角色给 target，会将原有的角色授权先取消掉
-func (this *Service) ReGrantRoleWithId(ctx int64, target string, roleIds ...int64) (err error) {
-	if len(roleIds) == 0 {
-		return ErrRoleNotExist
-	}
-
-	if target == "" {
-		return ErrTargetNotAllowed
+// RemoveRoleMutex 删除角色互斥关系
+func (this *Service) RemoveRoleMutex(ctx int64, roleName string, mutexRoleNames ...string) (err error) {
+	if len(mutexRoleNames) == 0 {
+		return ErrMutexRoleNotExist
 	}
 
 	var tx, nRepo = this.repo.BeginTx()
@@ -1942,46 +5086,29 @@ func (this *Service) ReGrantRoleWithId(ctx int64, target string, roleIds ...int6
 		}
 	}()
 
-	roleList, err := nRepo.GetRolesWithIds(ctx, roleIds...)
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
 	if err != nil {
 		return err
 	}
-
-	var nIds = make([]int64, 0, len(roleList))
-	var gIdm = make(map[int64]struct{})
-	for _, role := range roleList {
-		nIds = append(nIds, role.Id)
-		gIdm[role.Id] = struct{}{}
-	}
-	if len(nIds) == 0 {
-		return ErrGrantFailed
+	if role == nil {
+		return ErrRoleNotExist
 	}
 
-	// 获取并验证互斥关系
-	mutexRoleList, err := nRepo.GetMutexRolesWithIds(ctx, nIds)
+	mutexRoleList, err := nRepo.GetRolesWithNames(ctx, mutexRoleNames...)
 	if err != nil {
 		return err
 	}
-	for _, role := range mutexRoleList {
-		return fmt.Errorf("角色 %s 与角色 %s 互斥", role.RoleAliasName, role.MutexRoleAliasName)
-	}
 
-	// 获取并验证所有角色所需要的角色先决条件
-	preRoleList, err := nRepo.GetPreRolesWithIds(ctx, nIds)
-	if err != nil {
-		return err
-	}
-	for _, pRole := range preRoleList {
-		if _, ok := gIdm[pRole.PreRoleId]; ok == false {
-			return fmt.Errorf("授予角色 %s 时需要先授予角色 %s", pRole.RoleAliasName, pRole.PreRoleAliasName)
-		}
+	var mutexIds = make([]int64, 0, len(mutexRoleList))
+	for _, role := range mutexRoleList {
+		mutexIds = append(mutexIds, role.Id)
 	}
-
-	if err = nRepo.RevokeAllRole(ctx, target); err != nil {
-		return err
+	if len(mutexIds) == 0 {
+		return ErrMutexRoleNotExist
 	}
 
-	if err = nRepo.GrantRoleWithIds(ctx, target, nIds...); err != nil {
+	if err = nRepo.RemoveRoleMutex(ctx, role.Id, mutexIds); err != nil {
 		return err
 	}
 
@@ -1989,14 +5116,10 @@ func (this *Service) ReGrantRoleWithId(ctx int64, target string, roleIds ...int6
 	return nil
 }
 
-// RevokeRole 取消对 target 的角色授权
-func (this *Service) RevokeRole(ctx int64, target string, roleNames ...string) (err error) {
-	if len(roleNames) == 0 {
-		return ErrRoleNotExist
-	}
-
-	if target == "" {
-		return ErrTargetNotAllowed
+// RemoveRoleMutexWithId 删除角色互斥关系
+func (this *Service) RemoveRoleMutexWithId(ctx, roleId int64, mutexRoleIds ...int64) (err error) {
+	if len(mutexRoleIds) == 0 {
+		return ErrMutexRoleNotExist
 	}
 
 	var tx, nRepo = this.repo.BeginTx()
@@ -2006,63 +5129,96 @@ func (this *Service) RevokeRole(ctx int64, target string, roleNames ...string) (
 		}
 	}()
 
-	rRoleList, err := nRepo.GetRolesWithNames(ctx, roleNames...)
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithId(ctx, roleId)
 	if err != nil {
 		return err
 	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
 
-	var rIds = make([]int64, 0, len(rRoleList))
-	for _, role := range rRoleList {
-		rIds = append(rIds, role.Id)
+	mutexRoleList, err := nRepo.GetRolesWithIds(ctx, mutexRoleIds...)
+	if err != nil {
+		return err
 	}
-	if len(rIds) == 0 {
-		return ErrGrantFailed
+
+	var mutexIds = make([]int64, 0, len(mutexRoleList))
+	for _, role := range mutexRoleList {
+		mutexIds = append(mutexIds, role.Id)
+	}
+	if len(mutexIds) == 0 {
+		return ErrMutexRoleNotExist
 	}
 
-	if err = nRepo.RevokeRoleWithIds(ctx, target, rIds...); err != nil {
+	if err = nRepo.RemoveRoleMutex(ctx, role.Id, mutexIds); err != nil {
 		return err
 	}
 
-	var gIds = make([]int64, 0, len(rRoleList))
-	var gIdm = make(map[int64]struct{})
+	tx.Commit()
+	return nil
+}
 
-	// 查询出已授予给 target 的角色
-	grantedRoleList, err := nRepo.GetGrantedRoles(ctx, target, false)
+// RemoveAllRoleMutex 删除该角色所有的互斥关系
+func (this *Service) RemoveAllRoleMutex(ctx int64, roleName string) (err error) {
+	// 验证角色是否存在
+	role, err := this.repo.GetRoleWithName(ctx, roleName)
 	if err != nil {
 		return err
 	}
-	for _, role := range grantedRoleList {
-		gIds = append(gIds, role.Id)
-		gIdm[role.Id] = struct{}{}
+	if role == nil {
+		return ErrRoleNotExist
 	}
+	return this.repo.CleanRoleMutex(ctx, role.Id)
+}
 
-	// 获取并验证所有角色所需要的角色先决条件
-	if len(gIds) > 0 {
-		preRoleList, err := nRepo.GetPreRolesWithIds(ctx, gIds)
-		if err != nil {
-			return err
-		}
-		for _, pRole := range preRoleList {
-			if _, ok := gIdm[pRole.PreRoleId]; ok == false {
-				return fmt.Errorf("角色 %s 依赖于角色 %s", pRole.RoleAliasName, pRole.PreRoleAliasName)
-			}
-		}
+// RemoveAllRoleMutexWithId 删除该角色所有的互斥关系
+func (this *Service) RemoveAllRoleMutexWithId(ctx, roleId int64) (err error) {
+	// 验证角色是否存在
+	role, err := this.repo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return err
 	}
-
-	tx.Commit()
-	return nil
+	if role == nil {
+		return ErrRoleNotExist
+	}
+	return this.repo.CleanRoleMutex(ctx, role.Id)
 }
 
-// RevokeRoleWithId 取消对 target 的角色授权
-func (this *Service) RevokeRoleWithId(ctx int64, target string, roleIds ...int64) (err error) {
-	if len(roleIds) == 0 {
-		return ErrRoleNotExist
+// GetMutexRoles 获取与该角色互斥的角色列表
+func (this *Service) GetMutexRoles(ctx int64, roleName string) (result []*RoleMutex, err error) {
+	// 验证角色是否存在
+	role, err := this.repo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, ErrRoleNotExist
 	}
+	return this.repo.GetMutexRoles(ctx, role.Id)
+}
 
-	if target == "" {
-		return ErrTargetNotAllowed
+// GetMutexRolesWithId 获取与该角色互斥的角色列表
+func (this *Service) GetMutexRolesWithId(ctx, roleId int64) (result []*RoleMutex, err error) {
+	// 验证角色是否存在
+	role, err := this.repo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, ErrRoleNotExist
 	}
+	return this.repo.GetMutexRoles(ctx, role.Id)
+}
 
+// CheckRoleMutex 验证两个角色是否互斥
+func (this *Service) CheckRoleMutex(ctx int64, roleName, mutexRoleName string) bool {
+	ok, err := this.CheckRoleMutexE(ctx, roleName, mutexRoleName)
+	return this.checkResult(ok, err, true)
+}
+
+// CheckRoleMutexE 验证两个角色是否互斥，访问数据库出错时返回错误
+func (this *Service) CheckRoleMutexE(ctx int64, roleName, mutexRoleName string) (ok bool, err error) {
 	var tx, nRepo = this.repo.BeginTx()
 	defer func() {
 		if err != nil {
@@ -2070,73 +5226,54 @@ func (this *Service) RevokeRoleWithId(ctx int64, target string, roleIds ...int64
 		}
 	}()
 
-	rRoleList, err := nRepo.GetRolesWithIds(ctx, roleIds...)
+	// 验证角色是否存在
+	role, err := nRepo.GetRoleWithName(ctx, roleName)
 	if err != nil {
-		return err
-	}
-
-	var rIds = make([]int64, 0, len(rRoleList))
-	for _, role := range rRoleList {
-		rIds = append(rIds, role.Id)
-	}
-	if len(rIds) == 0 {
-		return ErrGrantFailed
+		return false, err
 	}
-
-	if err = nRepo.RevokeRoleWithIds(ctx, target, rIds...); err != nil {
-		return err
+	if role == nil {
+		tx.Rollback()
+		return false, nil
 	}
 
-	var gIds = make([]int64, 0, len(rRoleList))
-	var gIdm = make(map[int64]struct{})
-
-	// 查询出已授予给 target 的角色
-	grantedRoleList, err := nRepo.GetGrantedRoles(ctx, target, false)
+	// 验证角色是否存在
+	mutexRole, err := nRepo.GetRoleWithName(ctx, mutexRoleName)
 	if err != nil {
-		return err
+		return false, err
 	}
-	for _, role := range grantedRoleList {
-		gIds = append(gIds, role.Id)
-		gIdm[role.Id] = struct{}{}
+	if mutexRole == nil {
+		tx.Rollback()
+		return false, nil
 	}
 
-	// 获取并验证所有角色所需要的角色先决条件
-	if len(gIds) > 0 {
-		preRoleList, err := nRepo.GetPreRolesWithIds(ctx, gIds)
-		if err != nil {
-			return err
-		}
-		for _, pRole := range preRoleList {
-			if _, ok := gIdm[pRole.PreRoleId]; ok == false {
-				return fmt.Errorf("角色 %s 依赖于角色 %s", pRole.RoleAliasName, pRole.PreRoleAliasName)
-			}
-		}
+	if ok, err = nRepo.CheckRoleMutexE(ctx, role.Id, mutexRole.Id); err != nil {
+		return false, err
 	}
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
 
-	tx.Commit()
-	return nil
+// CheckRoleMutexWithId 验证两个角色是否互斥
+func (this *Service) CheckRoleMutexWithId(ctx, roleId, mutexRoleId int64) bool {
+	ok, err := this.CheckRoleMutexWithIdE(ctx, roleId, mutexRoleId)
+	return this.checkResult(ok, err, true)
 }
 
-// RevokeAllRole 取消对 target 的所有角色授权
-func (this *Service) RevokeAllRole(ctx int64, target string) (err error) {
-	return this.repo.RevokeAllRole(ctx, target)
+// CheckRoleMutexWithIdE 验证两个角色是否互斥，访问数据库出错时返回错误
+func (this *Service) CheckRoleMutexWithIdE(ctx, roleId, mutexRoleId int64) (bool, error) {
+	return this.repo.CheckRoleMutexE(ctx, roleId, mutexRoleId)
 }
 
-// AddRoleMutex 添加角色互斥关系
-func (this *Service) AddRoleMutex(ctx int64, roleName string, mutexRoleNames ...string) (err error) {
+// AddRoleDynamicMutex 添加角色动态互斥关系，target 可以同时拥有动态互斥的角色，但是不能在同一个会话中同时激活它们
+func (this *Service) AddRoleDynamicMutex(ctx int64, roleName string, mutexRoleNames ...string) (err error) {
 	if len(mutexRoleNames) == 0 {
 		return ErrMutexRoleNotExist
 	}
 
-	var tx, nRepo = this.repo.BeginTx()
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
 	// 验证角色是否存在
-	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	role, err := this.repo.GetRoleWithName(ctx, roleName)
 	if err != nil {
 		return err
 	}
@@ -2144,7 +5281,7 @@ func (this *Service) AddRoleMutex(ctx int64, roleName string, mutexRoleNames ...
 		return ErrRoleNotExist
 	}
 
-	mutexRoleList, err := nRepo.GetRolesWithNames(ctx, mutexRoleNames...)
+	mutexRoleList, err := this.repo.GetRolesWithNames(ctx, mutexRoleNames...)
 	if err != nil {
 		return err
 	}
@@ -2156,30 +5293,17 @@ func (this *Service) AddRoleMutex(ctx int64, roleName string, mutexRoleNames ...
 	if len(mutexIds) == 0 {
 		return ErrMutexRoleNotExist
 	}
-
-	if err = nRepo.AddRoleMutex(ctx, role.Id, mutexIds); err != nil {
-		return err
-	}
-
-	tx.Commit()
-	return nil
+	return this.repo.AddRoleDynamicMutex(ctx, role.Id, mutexIds)
 }
 
-// AddRoleMutexWithId 添加角色互斥关系
-func (this *Service) AddRoleMutexWithId(ctx, roleId int64, mutexRoleIds ...int64) (err error) {
+// AddRoleDynamicMutexWithId 添加角色动态互斥关系，target 可以同时拥有动态互斥的角色，但是不能在同一个会话中同时激活它们
+func (this *Service) AddRoleDynamicMutexWithId(ctx, roleId int64, mutexRoleIds ...int64) (err error) {
 	if len(mutexRoleIds) == 0 {
 		return ErrMutexRoleNotExist
 	}
 
-	var tx, nRepo = this.repo.BeginTx()
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
 	// 验证角色是否存在
-	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	role, err := this.repo.GetRoleWithId(ctx, roleId)
 	if err != nil {
 		return err
 	}
@@ -2187,7 +5311,7 @@ func (this *Service) AddRoleMutexWithId(ctx, roleId int64, mutexRoleIds ...int64
 		return ErrRoleNotExist
 	}
 
-	mutexRoleList, err := nRepo.GetRolesWithIds(ctx, mutexRoleIds...)
+	mutexRoleList, err := this.repo.GetRolesWithIds(ctx, mutexRoleIds...)
 	if err != nil {
 		return err
 	}
@@ -2199,30 +5323,17 @@ func (this *Service) AddRoleMutexWithId(ctx, roleId int64, mutexRoleIds ...int64
 	if len(mutexIds) == 0 {
 		return ErrMutexRoleNotExist
 	}
-
-	if err = nRepo.AddRoleMutex(ctx, role.Id, mutexIds); err != nil {
-		return err
-	}
-
-	tx.Commit()
-	return nil
+	return this.repo.AddRoleDynamicMutex(ctx, role.Id, mutexIds)
 }
 
-// RemoveRoleMutex 删除角色互斥关系
-func (this *Service) RemoveRoleMutex(ctx int64, roleName string, mutexRoleNames ...string) (err error) {
+// RemoveRoleDynamicMutex 删除角色动态互斥关系
+func (this *Service) RemoveRoleDynamicMutex(ctx int64, roleName string, mutexRoleNames ...string) (err error) {
 	if len(mutexRoleNames) == 0 {
 		return ErrMutexRoleNotExist
 	}
 
-	var tx, nRepo = this.repo.BeginTx()
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
 	// 验证角色是否存在
-	role, err := nRepo.GetRoleWithName(ctx, roleName)
+	role, err := this.repo.GetRoleWithName(ctx, roleName)
 	if err != nil {
 		return err
 	}
@@ -2230,7 +5341,7 @@ func (this *Service) RemoveRoleMutex(ctx int64, roleName string, mutexRoleNames
 		return ErrRoleNotExist
 	}
 
-	mutexRoleList, err := nRepo.GetRolesWithNames(ctx, mutexRoleNames...)
+	mutexRoleList, err := this.repo.GetRolesWithNames(ctx, mutexRoleNames...)
 	if err != nil {
 		return err
 	}
@@ -2242,30 +5353,17 @@ func (this *Service) RemoveRoleMutex(ctx int64, roleName string, mutexRoleNames
 	if len(mutexIds) == 0 {
 		return ErrMutexRoleNotExist
 	}
-
-	if err = nRepo.RemoveRoleMutex(ctx, role.Id, mutexIds); err != nil {
-		return err
-	}
-
-	tx.Commit()
-	return nil
+	return this.repo.RemoveRoleDynamicMutex(ctx, role.Id, mutexIds)
 }
 
-// RemoveRoleMutexWithId 删除角色互斥关系
-func (this *Service) RemoveRoleMutexWithId(ctx, roleId int64, mutexRoleIds ...int64) (err error) {
+// RemoveRoleDynamicMutexWithId 删除角色动态互斥关系
+func (this *Service) RemoveRoleDynamicMutexWithId(ctx, roleId int64, mutexRoleIds ...int64) (err error) {
 	if len(mutexRoleIds) == 0 {
 		return ErrMutexRoleNotExist
 	}
 
-	var tx, nRepo = this.repo.BeginTx()
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
 	// 验证角色是否存在
-	role, err := nRepo.GetRoleWithId(ctx, roleId)
+	role, err := this.repo.GetRoleWithId(ctx, roleId)
 	if err != nil {
 		return err
 	}
@@ -2273,7 +5371,7 @@ func (this *Service) RemoveRoleMutexWithId(ctx, roleId int64, mutexRoleIds ...in
 		return ErrRoleNotExist
 	}
 
-	mutexRoleList, err := nRepo.GetRolesWithIds(ctx, mutexRoleIds...)
+	mutexRoleList, err := this.repo.GetRolesWithIds(ctx, mutexRoleIds...)
 	if err != nil {
 		return err
 	}
@@ -2285,17 +5383,11 @@ func (this *Service) RemoveRoleMutexWithId(ctx, roleId int64, mutexRoleIds ...in
 	if len(mutexIds) == 0 {
 		return ErrMutexRoleNotExist
 	}
-
-	if err = nRepo.RemoveRoleMutex(ctx, role.Id, mutexIds); err != nil {
-		return err
-	}
-
-	tx.Commit()
-	return nil
+	return this.repo.RemoveRoleDynamicMutex(ctx, role.Id, mutexIds)
 }
 
-// RemoveAllRoleMutex 删除该角色所有的互斥关系
-func (this *Service) RemoveAllRoleMutex(ctx int64, roleName string) (err error) {
+// RemoveAllRoleDynamicMutex 删除该角色所有的动态互斥关系
+func (this *Service) RemoveAllRoleDynamicMutex(ctx int64, roleName string) (err error) {
 	// 验证角色是否存在
 	role, err := this.repo.GetRoleWithName(ctx, roleName)
 	if err != nil {
@@ -2304,11 +5396,11 @@ func (this *Service) RemoveAllRoleMutex(ctx int64, roleName string) (err error)
 	if role == nil {
 		return ErrRoleNotExist
 	}
-	return this.repo.CleanRoleMutex(ctx, role.Id)
+	return this.repo.CleanRoleDynamicMutex(ctx, role.Id)
 }
 
-// RemoveAllRoleMutexWithId 删除该角色所有的互斥关系
-func (this *Service) RemoveAllRoleMutexWithId(ctx, roleId int64) (err error) {
+// RemoveAllRoleDynamicMutexWithId 删除该角色所有的动态互斥关系
+func (this *Service) RemoveAllRoleDynamicMutexWithId(ctx, roleId int64) (err error) {
 	// 验证角色是否存在
 	role, err := this.repo.GetRoleWithId(ctx, roleId)
 	if err != nil {
@@ -2317,11 +5409,11 @@ func (this *Service) RemoveAllRoleMutexWithId(ctx, roleId int64) (err error) {
 	if role == nil {
 		return ErrRoleNotExist
 	}
-	return this.repo.CleanRoleMutex(ctx, role.Id)
+	return this.repo.CleanRoleDynamicMutex(ctx, role.Id)
 }
 
-// GetMutexRoles 获取与该角色互斥的角色列表
-func (this *Service) GetMutexRoles(ctx int64, roleName string) (result []*RoleMutex, err error) {
+// GetDynamicMutexRoles 获取与该角色动态互斥的角色列表
+func (this *Service) GetDynamicMutexRoles(ctx int64, roleName string) (result []*RoleMutex, err error) {
 	// 验证角色是否存在
 	role, err := this.repo.GetRoleWithName(ctx, roleName)
 	if err != nil {
@@ -2330,11 +5422,11 @@ func (this *Service) GetMutexRoles(ctx int64, roleName string) (result []*RoleMu
 	if role == nil {
 		return nil, ErrRoleNotExist
 	}
-	return this.repo.GetMutexRoles(ctx, role.Id)
+	return this.repo.GetDynamicMutexRoles(ctx, role.Id)
 }
 
-// GetMutexRolesWithId 获取与该角色互斥的角色列表
-func (this *Service) GetMutexRolesWithId(ctx, roleId int64) (result []*RoleMutex, err error) {
+// GetDynamicMutexRolesWithId 获取与该角色动态互斥的角色列表
+func (this *Service) GetDynamicMutexRolesWithId(ctx, roleId int64) (result []*RoleMutex, err error) {
 	// 验证角色是否存在
 	role, err := this.repo.GetRoleWithId(ctx, roleId)
 	if err != nil {
@@ -2343,45 +5435,224 @@ func (this *Service) GetMutexRolesWithId(ctx, roleId int64) (result []*RoleMutex
 	if role == nil {
 		return nil, ErrRoleNotExist
 	}
-	return this.repo.GetMutexRoles(ctx, role.Id)
+	return this.repo.GetDynamicMutexRoles(ctx, role.Id)
 }
 
-// CheckRoleMutex 验证两个角色是否互斥
-func (this *Service) CheckRoleMutex(ctx int64, roleName, mutexRoleName string) bool {
-	var tx, nRepo = this.repo.BeginTx()
-	var err error
-	defer func() {
-		if err != nil {
-			tx.Rollback()
+// OpenSession 为 target 创建会话并激活角色 activeRoles，激活的角色需要已经授予给 target，并且相互之间不能存在动态互斥关系
+//
+// 会话不会被持久化，由调用方负责保存，之后使用 CheckSessionPermission 验证权限时只考虑会话中已激活的角色
+func (this *Service) OpenSession(ctx int64, target string, activeRoles ...string) (result *Session, err error) {
+	if target == "" {
+		return nil, ErrTargetNotAllowed
+	}
+
+	var now = time.Now()
+	var session = &Session{Ctx: ctx, Target: target, CreatedOn: &now}
+	if len(activeRoles) > 0 {
+		if err = this.ActivateSessionRole(session, activeRoles...); err != nil {
+			return nil, err
 		}
-	}()
+	}
+	return session, nil
+}
 
-	// 验证角色是否存在
-	role, err := nRepo.GetRoleWithName(ctx, roleName)
+// OpenSessionWithId 为 target 创建会话并激活角色 activeRoleIds，激活的角色需要已经授予给 target，并且相互之间不能存在动态互斥关系
+func (this *Service) OpenSessionWithId(ctx int64, target string, activeRoleIds ...int64) (result *Session, err error) {
+	if target == "" {
+		return nil, ErrTargetNotAllowed
+	}
+
+	var now = time.Now()
+	var session = &Session{Ctx: ctx, Target: target, CreatedOn: &now}
+	if len(activeRoleIds) > 0 {
+		if err = this.ActivateSessionRoleWithId(session, activeRoleIds...); err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// ActivateSessionRole 在会话中激活角色，激活的角色需要已经授予给 target，并且与会话中已激活的角色之间不能存在动态互斥关系
+func (this *Service) ActivateSessionRole(session *Session, roleNames ...string) (err error) {
+	if session == nil || session.Target == "" {
+		return ErrInvalidSession
+	}
+	if len(roleNames) == 0 {
+		return ErrRoleNotExist
+	}
+
+	roleList, err := this.repo.GetRolesWithNames(session.Ctx, roleNames...)
 	if err != nil {
-		return true
+		return err
 	}
-	if role == nil {
-		return false
+	return this.activateSessionRole(session, roleList)
+}
+
+// ActivateSessionRoleWithId 在会话中激活角色，激活的角色需要已经授予给 target，并且与会话中已激活的角色之间不能存在动态互斥关系
+func (this *Service) ActivateSessionRoleWithId(session *Session, roleIds ...int64) (err error) {
+	if session == nil || session.Target == "" {
+		return ErrInvalidSession
+	}
+	if len(roleIds) == 0 {
+		return ErrRoleNotExist
 	}
 
-	// 验证角色是否存在
-	mutexRole, err := nRepo.GetRoleWithName(ctx, mutexRoleName)
+	roleList, err := this.repo.GetRolesWithIds(session.Ctx, roleIds...)
 	if err != nil {
-		return true
+		return err
 	}
-	if mutexRole == nil {
-		return false
+	return this.activateSessionRole(session, roleList)
+}
+
+func (this *Service) activateSessionRole(session *Session, roleList []*Role) (err error) {
+	if len(roleList) == 0 {
+		return ErrRoleNotExist
 	}
 
-	var ok = nRepo.CheckRoleMutex(ctx, role.Id, mutexRole.Id)
-	tx.Commit()
-	return ok
+	grantedRoleList, err := this.repo.GetGrantedRoles(session.Ctx, session.Target, false)
+	if err != nil {
+		return err
+	}
+	var grantedIdm = make(map[int64]struct{}, len(grantedRoleList))
+	for _, role := range grantedRoleList {
+		grantedIdm[role.Id] = struct{}{}
+	}
+
+	var aIds = session.RoleIds()                    // 本次激活的角色 id 加上原来已激活的角色 id 列表
+	var aIdm = make(map[int64]struct{})             // 本次激活的角色 id 加上原来已激活的角色 id 组成的 map
+	var nRoleList = make([]*Role, 0, len(roleList)) // 本次新激活的角色列表
+	for _, id := range aIds {
+		aIdm[id] = struct{}{}
+	}
+	for _, role := range roleList {
+		if _, ok := grantedIdm[role.Id]; ok == false {
+			return ErrRoleNotGranted
+		}
+		if _, ok := aIdm[role.Id]; ok {
+			continue
+		}
+		aIdm[role.Id] = struct{}{}
+		aIds = append(aIds, role.Id)
+		nRoleList = append(nRoleList, role)
+	}
+	if len(nRoleList) == 0 {
+		return nil
+	}
+
+	// 获取并验证动态互斥关系
+	mutexRoleList, err := this.repo.GetDynamicMutexRolesWithIds(session.Ctx, aIds)
+	if err != nil {
+		return err
+	}
+	for _, role := range mutexRoleList {
+		return newRoleMutexError(role, true)
+	}
+
+	session.RoleList = append(session.RoleList, nRoleList...)
+	return nil
 }
 
-// CheckRoleMutexWithId 验证两个角色是否互斥
-func (this *Service) CheckRoleMutexWithId(ctx, roleId, mutexRoleId int64) bool {
-	return this.repo.CheckRoleMutex(ctx, roleId, mutexRoleId)
+// DeactivateSessionRole 在会话中取消激活角色
+func (this *Service) DeactivateSessionRole(session *Session, roleNames ...string) (err error) {
+	if session == nil || session.Target == "" {
+		return ErrInvalidSession
+	}
+
+	var nm = make(map[string]struct{}, len(roleNames))
+	for _, name := range roleNames {
+		nm[name] = struct{}{}
+	}
+	var roleList = make([]*Role, 0, len(session.RoleList))
+	for _, role := range session.RoleList {
+		if _, ok := nm[role.Name]; ok {
+			continue
+		}
+		roleList = append(roleList, role)
+	}
+	session.RoleList = roleList
+	return nil
+}
+
+// DeactivateSessionRoleWithId 在会话中取消激活角色
+func (this *Service) DeactivateSessionRoleWithId(session *Session, roleIds ...int64) (err error) {
+	if session == nil || session.Target == "" {
+		return ErrInvalidSession
+	}
+
+	var idm = make(map[int64]struct{}, len(roleIds))
+	for _, id := range roleIds {
+		idm[id] = struct{}{}
+	}
+	var roleList = make([]*Role, 0, len(session.RoleList))
+	for _, role := range session.RoleList {
+		if _, ok := idm[role.Id]; ok {
+			continue
+		}
+		roleList = append(roleList, role)
+	}
+	session.RoleList = roleList
+	return nil
+}
+
+// CheckSessionPermission 验证会话是否拥有指定权限，只考虑会话中已激活并且仍然授予给 target 的角色
+//
+// 会话由调用方保存，每次验证时都会重新检查会话中已激活的角色之间是否存在动态互斥关系，存在时返回 false；
+// 禁止权限对 target 拥有的所有角色生效，与角色是否已激活无关
+func (this *Service) CheckSessionPermission(session *Session, permissionName string) bool {
+	ok, err := this.CheckSessionPermissionE(session, permissionName)
+	return this.checkSessionResult(ok, err)
+}
+
+// CheckSessionPermissionE 与 CheckSessionPermission 相同，会话无效时返回 ErrInvalidSession，会话中的角色动态互斥时返回 *RoleMutexError，访问数据库或者缓存出错时返回对应的错误
+func (this *Service) CheckSessionPermissionE(session *Session, permissionName string) (bool, error) {
+	if err := this.checkSession(session); err != nil {
+		return false, err
+	}
+	return this.repo.CheckSessionPermissionE(session.Ctx, session.Target, session.RoleIds(), permissionName)
+}
+
+// CheckSessionPermissionWithId 验证会话是否拥有指定权限，只考虑会话中已激活并且仍然授予给 target 的角色
+func (this *Service) CheckSessionPermissionWithId(session *Session, permissionId int64) bool {
+	ok, err := this.CheckSessionPermissionWithIdE(session, permissionId)
+	return this.checkSessionResult(ok, err)
+}
+
+// CheckSessionPermissionWithIdE 与 CheckSessionPermissionWithId 相同，错误的含义参考 CheckSessionPermissionE
+func (this *Service) CheckSessionPermissionWithIdE(session *Session, permissionId int64) (bool, error) {
+	if err := this.checkSession(session); err != nil {
+		return false, err
+	}
+	return this.repo.CheckSessionPermissionWithIdE(session.Ctx, session.Target, session.RoleIds(), permissionId)
+}
+
+// checkSessionResult 会话无效或者会话中的角色动态互斥属于验证失败，不受处理策略影响，其它错误根据处理策略得出验证结果
+func (this *Service) checkSessionResult(ok bool, err error) bool {
+	if err == ErrInvalidSession {
+		return false
+	}
+	if _, mutex := err.(*RoleMutexError); mutex {
+		return false
+	}
+	return this.checkResult(ok, err, false)
+}
+
+// checkSession 验证会话是否有效，会话可能是反序列化得到的，也可能是在添加动态互斥关系之前创建的，所以需要重新验证动态互斥关系
+func (this *Service) checkSession(session *Session) (err error) {
+	if session == nil || session.Target == "" {
+		return ErrInvalidSession
+	}
+	var roleIds = session.RoleIds()
+	if len(roleIds) < 2 {
+		return nil
+	}
+	mutexRoleList, err := this.repo.GetDynamicMutexRolesWithIds(session.Ctx, roleIds)
+	if err != nil {
+		return err
+	}
+	for _, role := range mutexRoleList {
+		return newRoleMutexError(role, true)
+	}
+	return nil
 }
 
 // AddPreRole 添加授予该角色时需要的先决条件
@@ -2412,13 +5683,23 @@ func (this *Service) AddPreRole(ctx int64, roleName string, preRoleNames ...stri
 	}
 
 	var preIds = make([]int64, 0, len(preRoleList))
-	for _, role := range preRoleList {
-		preIds = append(preIds, role.Id)
+	var preEdges = make([][2]int64, 0, len(preRoleList))
+	for _, pre := range preRoleList {
+		preIds = append(preIds, pre.Id)
+		preEdges = append(preEdges, [2]int64{role.Id, pre.Id})
 	}
 	if len(preIds) == 0 {
 		return ErrPreRoleNotExist
 	}
 
+	// 验证先决条件是否会形成循环依赖以及是否与互斥关系冲突
+	if err = this.checkPreRoleCycle(ctx, nRepo, role, preRoleList); err != nil {
+		return err
+	}
+	if err = this.checkRoleConflict(ctx, nRepo, []int64{role.Id}, preEdges, nil); err != nil {
+		return err
+	}
+
 	if err = nRepo.AddPreRole(ctx, role.Id, preIds); err != nil {
 		return err
 	}
@@ -2454,14 +5735,24 @@ func (this *Service) AddPreRoleWithId(ctx, roleId int64, preRoleIds ...int64) (e
 		return err
 	}
 
-	var preIds = make([]int64, 0, len(preRoleList))
-	for _, role := range preRoleList {
-		preIds = append(preIds, role.Id)
+	var preIds = make([]int64, 0, len(preRoleList))
+	var preEdges = make([][2]int64, 0, len(preRoleList))
+	for _, pre := range preRoleList {
+		preIds = append(preIds, pre.Id)
+		preEdges = append(preEdges, [2]int64{role.Id, pre.Id})
 	}
 	if len(preIds) == 0 {
 		return ErrPreRoleNotExist
 	}
 
+	// 验证先决条件是否会形成循环依赖以及是否与互斥关系冲突
+	if err = this.checkPreRoleCycle(ctx, nRepo, role, preRoleList); err != nil {
+		return err
+	}
+	if err = this.checkRoleConflict(ctx, nRepo, []int64{role.Id}, preEdges, nil); err != nil {
+		return err
+	}
+
 	if err = nRepo.AddPreRole(ctx, role.Id, preIds); err != nil {
 		return err
 	}
@@ -2631,24 +5922,67 @@ func (this *Service) GetRolesWithTarget(ctx int64, target string) (result []*Rol
 	return result, nil
 }
 
+// GetRolesWithTargetInPreOrder 与 GetRolesWithTarget 相同，返回的角色列表按照角色树的先序遍历顺序（即 left_value）排序
+func (this *Service) GetRolesWithTargetInPreOrder(ctx int64, target string) (result []*Role, err error) {
+	if result, err = this.GetRolesWithTarget(ctx, target); err != nil {
+		return nil, err
+	}
+	sortRolesInPreOrder(result)
+	return result, nil
+}
+
+// sortRolesInPreOrder 将角色列表按照角色树的先序遍历顺序排序
+func sortRolesInPreOrder(roleList []*Role) {
+	sort.SliceStable(roleList, func(i, j int) bool {
+		if roleList[i].Ctx != roleList[j].Ctx {
+			return roleList[i].Ctx < roleList[j].Ctx
+		}
+		return roleList[i].LeftValue < roleList[j].LeftValue
+	})
+}
+
 // CheckRole 验证 target 是否拥有指定角色
 func (this *Service) CheckRole(ctx int64, target string, roleName string) bool {
-	return this.repo.CheckRole(ctx, target, roleName)
+	ok, err := this.CheckRoleE(ctx, target, roleName)
+	return this.checkResult(ok, err, false)
+}
+
+// CheckRoleE 验证 target 是否拥有指定角色，访问数据库或者缓存出错时返回错误
+func (this *Service) CheckRoleE(ctx int64, target string, roleName string) (bool, error) {
+	return this.repo.CheckRoleE(ctx, target, roleName)
 }
 
 // CheckRoleWithId 验证 target 是否拥有指定角色
 func (this *Service) CheckRoleWithId(ctx int64, target string, roleId int64) bool {
-	return this.repo.CheckRoleWithId(ctx, target, roleId)
+	ok, err := this.CheckRoleWithIdE(ctx, target, roleId)
+	return this.checkResult(ok, err, false)
+}
+
+// CheckRoleWithIdE 验证 target 是否拥有指定角色，访问数据库或者缓存出错时返回错误
+func (this *Service) CheckRoleWithIdE(ctx int64, target string, roleId int64) (bool, error) {
+	return this.repo.CheckRoleWithIdE(ctx, target, roleId)
 }
 
 // CheckRoleAccessible 验证 target 是否拥有操作访问 roleName 的权限
 func (this *Service) CheckRoleAccessible(ctx int64, target string, roleName string) bool {
-	return this.repo.CheckRoleAccessible(ctx, target, roleName)
+	ok, err := this.CheckRoleAccessibleE(ctx, target, roleName)
+	return this.checkResult(ok, err, false)
+}
+
+// CheckRoleAccessibleE 验证 target 是否拥有操作访问 roleName 的权限，访问数据库或者缓存出错时返回错误
+func (this *Service) CheckRoleAccessibleE(ctx int64, target string, roleName string) (bool, error) {
+	return this.repo.CheckRoleAccessibleE(ctx, target, roleName)
 }
 
 // CheckRoleAccessibleWithId 验证 target 是否拥有操作访问 roleId 的权限
 func (this *Service) CheckRoleAccessibleWithId(ctx int64, target string, roleId int64) bool {
-	return this.repo.CheckRoleAccessibleWithId(ctx, target, roleId)
+	ok, err := this.CheckRoleAccessibleWithIdE(ctx, target, roleId)
+	return this.checkResult(ok, err, false)
+}
+
+// CheckRoleAccessibleWithIdE 验证 target 是否拥有操作访问 roleId 的权限，访问数据库或者缓存出错时返回错误
+func (this *Service) CheckRoleAccessibleWithIdE(ctx int64, target string, roleId int64) (bool, error) {
+	return this.repo.CheckRoleAccessibleWithIdE(ctx, target, roleId)
 }
 
 // GetPermissionsWithRole 获取已授权给 roleName 的权限列表
@@ -2805,27 +6139,456 @@ func (this *Service) GetPermissionsTreeWithRoleId(ctx, roleId int64, status Stat
 	return result, nil
 }
 
+// GetDenies 获取所有的禁止权限信息
+func (this *Service) GetDenies(ctx int64) (result []*Deny, err error) {
+	return this.repo.GetDenies(ctx, "", 0)
+}
+
+// GetTargetDenies 获取禁止 target 使用的权限信息，不包含通过角色禁止的权限
+func (this *Service) GetTargetDenies(ctx int64, target string) (result []*Deny, err error) {
+	if target == "" {
+		return nil, ErrTargetNotAllowed
+	}
+	return this.repo.GetDenies(ctx, target, 0)
+}
+
+// GetRoleDenies 获取禁止角色使用的权限信息
+func (this *Service) GetRoleDenies(ctx int64, roleName string) (result []*Deny, err error) {
+	role, err := this.repo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, ErrRoleNotExist
+	}
+	return this.repo.GetDenies(ctx, "", role.Id)
+}
+
+// GetRoleDeniesWithId 获取禁止角色使用的权限信息
+func (this *Service) GetRoleDeniesWithId(ctx, roleId int64) (result []*Deny, err error) {
+	if roleId <= 0 {
+		return nil, ErrRoleNotExist
+	}
+	return this.repo.GetDenies(ctx, "", roleId)
+}
+
+// AddTargetDeny 禁止 target 使用权限，禁止权限的优先级高于授权，即使 target 通过角色获得了该权限，也无法通过权限验证
+func (this *Service) AddTargetDeny(ctx int64, target string, permissionNames ...string) (err error) {
+	if target == "" {
+		return ErrTargetNotAllowed
+	}
+	pIds, err := this.getPermissionIdsWithNames(ctx, permissionNames)
+	if err != nil {
+		return err
+	}
+	return this.addDeny(ctx, target, 0, pIds)
+}
+
+// AddTargetDenyWithId 禁止 target 使用权限，禁止权限的优先级高于授权，即使 target 通过角色获得了该权限，也无法通过权限验证
+func (this *Service) AddTargetDenyWithId(ctx int64, target string, permissionIds ...int64) (err error) {
+	if target == "" {
+		return ErrTargetNotAllowed
+	}
+	pIds, err := this.getPermissionIdsWithIds(ctx, permissionIds)
+	if err != nil {
+		return err
+	}
+	return this.addDeny(ctx, target, 0, pIds)
+}
+
+// RemoveTargetDeny 取消禁止 target 使用权限
+func (this *Service) RemoveTargetDeny(ctx int64, target string, permissionNames ...string) (err error) {
+	if target == "" {
+		return ErrTargetNotAllowed
+	}
+	pIds, err := this.getPermissionIdsWithNames(ctx, permissionNames)
+	if err != nil {
+		return err
+	}
+	return this.removeDeny(ctx, target, 0, pIds)
+}
+
+// RemoveTargetDenyWithId 取消禁止 target 使用权限
+func (this *Service) RemoveTargetDenyWithId(ctx int64, target string, permissionIds ...int64) (err error) {
+	if target == "" {
+		return ErrTargetNotAllowed
+	}
+	if len(permissionIds) == 0 {
+		return ErrPermissionNotExist
+	}
+	return this.removeDeny(ctx, target, 0, permissionIds)
+}
+
+// AddRoleDeny 禁止拥有角色的 target 使用权限，禁止权限的优先级高于授权，即使 target 通过其它角色获得了该权限，也无法通过权限验证
+func (this *Service) AddRoleDeny(ctx int64, roleName string, permissionNames ...string) (err error) {
+	role, err := this.repo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+	pIds, err := this.getPermissionIdsWithNames(ctx, permissionNames)
+	if err != nil {
+		return err
+	}
+	return this.addDeny(ctx, "", role.Id, pIds)
+}
+
+// AddRoleDenyWithId 禁止拥有角色的 target 使用权限，禁止权限的优先级高于授权，即使 target 通过其它角色获得了该权限，也无法通过权限验证
+func (this *Service) AddRoleDenyWithId(ctx, roleId int64, permissionIds ...int64) (err error) {
+	role, err := this.repo.GetRoleWithId(ctx, roleId)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+	pIds, err := this.getPermissionIdsWithIds(ctx, permissionIds)
+	if err != nil {
+		return err
+	}
+	return this.addDeny(ctx, "", role.Id, pIds)
+}
+
+// RemoveRoleDeny 取消禁止拥有角色的 target 使用权限
+func (this *Service) RemoveRoleDeny(ctx int64, roleName string, permissionNames ...string) (err error) {
+	role, err := this.repo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+	pIds, err := this.getPermissionIdsWithNames(ctx, permissionNames)
+	if err != nil {
+		return err
+	}
+	return this.removeDeny(ctx, "", role.Id, pIds)
+}
+
+// RemoveRoleDenyWithId 取消禁止拥有角色的 target 使用权限
+func (this *Service) RemoveRoleDenyWithId(ctx, roleId int64, permissionIds ...int64) (err error) {
+	if roleId <= 0 {
+		return ErrRoleNotExist
+	}
+	if len(permissionIds) == 0 {
+		return ErrPermissionNotExist
+	}
+	return this.removeDeny(ctx, "", roleId, permissionIds)
+}
+
+func (this *Service) getPermissionIdsWithNames(ctx int64, permissionNames []string) (result []int64, err error) {
+	if len(permissionNames) == 0 {
+		return nil, ErrPermissionNotExist
+	}
+	pList, err := this.repo.GetPermissionsWithNames(ctx, permissionNames...)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pList {
+		result = append(result, p.Id)
+	}
+	if len(result) == 0 {
+		return nil, ErrPermissionNotExist
+	}
+	return result, nil
+}
+
+func (this *Service) getPermissionIdsWithIds(ctx int64, permissionIds []int64) (result []int64, err error) {
+	if len(permissionIds) == 0 {
+		return nil, ErrPermissionNotExist
+	}
+	pList, err := this.repo.GetPermissionsWithIds(ctx, permissionIds...)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pList {
+		result = append(result, p.Id)
+	}
+	if len(result) == 0 {
+		return nil, ErrPermissionNotExist
+	}
+	return result, nil
+}
+
 // CheckPermission 验证 target 是否拥有指定权限
 func (this *Service) CheckPermission(ctx int64, target string, permissionName string) bool {
-	return this.repo.CheckPermission(ctx, target, permissionName)
+	ok, err := this.CheckPermissionE(ctx, target, permissionName)
+	return this.checkResult(ok, err, false)
+}
+
+// CheckPermissionE 验证 target 是否拥有指定权限，访问数据库或者缓存出错时返回错误
+func (this *Service) CheckPermissionE(ctx int64, target string, permissionName string) (bool, error) {
+	return this.repo.CheckPermissionE(ctx, target, permissionName)
 }
 
 // CheckPermissionWithId 验证 target 是否拥有指定权限
 func (this *Service) CheckPermissionWithId(ctx int64, target string, permissionId int64) bool {
-	return this.repo.CheckPermissionWithId(ctx, target, permissionId)
+	ok, err := this.CheckPermissionWithIdE(ctx, target, permissionId)
+	return this.checkResult(ok, err, false)
+}
+
+// CheckPermissionWithIdE 验证 target 是否拥有指定权限，访问数据库或者缓存出错时返回错误
+func (this *Service) CheckPermissionWithIdE(ctx int64, target string, permissionId int64) (bool, error) {
+	return this.repo.CheckPermissionWithIdE(ctx, target, permissionId)
+}
+
+// CheckPermissions 批量验证 target 是否拥有指定权限，返回结果包含所有 permissionNames，只访问一次数据库或者缓存
+//
+// 访问数据库或者缓存出错时根据 UseFailurePolicy 设置的策略得出所有权限的验证结果
+func (this *Service) CheckPermissions(ctx int64, target string, permissionNames ...string) map[string]bool {
+	result, err := this.CheckPermissionsE(ctx, target, permissionNames...)
+	if err != nil {
+		result = make(map[string]bool, len(permissionNames))
+		for _, name := range permissionNames {
+			result[name] = this.checkResult(false, err, false)
+		}
+	}
+	return result
+}
+
+// CheckPermissionsE 批量验证 target 是否拥有指定权限，访问数据库或者缓存出错时返回错误
+func (this *Service) CheckPermissionsE(ctx int64, target string, permissionNames ...string) (map[string]bool, error) {
+	return this.repo.CheckPermissions(ctx, target, permissionNames)
+}
+
+// CheckAnyPermission 验证 target 是否拥有 permissionNames 中的任意一个权限，未指定权限时返回 false
+func (this *Service) CheckAnyPermission(ctx int64, target string, permissionNames ...string) bool {
+	ok, err := this.CheckAnyPermissionE(ctx, target, permissionNames...)
+	return this.checkResult(ok, err, false)
+}
+
+// CheckAnyPermissionE 验证 target 是否拥有 permissionNames 中的任意一个权限，访问数据库或者缓存出错时返回错误
+func (this *Service) CheckAnyPermissionE(ctx int64, target string, permissionNames ...string) (bool, error) {
+	result, err := this.CheckPermissionsE(ctx, target, permissionNames...)
+	if err != nil {
+		return false, err
+	}
+	for _, ok := range result {
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CheckAllPermissions 验证 target 是否拥有 permissionNames 中的所有权限，未指定权限时返回 false
+func (this *Service) CheckAllPermissions(ctx int64, target string, permissionNames ...string) bool {
+	ok, err := this.CheckAllPermissionsE(ctx, target, permissionNames...)
+	return this.checkResult(ok, err, false)
+}
+
+// CheckAllPermissionsE 验证 target 是否拥有 permissionNames 中的所有权限，访问数据库或者缓存出错时返回错误
+func (this *Service) CheckAllPermissionsE(ctx int64, target string, permissionNames ...string) (bool, error) {
+	if len(permissionNames) == 0 {
+		return false, nil
+	}
+	result, err := this.CheckPermissionsE(ctx, target, permissionNames...)
+	if err != nil {
+		return false, err
+	}
+	for _, ok := range result {
+		if ok == false {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ExplainPermission 获取 target 是否拥有指定权限的详细说明，包括提供该权限的角色及其在角色树中的路径，或者没有该权限的原因
+//
+// 直接从数据库查询，不经过缓存；结果不包含通过资源授权获得的权限，参考 Decision
+func (this *Service) ExplainPermission(ctx int64, target string, permissionName string) (result *Decision, err error) {
+	return this.repo.ExplainPermission(ctx, target, permissionName)
+}
+
+// ExplainPermissionWithId 获取 target 是否拥有指定权限的详细说明，包括提供该权限的角色及其在角色树中的路径，或者没有该权限的原因
+func (this *Service) ExplainPermissionWithId(ctx int64, target string, permissionId int64) (result *Decision, err error) {
+	return this.repo.ExplainPermissionWithId(ctx, target, permissionId)
+}
+
+// CheckPermissionOn 验证 target 在资源 resource 上是否拥有指定权限
+//
+// 全局授予的角色对所有资源有效；在资源上授予的角色对该资源及其子资源有效，如在 project:42 上授予的角色对 project:42 有效，在 project:* 上授予的角色对 project:42 同样有效
+func (this *Service) CheckPermissionOn(ctx int64, target string, permissionName string, resource string) bool {
+	ok, err := this.CheckPermissionOnE(ctx, target, permissionName, resource)
+	return this.checkResult(ok, err, false)
+}
+
+// CheckPermissionOnE 与 CheckPermissionOn 相同，访问数据库或者缓存出错时返回错误
+func (this *Service) CheckPermissionOnE(ctx int64, target string, permissionName string, resource string) (bool, error) {
+	ok, err := this.repo.CheckPermissionE(ctx, target, permissionName)
+	if err != nil || ok {
+		return ok, err
+	}
+	if resource == "" {
+		return false, nil
+	}
+	return this.repo.CheckPermissionOnE(ctx, target, permissionName, resource)
+}
+
+// CheckPermissionOnWithId 验证 target 在资源 resource 上是否拥有指定权限
+func (this *Service) CheckPermissionOnWithId(ctx int64, target string, permissionId int64, resource string) bool {
+	ok, err := this.CheckPermissionOnWithIdE(ctx, target, permissionId, resource)
+	return this.checkResult(ok, err, false)
+}
+
+// CheckPermissionOnWithIdE 与 CheckPermissionOnWithId 相同，访问数据库或者缓存出错时返回错误
+func (this *Service) CheckPermissionOnWithIdE(ctx int64, target string, permissionId int64, resource string) (bool, error) {
+	ok, err := this.repo.CheckPermissionWithIdE(ctx, target, permissionId)
+	if err != nil || ok {
+		return ok, err
+	}
+	if resource == "" {
+		return false, nil
+	}
+	return this.repo.CheckPermissionOnWithIdE(ctx, target, permissionId, resource)
+}
+
+// SetPermissionCond 设置角色权限绑定的附加条件，只有条件成立时角色才拥有该权限，参数 cond 为空表示取消附加条件，表达式语法参考 Condition
+//
+// 带有附加条件的权限不会通过 CheckPermission 及 GetGrantedPermissions 等方法体现，需要使用 CheckPermissionWithAttrs 进行验证
+func (this *Service) SetPermissionCond(ctx int64, roleName, permissionName, cond string) (err error) {
+	role, err := this.repo.GetRoleWithName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrRoleNotExist
+	}
+	permission, err := this.repo.GetPermissionWithName(ctx, permissionName)
+	if err != nil {
+		return err
+	}
+	if permission == nil {
+		return ErrPermissionNotExist
+	}
+	return this.setPermissionCond(ctx, role.Id, permission.Id, cond)
+}
+
+// SetPermissionCondWithId 设置角色权限绑定的附加条件，只有条件成立时角色才拥有该权限，参数 cond 为空表示取消附加条件，表达式语法参考 Condition
+func (this *Service) SetPermissionCondWithId(ctx, roleId, permissionId int64, cond string) (err error) {
+	return this.setPermissionCond(ctx, roleId, permissionId, cond)
+}
+
+func (this *Service) setPermissionCond(ctx, roleId, permissionId int64, cond string) (err error) {
+	cond = strings.TrimSpace(cond)
+	if cond != "" {
+		if _, err = ParseCondition(cond); err != nil {
+			return err
+		}
+	}
+	if this.repo.CheckRolePermissionWithId(ctx, roleId, permissionId) == false {
+		return ErrPermissionNotGranted
+	}
+	if err = this.repo.UpdateRolePermissionCond(ctx, roleId, permissionId, cond); err != nil {
+		return err
+	}
+	// 缓存中只包含无条件的权限，附加条件发生变化时需要清除拥有该角色的 target 的缓存
+	return this.cleanRoleCache(ctx, roleId)
+}
+
+// CheckPermissionWithAttrs 验证 target 是否拥有指定权限，带有附加条件的权限使用 attrs 计算条件是否成立
+//
+// 优先使用 CheckPermission 验证无条件的权限，验证失败之后才会计算附加条件，附加条件计算出错时视为不成立
+func (this *Service) CheckPermissionWithAttrs(ctx int64, target string, permissionName string, attrs map[string]interface{}) bool {
+	ok, err := this.CheckPermissionWithAttrsE(ctx, target, permissionName, attrs)
+	return this.checkResult(ok, err, false)
+}
+
+// CheckPermissionWithAttrsE 与 CheckPermissionWithAttrs 相同，访问数据库或者缓存出错时返回错误
+//
+// 附加条件本身不合法或者计算出错时视为条件不成立，不会返回错误，避免在 FailOpen 策略下因为条件出错而通过验证
+func (this *Service) CheckPermissionWithAttrsE(ctx int64, target string, permissionName string, attrs map[string]interface{}) (bool, error) {
+	ok, err := this.CheckPermissionE(ctx, target, permissionName)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return true, nil
+	}
+	pList, err := this.repo.GetConditionalPermissions(ctx, target, permissionName)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range pList {
+		cond, err := ParseCondition(p.Cond)
+		if err != nil {
+			continue
+		}
+		if ok, err := cond.Eval(attrs); err == nil && ok {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // CheckRolePermission 验证角色是否拥有指定权限
 func (this *Service) CheckRolePermission(ctx int64, roleName, permissionName string) bool {
-	return this.repo.CheckRolePermission(ctx, roleName, permissionName)
+	ok, err := this.CheckRolePermissionE(ctx, roleName, permissionName)
+	return this.checkResult(ok, err, false)
+}
+
+// CheckRolePermissionE 验证角色是否拥有指定权限，访问数据库或者缓存出错时返回错误
+func (this *Service) CheckRolePermissionE(ctx int64, roleName, permissionName string) (bool, error) {
+	return this.repo.CheckRolePermissionE(ctx, roleName, permissionName)
 }
 
 // CheckRolePermissionWithId 验证角色是否拥有指定权限
 func (this *Service) CheckRolePermissionWithId(ctx, roleId, permissionId int64) bool {
-	return this.repo.CheckRolePermissionWithId(ctx, roleId, permissionId)
+	ok, err := this.CheckRolePermissionWithIdE(ctx, roleId, permissionId)
+	return this.checkResult(ok, err, false)
+}
+
+// CheckRolePermissionWithIdE 验证角色是否拥有指定权限，访问数据库或者缓存出错时返回错误
+func (this *Service) CheckRolePermissionWithIdE(ctx, roleId, permissionId int64) (bool, error) {
+	return this.repo.CheckRolePermissionWithIdE(ctx, roleId, permissionId)
+}
+
+func (this *Service) addDeny(ctx int64, target string, roleId int64, permissionIds []int64) (err error) {
+	if err = this.repo.AddDenyWithIds(ctx, target, roleId, permissionIds); err != nil {
+		return err
+	}
+	return this.cleanDenyCache(ctx, target, roleId)
+}
+
+func (this *Service) removeDeny(ctx int64, target string, roleId int64, permissionIds []int64) (err error) {
+	if err = this.repo.RemoveDenyWithIds(ctx, target, roleId, permissionIds); err != nil {
+		return err
+	}
+	return this.cleanDenyCache(ctx, target, roleId)
+}
+
+// cleanDenyCache 禁止信息发生变化之后清除受影响的 target 的缓存，通过角色禁止权限时 target 为空，需要清除拥有该角色的 target 的缓存
+func (this *Service) cleanDenyCache(ctx int64, target string, roleId int64) (err error) {
+	if target != "" {
+		this.CleanCache(ctx, target)
+		return nil
+	}
+	return this.cleanRoleCache(ctx, roleId)
+}
+
+// cleanRoleCache 清除拥有角色 roleId（包括通过继承关系拥有该角色的权限）的 target 的缓存
+func (this *Service) cleanRoleCache(ctx, roleId int64) (err error) {
+	targets, err := this.repo.GetTargetsWithRoleIds(ctx, []int64{roleId})
+	if err != nil {
+		return err
+	}
+	this.cleanCaches(ctx, targets)
+	return nil
 }
 
 // CleanCache 清除缓存，如果 target 为空字符串或者 target 的值为星号(*)，则会清空所有缓存
+//
+// 如果 target 为授权对象组的标识（参考 TargetOfGroup），则会清除组内所有成员的缓存
 func (this *Service) CleanCache(ctx int64, target string) {
 	this.repo.CleanCache(ctx, target)
 }
+
+// cleanCaches 清除 targets 中所有 target 的缓存，用于在事务提交之后清除受影响的缓存
+func (this *Service) cleanCaches(ctx int64, targets []string) {
+	for _, target := range targets {
+		this.CleanCache(ctx, target)
+	}
+}
@@ -1,16 +1,22 @@
 package sql
 
 import (
+	"context"
 	"errors"
 	"github.com/smartwalle/dbs"
 	"github.com/smartwalle/odin"
 	"strings"
+	"time"
 )
 
 type Repository struct {
 	db                  dbs.DB
+	context             context.Context
 	dialect             dbs.Dialect
 	idGenerator         dbs.IdGenerator
+	inheritMode         odin.InheritMode
+	inheritConstraint   bool
+	matcher             *odin.PermissionMatcher
 	tablePrefix         string
 	tableGroup          string
 	tablePermission     string
@@ -18,8 +24,14 @@ type Repository struct {
 	tableRolePermission string
 	tableGrant          string
 	tableRoleMutex      string
+	tableDynamicMutex   string
 	tablePreRole        string
 	tablePrePermission  string
+	tableResourceGrant  string
+	tableDeny           string
+	tableGroupMember    string
+	tableDelegation     string
+	tableCtxLimit       string
 }
 
 func NewRepository(db dbs.DB, dialect dbs.Dialect, tblPrefix string) Repository {
@@ -41,8 +53,14 @@ func NewRepository(db dbs.DB, dialect dbs.Dialect, tblPrefix string) Repository
 	r.tableRolePermission = tblPrefix + "_role_permission"
 	r.tableGrant = tblPrefix + "_grant"
 	r.tableRoleMutex = tblPrefix + "_role_mutex"
+	r.tableDynamicMutex = tblPrefix + "_role_dynamic_mutex"
 	r.tablePreRole = tblPrefix + "_pre_role"
 	r.tablePrePermission = tblPrefix + "_pre_permission"
+	r.tableResourceGrant = tblPrefix + "_resource_grant"
+	r.tableDeny = tblPrefix + "_deny"
+	r.tableGroupMember = tblPrefix + "_group_member"
+	r.tableDelegation = tblPrefix + "_delegation"
+	r.tableCtxLimit = tblPrefix + "_ctx_limit"
 	return r
 }
 
@@ -65,7 +83,8 @@ func (this *Repository) WithTx(tx dbs.TX) odin.Repository {
 }
 
 func (this *Repository) ExBeginTx() (dbs.TX, Repository) {
-	var tx = dbs.MustTx(this.db)
+	// 事务同样需要使用通过 WithContext 设置的 context.Context，取消时数据库会回滚该事务
+	var tx = dbs.MustTxContext(this.Context(), this.db, nil)
 	var nRepo = *this
 	nRepo.db = tx
 	return tx, nRepo
@@ -77,6 +96,25 @@ func (this *Repository) ExWithTx(tx dbs.TX) Repository {
 	return nRepo
 }
 
+func (this *Repository) WithContext(ctx context.Context) odin.Repository {
+	var repo = this.ExWithContext(ctx)
+	return &repo
+}
+
+func (this *Repository) ExWithContext(ctx context.Context) Repository {
+	var nRepo = *this
+	nRepo.context = ctx
+	return nRepo
+}
+
+// Context 获取执行数据库操作时使用的 context.Context，未设置时为 context.Background()
+func (this *Repository) Context() context.Context {
+	if this.context == nil {
+		return context.Background()
+	}
+	return this.context
+}
+
 func (this *Repository) UseIdGenerator(g dbs.IdGenerator) {
 	this.idGenerator = g
 }
@@ -85,6 +123,30 @@ func (this *Repository) IdGenerator() dbs.IdGenerator {
 	return this.idGenerator
 }
 
+func (this *Repository) UseInheritMode(mode odin.InheritMode) {
+	this.inheritMode = mode
+}
+
+func (this *Repository) InheritMode() odin.InheritMode {
+	return this.inheritMode
+}
+
+func (this *Repository) UseInheritConstraint(inherit bool) {
+	this.inheritConstraint = inherit
+}
+
+func (this *Repository) InheritConstraint() bool {
+	return this.inheritConstraint
+}
+
+func (this *Repository) UsePermissionMatcher(matcher *odin.PermissionMatcher) {
+	this.matcher = matcher
+}
+
+func (this *Repository) PermissionMatcher() *odin.PermissionMatcher {
+	return this.matcher
+}
+
 func (this *Repository) TablePrefix() string {
 	return this.tablePrefix
 }
@@ -113,6 +175,10 @@ func (this *Repository) TableRoleMutex() string {
 	return this.tableRoleMutex
 }
 
+func (this *Repository) TableDynamicMutex() string {
+	return this.tableDynamicMutex
+}
+
 func (this *Repository) TablePreRole() string {
 	return this.tablePreRole
 }
@@ -121,110 +187,220 @@ func (this *Repository) TablePrePermission() string {
 	return this.tablePrePermission
 }
 
+func (this *Repository) TableResourceGrant() string {
+	return this.tableResourceGrant
+}
+
+func (this *Repository) TableDeny() string {
+	return this.tableDeny
+}
+
+func (this *Repository) TableGroupMember() string {
+	return this.tableGroupMember
+}
+
+func (this *Repository) TableDelegation() string {
+	return this.tableDelegation
+}
+
+func (this *Repository) TableCtxLimit() string {
+	return this.tableCtxLimit
+}
+
 func (this *Repository) InitTable() error {
 	return errors.New("odin: not implemented this method")
 }
 
+// grantTargetSQL 生成限定授权信息属于 target 的条件语句，包括直接授予给 target 的角色以及授予给 target 所属的授权对象组（启用状态）的角色
+func (this *Repository) grantTargetSQL(grantAlias string, ctx int64, target string) (string, []interface{}) {
+	return grantAlias + ".ctx = ? AND (" + grantAlias + ".target = ? OR " + grantAlias + ".target IN (" +
+			"SELECT CONCAT('" + odin.TargetGroupPrefix + "', gm.group_id) FROM " + this.tableGroupMember + " AS gm " +
+			"LEFT JOIN " + this.tableGroup + " AS tg ON tg.id = gm.group_id " +
+			"WHERE gm.ctx = ? AND gm.target = ? AND tg.type = ? AND tg.status = ?))",
+		[]interface{}{ctx, target, ctx, target, odin.GroupTarget, odin.Enable}
+}
+
+// whereGranted 限定授权信息属于 target（包括 target 所属的授权对象组），并且当前时间处于授权的有效期内，参数 grantAlias 为授权信息表的别名
+func (this *Repository) whereGranted(sb *dbs.SelectBuilder, grantAlias string, ctx int64, target string) {
+	var now = time.Now()
+	var cond, args = this.grantTargetSQL(grantAlias, ctx, target)
+	sb.Where(cond, args...)
+	sb.Where("("+grantAlias+".not_before IS NULL OR "+grantAlias+".not_before <= ?)", now)
+	sb.Where("("+grantAlias+".expires_at IS NULL OR "+grantAlias+".expires_at > ?)", now)
+}
+
+// joinGrantedRole 根据权限继承模式关联角色信息，r 为实际拥有权限的角色，参数 grantAlias 为授权信息表的别名
+func (this *Repository) joinGrantedRole(sb *dbs.SelectBuilder, ctx int64, grantAlias string) {
+	switch this.inheritMode {
+	case odin.InheritDescendants:
+		sb.LeftJoin(this.tableRole, "AS gr ON gr.id = "+grantAlias+".role_id")
+		sb.LeftJoin(this.tableRole, "AS r ON r.ctx = gr.ctx AND r.left_value >= gr.left_value AND r.right_value <= gr.right_value")
+		sb.Where("gr.ctx = ? AND gr.status = ?", ctx, odin.Enable)
+	case odin.InheritAncestors:
+		sb.LeftJoin(this.tableRole, "AS gr ON gr.id = "+grantAlias+".role_id")
+		sb.LeftJoin(this.tableRole, "AS r ON r.ctx = gr.ctx AND r.left_value <= gr.left_value AND r.right_value >= gr.right_value")
+		sb.Where("gr.ctx = ? AND gr.status = ?", ctx, odin.Enable)
+	default:
+		sb.LeftJoin(this.tableRole, "AS r ON r.id = "+grantAlias+".role_id")
+	}
+}
+
 func (this *Repository) CheckPermission(ctx int64, target string, permissionName string) bool {
+	ok, _ := this.CheckPermissionE(ctx, target, permissionName)
+	return ok
+}
+
+func (this *Repository) CheckPermissionE(ctx int64, target string, permissionName string) (ok bool, err error) {
+	if this.matcher != nil {
+		return this.matchPermission(ctx, target, permissionName, nil)
+	}
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
 	sb.Selects("g.ctx", "g.target", "g.role_id")
 	sb.Selects("r.name AS role_name")
 	sb.Selects("p.id AS permission_id", "p.name AS permission_name")
 	sb.From(this.tableGrant, "AS g")
-	sb.LeftJoin(this.tableRole, "AS r ON r.id = g.role_id")
+	this.joinGrantedRole(sb, ctx, "g")
 	sb.LeftJoin(this.tableRolePermission, "AS rp ON rp.role_id = r.id")
 	sb.LeftJoin(this.tablePermission, "AS p ON p.id = rp.permission_id")
-	sb.Where("g.ctx = ? AND g.target = ?", ctx, target)
+	this.whereGranted(sb, "g", ctx, target)
 	sb.Where("r.ctx = ? AND r.status = ?", ctx, odin.Enable)
-	sb.Where("rp.ctx = ?", ctx)
+	sb.Where("rp.ctx = ? AND rp.cond = ?", ctx, "")
 	sb.Where("p.ctx = ? AND p.name = ? AND p.status = ?", ctx, permissionName, odin.Enable)
+	this.whereNotDenied(sb, "p", ctx, target)
 	sb.Limit(1)
 	var grant *odin.Grant
-	if err := sb.Scan(this.db, &grant); err != nil {
-		return false
-	}
-	if grant != nil {
-		return true
+	if err = sb.ScanContext(this.Context(), this.db, &grant); err != nil {
+		return false, err
 	}
-	return false
+	return grant != nil, nil
 }
 
 func (this *Repository) CheckPermissionWithId(ctx int64, target string, permissionId int64) bool {
+	ok, _ := this.CheckPermissionWithIdE(ctx, target, permissionId)
+	return ok
+}
+
+func (this *Repository) CheckPermissionWithIdE(ctx int64, target string, permissionId int64) (ok bool, err error) {
+	if this.matcher != nil {
+		return this.matchPermissionWithId(ctx, target, permissionId, nil)
+	}
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
 	sb.Selects("g.ctx", "g.target", "g.role_id")
 	sb.Selects("r.name AS role_name")
 	sb.Selects("p.id AS permission_id", "p.name AS permission_name")
 	sb.From(this.tableGrant, "AS g")
-	sb.LeftJoin(this.tableRole, "AS r ON r.id = g.role_id")
+	this.joinGrantedRole(sb, ctx, "g")
 	sb.LeftJoin(this.tableRolePermission, "AS rp ON rp.role_id = r.id")
 	sb.LeftJoin(this.tablePermission, "AS p ON p.id = rp.permission_id")
-	sb.Where("g.ctx = ? AND g.target = ?", ctx, target)
+	this.whereGranted(sb, "g", ctx, target)
 	sb.Where("r.ctx = ? AND r.status = ?", ctx, odin.Enable)
-	sb.Where("rp.ctx = ?", ctx)
+	sb.Where("rp.ctx = ? AND rp.cond = ?", ctx, "")
 	sb.Where("p.ctx = ? AND p.id = ? AND p.status = ?", ctx, permissionId, odin.Enable)
+	this.whereNotDenied(sb, "p", ctx, target)
 	sb.Limit(1)
 	var grant *odin.Grant
-	if err := sb.Scan(this.db, &grant); err != nil {
-		return false
+	if err = sb.ScanContext(this.Context(), this.db, &grant); err != nil {
+		return false, err
+	}
+	return grant != nil, nil
+}
+
+func (this *Repository) CheckPermissions(ctx int64, target string, permissionNames []string) (result map[string]bool, err error) {
+	result = make(map[string]bool, len(permissionNames))
+	for _, name := range permissionNames {
+		result[name] = false
+	}
+	if len(permissionNames) == 0 {
+		return result, nil
+	}
+	if this.matcher != nil {
+		return this.matchPermissions(ctx, target, permissionNames, result)
+	}
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("p.name AS permission_name")
+	sb.From(this.tableGrant, "AS g")
+	this.joinGrantedRole(sb, ctx, "g")
+	sb.LeftJoin(this.tableRolePermission, "AS rp ON rp.role_id = r.id")
+	sb.LeftJoin(this.tablePermission, "AS p ON p.id = rp.permission_id")
+	this.whereGranted(sb, "g", ctx, target)
+	sb.Where("r.ctx = ? AND r.status = ?", ctx, odin.Enable)
+	sb.Where("rp.ctx = ? AND rp.cond = ?", ctx, "")
+	sb.Where("p.ctx = ? AND p.status = ?", ctx, odin.Enable)
+	sb.Where(dbs.IN("p.name", permissionNames))
+	this.whereNotDenied(sb, "p", ctx, target)
+	sb.GroupBy("p.name")
+	var grants []*odin.Grant
+	if err = sb.ScanContext(this.Context(), this.db, &grants); err != nil {
+		return nil, err
 	}
-	if grant != nil {
-		return true
+	for _, grant := range grants {
+		result[grant.PermissionName] = true
 	}
-	return false
+	return result, nil
 }
 
 func (this *Repository) CheckRole(ctx int64, target string, roleName string) bool {
+	ok, _ := this.CheckRoleE(ctx, target, roleName)
+	return ok
+}
+
+func (this *Repository) CheckRoleE(ctx int64, target string, roleName string) (ok bool, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
 	sb.Selects("g.ctx", "g.target", "g.role_id")
 	sb.Selects("r.name AS role_name")
 	sb.From(this.tableGrant, "AS g")
 	sb.LeftJoin(this.tableRole, "AS r ON r.id = g.role_id")
-	sb.Where("g.ctx = ? AND g.target = ?", ctx, target)
+	this.whereGranted(sb, "g", ctx, target)
 	sb.Where("r.ctx = ? AND r.name = ? AND r.status = ?", ctx, roleName, odin.Enable)
 	sb.Limit(1)
 	var grant *odin.Grant
-	if err := sb.Scan(this.db, &grant); err != nil {
-		return false
-	}
-	if grant != nil {
-		return true
+	if err = sb.ScanContext(this.Context(), this.db, &grant); err != nil {
+		return false, err
 	}
-	return false
+	return grant != nil, nil
 }
 
 func (this *Repository) CheckRoleWithId(ctx int64, target string, roleId int64) bool {
+	ok, _ := this.CheckRoleWithIdE(ctx, target, roleId)
+	return ok
+}
+
+func (this *Repository) CheckRoleWithIdE(ctx int64, target string, roleId int64) (ok bool, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
 	sb.Selects("g.ctx", "g.target", "g.role_id")
 	sb.Selects("r.name AS role_name")
 	sb.From(this.tableGrant, "AS g")
 	sb.LeftJoin(this.tableRole, "AS r ON r.id = g.role_id")
-	sb.Where("g.ctx = ? AND g.role_id = ? AND g.target = ?", ctx, roleId, target)
+	this.whereGranted(sb, "g", ctx, target)
+	sb.Where("g.role_id = ?", roleId)
 	sb.Where("r.ctx = ? AND r.status = ?", ctx, odin.Enable)
 	sb.Limit(1)
 	var grant *odin.Grant
-	if err := sb.Scan(this.db, &grant); err != nil {
-		return false
-	}
-	if grant != nil {
-		return true
+	if err = sb.ScanContext(this.Context(), this.db, &grant); err != nil {
+		return false, err
 	}
-	return false
+	return grant != nil, nil
 }
 
 func (this *Repository) CheckRoleAccessible(ctx int64, target string, roleName string) bool {
+	ok, _ := this.CheckRoleAccessibleE(ctx, target, roleName)
+	return ok
+}
+
+func (this *Repository) CheckRoleAccessibleE(ctx int64, target string, roleName string) (ok bool, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
-	sb.Selects("r.id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.created_on", "r.updated_on")
+	sb.Selects("r.id", "r.group_id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.max_targets", "r.created_on", "r.updated_on")
 	sb.Selects("MAX(CASE WHEN rg.role_id = r.id THEN 0 ELSE 1 END) AS can_access")
 	sb.From(this.tableRole, "AS r")
 	sb.LeftJoin(this.tableRole, "AS rp ON rp.left_value < r.left_value AND rp.right_value > r.right_value")
 	sb.LeftJoin(this.tableGrant, "AS rg ON rg.role_id = rp.id")
-	sb.Where("rg.ctx = ?", ctx)
-	sb.Where("rg.target = ?", target)
+	this.whereGranted(sb, "rg", ctx, target)
 	sb.Where("rp.ctx = ?", ctx)
 	sb.Where("rp.status = ?", odin.Enable)
 	sb.Where("r.ctx = ?", ctx)
@@ -234,25 +410,29 @@ func (this *Repository) CheckRoleAccessible(ctx int64, target string, roleName s
 	sb.OrderBy("r.ctx", "r.id")
 	sb.Limit(1)
 	var role *odin.Role
-	if err := sb.Scan(this.db, &role); err != nil {
-		return false
+	if err = sb.ScanContext(this.Context(), this.db, &role); err != nil {
+		return false, err
 	}
 	if role == nil {
-		return false
+		return false, nil
 	}
-	return role.Accessible
+	return role.Accessible, nil
 }
 
 func (this *Repository) CheckRoleAccessibleWithId(ctx int64, target string, roleId int64) bool {
+	ok, _ := this.CheckRoleAccessibleWithIdE(ctx, target, roleId)
+	return ok
+}
+
+func (this *Repository) CheckRoleAccessibleWithIdE(ctx int64, target string, roleId int64) (ok bool, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
-	sb.Selects("r.id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.created_on", "r.updated_on")
+	sb.Selects("r.id", "r.group_id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.max_targets", "r.created_on", "r.updated_on")
 	sb.Selects("MAX(CASE WHEN rg.role_id = r.id THEN 0 ELSE 1 END) AS can_access")
 	sb.From(this.tableRole, "AS r")
 	sb.LeftJoin(this.tableRole, "AS rp ON rp.left_value < r.left_value AND rp.right_value > r.right_value")
 	sb.LeftJoin(this.tableGrant, "AS rg ON rg.role_id = rp.id")
-	sb.Where("rg.ctx = ?", ctx)
-	sb.Where("rg.target = ?", target)
+	this.whereGranted(sb, "rg", ctx, target)
 	sb.Where("rp.ctx = ?", ctx)
 	sb.Where("rp.status = ?", odin.Enable)
 	sb.Where("r.ctx = ?", ctx)
@@ -262,16 +442,21 @@ func (this *Repository) CheckRoleAccessibleWithId(ctx int64, target string, role
 	sb.OrderBy("r.ctx", "r.id")
 	sb.Limit(1)
 	var role *odin.Role
-	if err := sb.Scan(this.db, &role); err != nil {
-		return false
+	if err = sb.ScanContext(this.Context(), this.db, &role); err != nil {
+		return false, err
 	}
 	if role == nil {
-		return false
+		return false, nil
 	}
-	return role.Accessible
+	return role.Accessible, nil
 }
 
 func (this *Repository) CheckRolePermission(ctx int64, roleName, permissionName string) bool {
+	ok, _ := this.CheckRolePermissionE(ctx, roleName, permissionName)
+	return ok
+}
+
+func (this *Repository) CheckRolePermissionE(ctx int64, roleName, permissionName string) (ok bool, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
 	sb.Selects("rp.ctx", "rp.role_id", "rp.permission_id")
@@ -283,16 +468,18 @@ func (this *Repository) CheckRolePermission(ctx int64, roleName, permissionName
 	sb.Where("p.ctx = ? AND p.name = ?", ctx, permissionName)
 	sb.Limit(1)
 	var rp *odin.RolePermission
-	if err := sb.Scan(this.db, &rp); err != nil {
-		return false
-	}
-	if rp == nil {
-		return false
+	if err = sb.ScanContext(this.Context(), this.db, &rp); err != nil {
+		return false, err
 	}
-	return true
+	return rp != nil, nil
 }
 
 func (this *Repository) CheckRolePermissionWithId(ctx, roleId, permissionId int64) bool {
+	ok, _ := this.CheckRolePermissionWithIdE(ctx, roleId, permissionId)
+	return ok
+}
+
+func (this *Repository) CheckRolePermissionWithIdE(ctx, roleId, permissionId int64) (ok bool, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
 	sb.Selects("rp.ctx", "rp.role_id", "rp.permission_id")
@@ -304,13 +491,10 @@ func (this *Repository) CheckRolePermissionWithId(ctx, roleId, permissionId int6
 	sb.Where("p.ctx = ? AND p.id = ?", ctx, permissionId)
 	sb.Limit(1)
 	var rp *odin.RolePermission
-	if err := sb.Scan(this.db, &rp); err != nil {
-		return false
-	}
-	if rp == nil {
-		return false
+	if err = sb.ScanContext(this.Context(), this.db, &rp); err != nil {
+		return false, err
 	}
-	return true
+	return rp != nil, nil
 }
 
 func (this *Repository) CleanCache(ctx int64, target string) {
@@ -0,0 +1,85 @@
+package sql
+
+import (
+	"github.com/smartwalle/dbs"
+	"github.com/smartwalle/odin"
+	"time"
+)
+
+func (this *Repository) GetDelegations(ctx int64, fromTarget, toTarget string) (result []*odin.Delegation, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("d.ctx", "d.role_id", "d.from_target", "d.to_target", "d.expires_at", "d.created_on")
+	sb.Selects("r.name AS role_name")
+	sb.From(this.tableDelegation, "AS d")
+	sb.LeftJoin(this.tableRole, "AS r ON r.id = d.role_id")
+	sb.Where("d.ctx = ?", ctx)
+	if fromTarget != "" {
+		sb.Where("d.from_target = ?", fromTarget)
+	}
+	if toTarget != "" {
+		sb.Where("d.to_target = ?", toTarget)
+	}
+	sb.Where("(d.expires_at IS NULL OR d.expires_at > ?)", time.Now())
+	sb.OrderBy("d.created_on")
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AddDelegation 添加角色委托记录，如果委托记录已经存在，则更新其过期时间
+func (this *Repository) AddDelegation(ctx, roleId int64, fromTarget, toTarget string, expiresAt time.Time) (err error) {
+	var ib = dbs.NewInsertBuilder()
+	ib.UseDialect(this.dialect)
+	ib.Table(this.tableDelegation)
+	ib.Columns("ctx", "role_id", "from_target", "to_target", "expires_at", "created_on")
+	ib.Values(ctx, roleId, fromTarget, toTarget, expiresAt, time.Now())
+	ib.Suffix("ON DUPLICATE KEY UPDATE expires_at = VALUES(expires_at)")
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (this *Repository) RemoveDelegation(ctx, roleId int64, fromTarget, toTarget string) (err error) {
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableDelegation)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("role_id = ?", roleId)
+	rb.Where("from_target = ?", fromTarget)
+	rb.Where("to_target = ?", toTarget)
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemoveDelegationsWithTarget 删除委托给 toTarget 的委托记录，参数 roleIds 为空时删除委托给 toTarget 的所有委托记录
+func (this *Repository) RemoveDelegationsWithTarget(ctx int64, toTarget string, roleIds []int64) (err error) {
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableDelegation)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("to_target = ?", toTarget)
+	if len(roleIds) > 0 {
+		rb.Where(dbs.IN("role_id", roleIds))
+	}
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (this *Repository) cleanExpiredDelegations(ctx int64) (err error) {
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableDelegation)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now())
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package sql
+
+import (
+	"github.com/smartwalle/dbs"
+	"github.com/smartwalle/odin"
+	"strings"
+	"time"
+)
+
+// grantedRoleSQL 生成查询 target 当前拥有的角色 id 的子查询语句
+func (this *Repository) grantedRoleSQL(ctx int64, target string) (string, []interface{}) {
+	var now = time.Now()
+	var cond, args = this.grantTargetSQL("dg", ctx, target)
+	return "SELECT dg.role_id FROM " + this.tableGrant + " AS dg WHERE " + cond + " AND (dg.not_before IS NULL OR dg.not_before <= ?) AND (dg.expires_at IS NULL OR dg.expires_at > ?)",
+		append(args, now, now)
+}
+
+// resourceRoleSQL 生成查询 target 在资源上拥有的角色 id 的子查询语句，参数 patterns 为可以匹配该资源的资源标识列表
+func (this *Repository) resourceRoleSQL(ctx int64, target string, patterns []string) (string, []interface{}) {
+	var args = make([]interface{}, 0, len(patterns)+2)
+	args = append(args, ctx, target)
+	for _, pattern := range patterns {
+		args = append(args, pattern)
+	}
+	return "SELECT drg.role_id FROM " + this.tableResourceGrant + " AS drg WHERE drg.ctx = ? AND drg.target = ? AND drg.resource IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(patterns)), ", ") + ")",
+		args
+}
+
+// whereNotDenied 排除已经禁止 target 使用的权限，参数 permissionAlias 为权限信息表的别名
+//
+// 禁止信息包括直接禁止 target 使用的权限以及禁止 target 当前拥有的角色使用的权限
+func (this *Repository) whereNotDenied(sb *dbs.SelectBuilder, permissionAlias string, ctx int64, target string) {
+	var roleSQL, roleArgs = this.grantedRoleSQL(ctx, target)
+	var args = append([]interface{}{ctx, target}, roleArgs...)
+	sb.Where("NOT EXISTS (SELECT 1 FROM "+this.tableDeny+" AS d WHERE d.ctx = ? AND d.permission_id = "+permissionAlias+".id AND (d.target = ? OR d.role_id IN ("+roleSQL+")))", args...)
+}
+
+// whereNotDeniedOn 排除已经禁止 target 在资源上拥有的角色使用的权限，参数 patterns 为可以匹配该资源的资源标识列表
+func (this *Repository) whereNotDeniedOn(sb *dbs.SelectBuilder, permissionAlias string, ctx int64, target string, patterns []string) {
+	var roleSQL, roleArgs = this.resourceRoleSQL(ctx, target, patterns)
+	var args = append([]interface{}{ctx}, roleArgs...)
+	sb.Where("NOT EXISTS (SELECT 1 FROM "+this.tableDeny+" AS d WHERE d.ctx = ? AND d.permission_id = "+permissionAlias+".id AND d.role_id IN ("+roleSQL+"))", args...)
+}
+
+// getDeniedPermissions 获取禁止 target 使用的权限，如果参数 patterns 不为空，则包含禁止 target 在资源上拥有的角色使用的权限
+func (this *Repository) getDeniedPermissions(ctx int64, target string, patterns []string) (result []*odin.Permission, err error) {
+	var roleSQL, roleArgs = this.grantedRoleSQL(ctx, target)
+	var cond = "d.target = ? OR d.role_id IN (" + roleSQL + ")"
+	var args = append([]interface{}{target}, roleArgs...)
+	if len(patterns) > 0 {
+		var resourceSQL, resourceArgs = this.resourceRoleSQL(ctx, target, patterns)
+		cond = cond + " OR d.role_id IN (" + resourceSQL + ")"
+		args = append(args, resourceArgs...)
+	}
+
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("p.id", "p.group_id", "p.ctx", "p.name", "p.alias_name", "p.status", "p.description", "p.created_on", "p.updated_on")
+	sb.From(this.tableDeny, "AS d")
+	sb.LeftJoin(this.tablePermission, "AS p ON p.id = d.permission_id")
+	sb.Where("d.ctx = ?", ctx)
+	sb.Where("("+cond+")", args...)
+	sb.Where("p.ctx = ?", ctx)
+	sb.GroupBy("p.id")
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (this *Repository) GetDenies(ctx int64, target string, roleId int64) (result []*odin.Deny, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("d.ctx", "d.target", "d.role_id", "d.permission_id", "d.created_on")
+	sb.Selects("r.name AS role_name")
+	sb.Selects("p.name AS permission_name")
+	sb.From(this.tableDeny, "AS d")
+	sb.LeftJoin(this.tableRole, "AS r ON r.id = d.role_id")
+	sb.LeftJoin(this.tablePermission, "AS p ON p.id = d.permission_id")
+	sb.Where("d.ctx = ?", ctx)
+	if target != "" {
+		sb.Where("d.target = ?", target)
+	}
+	if roleId > 0 {
+		sb.Where("d.role_id = ?", roleId)
+	}
+	sb.OrderBy("d.target", "d.role_id", "d.permission_id")
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (this *Repository) AddDenyWithIds(ctx int64, target string, roleId int64, permissionIds []int64) (err error) {
+	if len(permissionIds) == 0 {
+		return nil
+	}
+	var now = time.Now()
+	var ib = dbs.NewInsertBuilder()
+	ib.UseDialect(this.dialect)
+	ib.Options("IGNORE")
+	ib.Table(this.tableDeny)
+	ib.Columns("ctx", "target", "role_id", "permission_id", "created_on")
+	for _, permissionId := range permissionIds {
+		ib.Values(ctx, target, roleId, permissionId, now)
+	}
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (this *Repository) RemoveDenyWithIds(ctx int64, target string, roleId int64, permissionIds []int64) (err error) {
+	if len(permissionIds) == 0 {
+		return nil
+	}
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableDeny)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("target = ?", target)
+	rb.Where("role_id = ?", roleId)
+	rb.Where(dbs.IN("permission_id", permissionIds))
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
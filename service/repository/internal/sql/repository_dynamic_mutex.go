@@ -0,0 +1,117 @@
+package sql
+
+import (
+	"github.com/smartwalle/dbs"
+	"github.com/smartwalle/odin"
+	"time"
+)
+
+// AddRoleDynamicMutex 添加动态互斥关系
+func (this *Repository) AddRoleDynamicMutex(ctx, roleId int64, mutexRoleIds []int64) (err error) {
+	var now = time.Now()
+	var ib = dbs.NewInsertBuilder()
+	ib.UseDialect(this.dialect)
+	ib.Options("IGNORE")
+	ib.Table(this.tableDynamicMutex)
+	ib.Columns("ctx", "role_id", "mutex_role_id", "created_on")
+	for _, mutexRoleId := range mutexRoleIds {
+		ib.Values(ctx, roleId, mutexRoleId, now)
+		ib.Values(ctx, mutexRoleId, roleId, now)
+	}
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemoveRoleDynamicMutex 删除动态互斥关系
+func (this *Repository) RemoveRoleDynamicMutex(ctx, roleId int64, mutexRoleIds []int64) (err error) {
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableDynamicMutex)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("role_id = ?", roleId)
+	rb.Where(dbs.IN("mutex_role_id", mutexRoleIds))
+	rb.Limit(int64(len(mutexRoleIds)))
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+
+	rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableDynamicMutex)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("mutex_role_id = ?", roleId)
+	rb.Where(dbs.IN("role_id", mutexRoleIds))
+	rb.Limit(int64(len(mutexRoleIds)))
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CleanRoleDynamicMutex 清除动态互斥关系
+func (this *Repository) CleanRoleDynamicMutex(ctx, roleId int64) (err error) {
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableDynamicMutex)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("role_id = ?", roleId)
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+
+	rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableDynamicMutex)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("mutex_role_id = ?", roleId)
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetDynamicMutexRoles 获取动态互斥关系
+func (this *Repository) GetDynamicMutexRoles(ctx, roleId int64) (result []*odin.RoleMutex, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("m.ctx", "m.role_id", "m.mutex_role_id", "m.created_on")
+	sb.Selects("r.name AS role_name", "r.alias_name AS role_alias_name")
+	sb.Selects("rm.name AS mutex_role_name", "rm.alias_name AS mutex_role_alias_name")
+	sb.From(this.tableDynamicMutex, "AS m")
+	sb.LeftJoin(this.tableRole, "AS r ON r.id = m.role_id")
+	sb.LeftJoin(this.tableRole, "AS rm ON rm.id = m.mutex_role_id")
+	sb.Where("m.ctx = ?", ctx)
+	sb.Where("m.role_id = ?", roleId)
+	sb.Where("r.ctx = ?", ctx)
+	sb.Where("rm.ctx = ?", ctx)
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetDynamicMutexRolesWithIds 获取角色之间的动态互斥关系
+func (this *Repository) GetDynamicMutexRolesWithIds(ctx int64, roleIds []int64) (result []*odin.RoleMutex, err error) {
+	if this.inheritConstraint {
+		return this.getInheritedMutexRoles(this.tableDynamicMutex, ctx, roleIds)
+	}
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("m.ctx", "m.role_id", "m.mutex_role_id", "m.created_on")
+	sb.Selects("r.name AS role_name", "r.alias_name AS role_alias_name")
+	sb.Selects("rm.name AS mutex_role_name", "rm.alias_name AS mutex_role_alias_name")
+	sb.From(this.tableDynamicMutex, "AS m")
+	sb.LeftJoin(this.tableRole, "AS r ON r.id = m.role_id")
+	sb.LeftJoin(this.tableRole, "AS rm ON rm.id = m.mutex_role_id")
+	sb.Where("m.ctx = ?", ctx)
+	sb.Where(dbs.IN("m.role_id", roleIds))
+	sb.Where(dbs.IN("m.mutex_role_id", roleIds))
+	sb.Where("r.ctx = ?", ctx)
+	sb.Where("rm.ctx = ?", ctx)
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
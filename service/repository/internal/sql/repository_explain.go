@@ -0,0 +1,214 @@
+package sql
+
+import (
+	"github.com/smartwalle/dbs"
+	"github.com/smartwalle/odin"
+	"time"
+)
+
+func (this *Repository) ExplainPermission(ctx int64, target string, permissionName string) (result *odin.Decision, err error) {
+	pList, err := this.GetPermissionsWithNames(ctx, permissionName)
+	if err != nil {
+		return nil, err
+	}
+	var permission *odin.Permission
+	if len(pList) > 0 {
+		permission = pList[0]
+	}
+	return this.explainPermission(ctx, target, permissionName, permission)
+}
+
+func (this *Repository) ExplainPermissionWithId(ctx int64, target string, permissionId int64) (result *odin.Decision, err error) {
+	pList, err := this.GetPermissionsWithIds(ctx, permissionId)
+	if err != nil {
+		return nil, err
+	}
+	var permission *odin.Permission
+	if len(pList) > 0 {
+		permission = pList[0]
+	}
+	return this.explainPermission(ctx, target, "", permission)
+}
+
+// explainPermission 参数 permission 为 nil 时表示权限不存在
+func (this *Repository) explainPermission(ctx int64, target string, permissionName string, permission *odin.Permission) (result *odin.Decision, err error) {
+	result = &odin.Decision{}
+	result.Ctx = ctx
+	result.Target = target
+	result.PermissionName = permissionName
+	if permission == nil {
+		result.Reason = odin.ReasonPermissionNotExist
+		return result, nil
+	}
+	result.PermissionId = permission.Id
+	result.PermissionName = permission.Name
+
+	if result.SourceList, err = this.getDecisionSources(ctx, target, permission); err != nil {
+		return nil, err
+	}
+	if result.DenyList, err = this.getDecisionDenies(ctx, target, permission); err != nil {
+		return nil, err
+	}
+
+	var now = time.Now()
+	var granted bool
+	for _, source := range result.SourceList {
+		source.Reason = decisionSourceReason(source, now)
+		if source.Reason == odin.ReasonGranted {
+			granted = true
+		}
+	}
+
+	switch {
+	case permission.Status != odin.Enable:
+		result.Reason = odin.ReasonPermissionDisabled
+	case granted && len(result.DenyList) > 0:
+		result.Reason = odin.ReasonDenied
+	case granted:
+		result.Allowed = true
+		result.Reason = odin.ReasonGranted
+	case len(result.SourceList) == 0:
+		result.Reason = odin.ReasonNotGranted
+	default:
+		result.Reason = result.SourceList[0].Reason
+	}
+	return result, nil
+}
+
+// decisionSourceReason 按照验证权限时的顺序判断授权是否有效
+func decisionSourceReason(source *odin.DecisionSource, now time.Time) odin.DecisionReason {
+	if source.GroupId > 0 && source.GroupStatus != odin.Enable {
+		return odin.ReasonGroupDisabled
+	}
+	if source.GrantedRoleStatus != odin.Enable || source.RoleStatus != odin.Enable {
+		return odin.ReasonRoleDisabled
+	}
+	if source.PermissionStatus != odin.Enable {
+		return odin.ReasonPermissionDisabled
+	}
+	if (source.NotBefore != nil && source.NotBefore.After(now)) || (source.ExpiresAt != nil && source.ExpiresAt.After(now) == false) {
+		return odin.ReasonGrantInactive
+	}
+	if source.Cond != "" {
+		return odin.ReasonConditional
+	}
+	return odin.ReasonGranted
+}
+
+// getDecisionSources 获取授予给 target（包括 target 所属的授权对象组）并且拥有指定权限的角色，不过滤状态及有效期
+//
+// 启用权限名称匹配器时，拥有与之匹配的通配权限同样拥有该权限，此时一并查询 target 的角色拥有的通配权限，再使用匹配器过滤
+func (this *Repository) getDecisionSources(ctx int64, target string, permission *odin.Permission) (result []*odin.DecisionSource, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("g.target", "g.not_before", "g.expires_at")
+	sb.Selects("tg.id AS group_id", "tg.name AS group_name", "tg.status AS group_status")
+	sb.Selects("gr.id AS granted_role_id", "gr.name AS granted_role_name", "gr.status AS granted_role_status")
+	sb.Selects("r.id AS role_id", "r.name AS role_name", "r.status AS role_status")
+	sb.Selects("p.id AS permission_id", "p.name AS permission_name", "p.status AS permission_status")
+	sb.Selects("rp.cond")
+	sb.From(this.tableGrant, "AS g")
+	sb.LeftJoin(this.tableGroup, "AS tg ON tg.ctx = g.ctx AND tg.type = ? AND CONCAT('"+odin.TargetGroupPrefix+"', tg.id) = g.target", odin.GroupTarget)
+	sb.LeftJoin(this.tableRole, "AS gr ON gr.id = g.role_id")
+	switch this.inheritMode {
+	case odin.InheritDescendants:
+		sb.LeftJoin(this.tableRole, "AS r ON r.ctx = gr.ctx AND r.left_value >= gr.left_value AND r.right_value <= gr.right_value")
+	case odin.InheritAncestors:
+		sb.LeftJoin(this.tableRole, "AS r ON r.ctx = gr.ctx AND r.left_value <= gr.left_value AND r.right_value >= gr.right_value")
+	default:
+		sb.LeftJoin(this.tableRole, "AS r ON r.id = gr.id")
+	}
+	sb.LeftJoin(this.tableRolePermission, "AS rp ON rp.role_id = r.id")
+	sb.LeftJoin(this.tablePermission, "AS p ON p.id = rp.permission_id")
+	sb.Where("g.ctx = ?", ctx)
+	sb.Where("(g.target = ? OR g.target IN (SELECT CONCAT('"+odin.TargetGroupPrefix+"', gm.group_id) FROM "+this.tableGroupMember+" AS gm WHERE gm.ctx = ? AND gm.target = ?))", target, ctx, target)
+	sb.Where("gr.ctx = ? AND r.ctx = ? AND rp.ctx = ? AND p.ctx = ?", ctx, ctx, ctx, ctx)
+	if this.matcher != nil {
+		sb.Where(dbs.OR().Append("rp.permission_id = ?", permission.Id).Append("p.name LIKE '%*%'").Append("p.name LIKE '%?%'").Append("p.name LIKE '%[%'"))
+	} else {
+		sb.Where("rp.permission_id = ?", permission.Id)
+	}
+	sb.OrderBy("g.target", "gr.left_value", "r.left_value", "p.id")
+	var sources []*odin.DecisionSource
+	if err = sb.ScanContext(this.Context(), this.db, &sources); err != nil {
+		return nil, err
+	}
+	for _, source := range sources {
+		if source.PermissionId == permission.Id || this.matcher.Match(source.PermissionName, permission.Name) {
+			result = append(result, source)
+		}
+	}
+
+	var roleIds = make([]int64, 0, len(result))
+	for _, source := range result {
+		roleIds = append(roleIds, source.RoleId)
+	}
+	paths, err := this.getRolePaths(ctx, roleIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range result {
+		source.RolePath = paths[source.RoleId]
+	}
+	return result, nil
+}
+
+type rolePathNode struct {
+	RoleId int64  `sql:"role_id"`
+	Name   string `sql:"name"`
+}
+
+// getRolePaths 获取角色在角色树中的路径，即从根角色到该角色的角色名称列表
+func (this *Repository) getRolePaths(ctx int64, roleIds []int64) (result map[int64][]string, err error) {
+	result = make(map[int64][]string, len(roleIds))
+	if len(roleIds) == 0 {
+		return result, nil
+	}
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("r.id AS role_id", "a.name")
+	sb.From(this.tableRole, "AS r")
+	sb.LeftJoin(this.tableRole, "AS a ON a.ctx = r.ctx AND a.left_value <= r.left_value AND a.right_value >= r.right_value")
+	sb.Where("r.ctx = ?", ctx)
+	sb.Where(dbs.IN("r.id", roleIds))
+	sb.OrderBy("r.id", "a.left_value")
+	var nodes []*rolePathNode
+	if err = sb.ScanContext(this.Context(), this.db, &nodes); err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		result[node.RoleId] = append(result[node.RoleId], node.Name)
+	}
+	return result, nil
+}
+
+// getDecisionDenies 获取对 target 生效并且禁止使用该权限的禁止信息，启用权限名称匹配器时包括与之匹配的通配禁止
+func (this *Repository) getDecisionDenies(ctx int64, target string, permission *odin.Permission) (result []*odin.Deny, err error) {
+	var roleSQL, roleArgs = this.grantedRoleSQL(ctx, target)
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("d.ctx", "d.target", "d.role_id", "d.permission_id", "d.created_on")
+	sb.Selects("r.name AS role_name")
+	sb.Selects("p.name AS permission_name")
+	sb.From(this.tableDeny, "AS d")
+	sb.LeftJoin(this.tableRole, "AS r ON r.id = d.role_id")
+	sb.LeftJoin(this.tablePermission, "AS p ON p.id = d.permission_id")
+	sb.Where("d.ctx = ?", ctx)
+	sb.Where("(d.target = ? OR d.role_id IN ("+roleSQL+"))", append([]interface{}{target}, roleArgs...)...)
+	if this.matcher == nil {
+		sb.Where("d.permission_id = ?", permission.Id)
+	}
+	var denies []*odin.Deny
+	if err = sb.ScanContext(this.Context(), this.db, &denies); err != nil {
+		return nil, err
+	}
+	if this.matcher == nil {
+		return denies, nil
+	}
+	for _, deny := range denies {
+		if this.matcher.Match(deny.PermissionName, permission.Name) {
+			result = append(result, deny)
+		}
+	}
+	return result, nil
+}
@@ -23,7 +23,7 @@ func (this *Repository) GetGroups(ctx int64, gType odin.GroupType, status odin.S
 		sb.Where(or)
 	}
 	sb.OrderBy("g.ctx", "g.id")
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -43,7 +43,7 @@ func (this *Repository) getGroup(ctx int64, gType odin.GroupType, groupId int64,
 		sb.Where("g.name = ?", name)
 	}
 	sb.Limit(1)
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -65,7 +65,7 @@ func (this *Repository) AddGroup(ctx int64, gType odin.GroupType, name, aliasNam
 	ib.Table(this.tableGroup)
 	ib.Columns("id", "ctx", "type", "name", "alias_name", "status", "created_on", "updated_on")
 	ib.Values(nId, ctx, gType, name, aliasName, status, now, now)
-	if _, err = ib.Exec(this.db); err != nil {
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
 		return 0, err
 	}
 	return nId, nil
@@ -83,7 +83,7 @@ func (this *Repository) UpdateGroup(ctx int64, gType odin.GroupType, groupId int
 	ub.Where("ctx = ?", ctx)
 	ub.Where("type = ?", gType)
 	ub.Limit(1)
-	_, err = ub.Exec(this.db)
+	_, err = ub.ExecContext(this.Context(), this.db)
 	return err
 }
 
@@ -98,6 +98,108 @@ func (this *Repository) UpdateGroupStatus(ctx int64, gType odin.GroupType, group
 	ub.Where("ctx = ?", ctx)
 	ub.Where("type = ?", gType)
 	ub.Limit(1)
-	_, err = ub.Exec(this.db)
+	_, err = ub.ExecContext(this.Context(), this.db)
 	return err
 }
+
+func (this *Repository) UpdateGroupName(ctx int64, gType odin.GroupType, groupId int64, name string) (err error) {
+	var now = time.Now()
+	var ub = dbs.NewUpdateBuilder()
+	ub.UseDialect(this.dialect)
+	ub.Table(this.tableGroup)
+	ub.SET("name", name)
+	ub.SET("updated_on", now)
+	ub.Where("id = ?", groupId)
+	ub.Where("ctx = ?", ctx)
+	ub.Where("type = ?", gType)
+	_, err = ub.ExecContext(this.Context(), this.db)
+	return err
+}
+
+func (this *Repository) DeleteGroup(ctx int64, gType odin.GroupType, groupId int64) (err error) {
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableGroup)
+	rb.Where("id = ?", groupId)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("type = ?", gType)
+	_, err = rb.ExecContext(this.Context(), this.db)
+	return err
+}
+
+func (this *Repository) GetGroupMembers(ctx, groupId int64) (result []*odin.GroupMember, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("gm.ctx", "gm.group_id", "gm.target", "gm.created_on")
+	sb.From(this.tableGroupMember, "AS gm")
+	sb.Where("gm.ctx = ?", ctx)
+	sb.Where("gm.group_id = ?", groupId)
+	sb.OrderBy("gm.target")
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (this *Repository) GetGroupsWithTarget(ctx int64, target string) (result []*odin.Group, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("g.id", "g.ctx", "g.type", "g.name", "g.alias_name", "g.status", "g.created_on", "g.updated_on")
+	sb.From(this.tableGroupMember, "AS gm")
+	sb.LeftJoin(this.tableGroup, "AS g ON g.id = gm.group_id")
+	sb.Where("gm.ctx = ?", ctx)
+	sb.Where("gm.target = ?", target)
+	sb.Where("g.ctx = ? AND g.type = ?", ctx, odin.GroupTarget)
+	sb.OrderBy("g.ctx", "g.id")
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (this *Repository) AddGroupMembers(ctx, groupId int64, targets []string) (err error) {
+	if len(targets) == 0 {
+		return nil
+	}
+	var now = time.Now()
+	var ib = dbs.NewInsertBuilder()
+	ib.UseDialect(this.dialect)
+	ib.Options("IGNORE")
+	ib.Table(this.tableGroupMember)
+	ib.Columns("ctx", "group_id", "target", "created_on")
+	for _, target := range targets {
+		ib.Values(ctx, groupId, target, now)
+	}
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (this *Repository) RemoveGroupMembers(ctx, groupId int64, targets []string) (err error) {
+	if len(targets) == 0 {
+		return nil
+	}
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableGroupMember)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("group_id = ?", groupId)
+	rb.Where(dbs.IN("target", targets))
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (this *Repository) CleanGroupMembers(ctx, groupId int64) (err error) {
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableGroupMember)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("group_id = ?", groupId)
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package sql
+
+import (
+	"github.com/smartwalle/dbs"
+	"github.com/smartwalle/odin"
+	"time"
+)
+
+func (this *Repository) UpdateRoleMaxTargets(ctx, roleId int64, maxTargets int) (err error) {
+	var ub = dbs.NewUpdateBuilder()
+	ub.UseDialect(this.dialect)
+	ub.Table(this.tableRole)
+	ub.SET("max_targets", maxTargets)
+	ub.SET("updated_on", time.Now())
+	ub.Where("ctx = ? AND id = ?", ctx, roleId)
+	ub.Limit(1)
+	_, err = ub.ExecContext(this.Context(), this.db)
+	return err
+}
+
+// LockRolesWithIds 获取角色信息并锁定角色记录直到事务结束，用于在授权时串行化对同一角色的并发授权
+func (this *Repository) LockRolesWithIds(ctx int64, roleIds []int64) (result []*odin.Role, err error) {
+	if len(roleIds) == 0 {
+		return nil, nil
+	}
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("r.id", "r.group_id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.max_targets", "r.created_on", "r.updated_on")
+	sb.From(this.tableRole, "AS r")
+	sb.Where("r.ctx = ?", ctx)
+	sb.Where(dbs.IN("r.id", roleIds))
+	// 按照 id 的顺序加锁，避免并发授权时出现死锁
+	sb.OrderBy("r.id")
+	sb.Suffix("FOR UPDATE")
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CountRoleTargets 统计角色 roleId 当前授予给了多少个 target（不包括 excludeTarget），已经过期的授权不计算在内
+//
+// PostgreSQL 不支持对聚合查询加锁，所以加锁查询出授权记录之后再统计数量，同一个角色授予给同一个 target 的授权记录只有一条
+func (this *Repository) CountRoleTargets(ctx, roleId int64, excludeTarget string) (result int, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("g.ctx", "g.target", "g.role_id")
+	sb.From(this.tableGrant, "AS g")
+	sb.Where("g.ctx = ? AND g.role_id = ?", ctx, roleId)
+	sb.Where("g.target <> ?", excludeTarget)
+	sb.Where("(g.expires_at IS NULL OR g.expires_at > ?)", time.Now())
+	sb.Suffix("FOR UPDATE")
+	var grants []*odin.Grant
+	if err = sb.ScanContext(this.Context(), this.db, &grants); err != nil {
+		return 0, err
+	}
+	return len(grants), nil
+}
+
+// LockGrantsWithTarget 获取 target 的所有授权信息（包括授予给 target 所属的授权对象组的授权）并锁定授权记录直到事务结束
+func (this *Repository) LockGrantsWithTarget(ctx int64, target string) (result []*odin.Grant, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("g.ctx", "g.target", "g.role_id", "g.not_before", "g.expires_at")
+	sb.From(this.tableGrant, "AS g")
+	var cond, args = this.grantTargetSQL("g", ctx, target)
+	sb.Where(cond, args...)
+	sb.OrderBy("g.role_id")
+	sb.Suffix("FOR UPDATE")
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (this *Repository) GetMaxRolesPerTarget(ctx int64) (result int, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("l.ctx", "l.max_roles_per_target")
+	sb.From(this.tableCtxLimit, "AS l")
+	sb.Where("l.ctx = ?", ctx)
+	sb.Limit(1)
+	var limit *ctxLimit
+	if err = sb.ScanContext(this.Context(), this.db, &limit); err != nil {
+		return 0, err
+	}
+	if limit == nil {
+		return 0, nil
+	}
+	return limit.MaxRolesPerTarget, nil
+}
+
+// LockMaxRolesPerTarget 获取每个 target 最多可以拥有的角色数量并锁定记录直到事务结束，未设置时不会加锁
+func (this *Repository) LockMaxRolesPerTarget(ctx int64) (result int, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("l.ctx", "l.max_roles_per_target")
+	sb.From(this.tableCtxLimit, "AS l")
+	sb.Where("l.ctx = ?", ctx)
+	sb.Suffix("FOR UPDATE")
+	var limit *ctxLimit
+	if err = sb.ScanContext(this.Context(), this.db, &limit); err != nil {
+		return 0, err
+	}
+	if limit == nil {
+		return 0, nil
+	}
+	return limit.MaxRolesPerTarget, nil
+}
+
+func (this *Repository) SetMaxRolesPerTarget(ctx int64, maxRoles int) (err error) {
+	var now = time.Now()
+	var ib = dbs.NewInsertBuilder()
+	ib.UseDialect(this.dialect)
+	ib.Table(this.tableCtxLimit)
+	ib.Columns("ctx", "max_roles_per_target", "created_on", "updated_on")
+	ib.Values(ctx, maxRoles, now, now)
+	ib.Suffix("ON DUPLICATE KEY UPDATE max_roles_per_target = VALUES(max_roles_per_target), updated_on = VALUES(updated_on)")
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+type ctxLimit struct {
+	Ctx               int64 `sql:"ctx"`
+	MaxRolesPerTarget int   `sql:"max_roles_per_target"`
+}
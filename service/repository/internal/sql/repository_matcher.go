@@ -0,0 +1,174 @@
+package sql
+
+import (
+	"github.com/smartwalle/dbs"
+	"github.com/smartwalle/odin"
+	"strings"
+)
+
+func permissionNames(permissionList []*odin.Permission) []string {
+	var names = make([]string, 0, len(permissionList))
+	for _, p := range permissionList {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// matchPermission 使用权限名称匹配器验证 target 是否拥有指定权限，参数 patterns 不为空时只验证通过资源授权获得的权限
+//
+// 权限需要存在并且处于启用状态，授予给 target 的权限（包括通配权限）中有任一与之匹配，并且没有被禁止（包括通过通配权限禁止）
+func (this *Repository) matchPermission(ctx int64, target string, permissionName string, patterns []string) (bool, error) {
+	pList, err := this.GetPermissionsWithNames(ctx, permissionName)
+	if err != nil {
+		return false, err
+	}
+	if len(pList) == 0 || pList[0].Status != odin.Enable {
+		return false, nil
+	}
+
+	var grantedList []*odin.Permission
+	if len(patterns) > 0 {
+		grantedList, err = this.getGrantedPermissionsOn(ctx, target, patterns)
+	} else {
+		grantedList, err = this.getGrantedPermissions(ctx, target, false)
+	}
+	if err != nil {
+		return false, err
+	}
+	if this.matcher.MatchAny(permissionNames(grantedList), permissionName) == false {
+		return false, nil
+	}
+
+	deniedList, err := this.getDeniedPermissions(ctx, target, patterns)
+	if err != nil {
+		return false, err
+	}
+	return this.matcher.MatchAny(permissionNames(deniedList), permissionName) == false, nil
+}
+
+func (this *Repository) matchPermissionWithId(ctx int64, target string, permissionId int64, patterns []string) (bool, error) {
+	pList, err := this.GetPermissionsWithIds(ctx, permissionId)
+	if err != nil {
+		return false, err
+	}
+	if len(pList) == 0 {
+		return false, nil
+	}
+	return this.matchPermission(ctx, target, pList[0].Name, patterns)
+}
+
+// matchPermissions 使用权限名称匹配器批量验证 target 是否拥有指定权限，只查询一次授予及禁止的权限，验证结果写入 result
+func (this *Repository) matchPermissions(ctx int64, target string, names []string, result map[string]bool) (map[string]bool, error) {
+	pList, err := this.GetPermissionsWithNames(ctx, names...)
+	if err != nil {
+		return nil, err
+	}
+	if len(pList) == 0 {
+		return result, nil
+	}
+
+	grantedList, err := this.getGrantedPermissions(ctx, target, false)
+	if err != nil {
+		return nil, err
+	}
+	deniedList, err := this.getDeniedPermissions(ctx, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var grantedNames = permissionNames(grantedList)
+	var deniedNames = permissionNames(deniedList)
+	for _, p := range pList {
+		if p.Status != odin.Enable {
+			continue
+		}
+		if this.matcher.MatchAny(grantedNames, p.Name) && this.matcher.MatchAny(deniedNames, p.Name) == false {
+			result[p.Name] = true
+		}
+	}
+	return result, nil
+}
+
+// matchGrantedPermissions 使用权限名称匹配器获取授予给 target 的权限，通配权限会被展开为所有与之匹配的权限
+func (this *Repository) matchGrantedPermissions(ctx int64, target string) (result []*odin.Permission, err error) {
+	grantedList, err := this.getGrantedPermissions(ctx, target, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(grantedList) == 0 {
+		return nil, nil
+	}
+
+	deniedList, err := this.getDeniedPermissions(ctx, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var grantedNames = permissionNames(grantedList)
+	pList, err := this.getMatchedPermissions(ctx, grantedNames)
+	if err != nil {
+		return nil, err
+	}
+
+	var deniedNames = permissionNames(deniedList)
+	for _, p := range pList {
+		if this.matcher.MatchAny(deniedNames, p.Name) == false {
+			p.Granted = true
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// getMatchedPermissions 获取处于启用状态并且名称与 patterns 中任一元素匹配的权限
+//
+// 通配权限使用通配符之前的固定前缀通过 LIKE 缩小查询范围，查询结果再使用匹配器过滤；固定前缀为空（如 *）时只能查询所有的权限
+func (this *Repository) getMatchedPermissions(ctx int64, patterns []string) (result []*odin.Permission, err error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	var or = dbs.OR()
+	var names []string
+	for _, pattern := range patterns {
+		if this.matcher.IsPattern(pattern) == false {
+			names = append(names, pattern)
+			continue
+		}
+		var prefix = pattern[:strings.IndexAny(pattern, "*?[")]
+		if prefix == "" {
+			or = nil
+			break
+		}
+		or.Append(dbs.Like("p.name", escapeLike(prefix), "%"))
+	}
+
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("p.id", "p.group_id", "p.ctx", "p.name", "p.alias_name", "p.status", "p.description", "p.created_on", "p.updated_on")
+	sb.From(this.tablePermission, "AS p")
+	sb.Where("p.ctx = ?", ctx)
+	sb.Where("p.status = ?", odin.Enable)
+	if or != nil {
+		if len(names) > 0 {
+			or.Append(dbs.IN("p.name", names))
+		}
+		sb.Where(or)
+	}
+	sb.OrderBy("p.ctx", "p.id")
+	var pList []*odin.Permission
+	if err = sb.ScanContext(this.Context(), this.db, &pList); err != nil {
+		return nil, err
+	}
+	for _, p := range pList {
+		if this.matcher.MatchAny(patterns, p.Name) {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// escapeLike 转义 LIKE 中的特殊字符
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
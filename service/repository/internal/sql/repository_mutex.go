@@ -18,7 +18,7 @@ func (this *Repository) AddRoleMutex(ctx, roleId int64, mutexRoleIds []int64) (e
 		ib.Values(ctx, roleId, mutexRoleId, now)
 		ib.Values(ctx, mutexRoleId, roleId, now)
 	}
-	if _, err = ib.Exec(this.db); err != nil {
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 	return nil
@@ -33,7 +33,7 @@ func (this *Repository) RemoveRoleMutex(ctx, roleId int64, mutexRoleIds []int64)
 	rb.Where("role_id = ?", roleId)
 	rb.Where(dbs.IN("mutex_role_id", mutexRoleIds))
 	rb.Limit(int64(len(mutexRoleIds)))
-	if _, err = rb.Exec(this.db); err != nil {
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 
@@ -44,7 +44,7 @@ func (this *Repository) RemoveRoleMutex(ctx, roleId int64, mutexRoleIds []int64)
 	rb.Where("mutex_role_id = ?", roleId)
 	rb.Where(dbs.IN("role_id", mutexRoleIds))
 	rb.Limit(int64(len(mutexRoleIds)))
-	if _, err = rb.Exec(this.db); err != nil {
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 	return nil
@@ -57,7 +57,7 @@ func (this *Repository) CleanRoleMutex(ctx, roleId int64) (err error) {
 	rb.Table(this.tableRoleMutex)
 	rb.Where("ctx = ?", ctx)
 	rb.Where("role_id = ?", roleId)
-	if _, err = rb.Exec(this.db); err != nil {
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 
@@ -66,7 +66,7 @@ func (this *Repository) CleanRoleMutex(ctx, roleId int64) (err error) {
 	rb.Table(this.tableRoleMutex)
 	rb.Where("ctx = ?", ctx)
 	rb.Where("mutex_role_id = ?", roleId)
-	if _, err = rb.Exec(this.db); err != nil {
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 	return nil
@@ -86,7 +86,7 @@ func (this *Repository) GetMutexRoles(ctx, roleId int64) (result []*odin.RoleMut
 	sb.Where("m.role_id = ?", roleId)
 	sb.Where("r.ctx = ?", ctx)
 	sb.Where("rm.ctx = ?", ctx)
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -94,6 +94,9 @@ func (this *Repository) GetMutexRoles(ctx, roleId int64) (result []*odin.RoleMut
 
 // GetMutexRolesWithIds 获取角色之间的互斥关系
 func (this *Repository) GetMutexRolesWithIds(ctx int64, roleIds []int64) (result []*odin.RoleMutex, err error) {
+	if this.inheritConstraint {
+		return this.getInheritedMutexRoles(this.tableRoleMutex, ctx, roleIds)
+	}
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
 	sb.Selects("m.ctx", "m.role_id", "m.mutex_role_id", "m.created_on")
@@ -107,14 +110,30 @@ func (this *Repository) GetMutexRolesWithIds(ctx int64, roleIds []int64) (result
 	sb.Where(dbs.IN("m.mutex_role_id", roleIds))
 	sb.Where("r.ctx = ?", ctx)
 	sb.Where("rm.ctx = ?", ctx)
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-// CheckRoleMutex 检测两个角色是否互斥
+// CheckRoleMutex 检测两个角色是否互斥，查询出错时认为两个角色互斥
 func (this *Repository) CheckRoleMutex(ctx, roleId, mutexRoleId int64) bool {
+	ok, err := this.CheckRoleMutexE(ctx, roleId, mutexRoleId)
+	if err != nil {
+		return true
+	}
+	return ok
+}
+
+// CheckRoleMutexE 检测两个角色是否互斥
+func (this *Repository) CheckRoleMutexE(ctx, roleId, mutexRoleId int64) (ok bool, err error) {
+	if this.inheritConstraint {
+		mutexRoleList, err := this.getInheritedMutexRoles(this.tableRoleMutex, ctx, []int64{roleId, mutexRoleId})
+		if err != nil {
+			return false, err
+		}
+		return len(mutexRoleList) > 0, nil
+	}
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
 	sb.Selects("m.ctx", "m.role_id", "m.mutex_role_id", "m.created_on")
@@ -124,11 +143,34 @@ func (this *Repository) CheckRoleMutex(ctx, roleId, mutexRoleId int64) bool {
 	sb.Where("m.mutex_role_id = ?", mutexRoleId)
 
 	var mutex *odin.RoleMutex
-	if err := sb.Scan(this.db, &mutex); err != nil {
-		return true
+	if err = sb.ScanContext(this.Context(), this.db, &mutex); err != nil {
+		return false, err
 	}
-	if mutex == nil {
-		return false
+	return mutex != nil, nil
+}
+
+// getInheritedMutexRoles 获取角色之间的互斥关系，互斥关系会作用到子孙角色上，即角色 A 与角色 B 互斥时，角色 A 及其子孙角色与角色 B 及其子孙角色都互斥
+//
+// 参数 table 为互斥关系表，返回结果中的 RoleId 及 MutexRoleId 都为 roleIds 中的元素
+func (this *Repository) getInheritedMutexRoles(table string, ctx int64, roleIds []int64) (result []*odin.RoleMutex, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("m.ctx", "x.id AS role_id", "y.id AS mutex_role_id", "m.created_on")
+	sb.Selects("x.name AS role_name", "x.alias_name AS role_alias_name")
+	sb.Selects("y.name AS mutex_role_name", "y.alias_name AS mutex_role_alias_name")
+	sb.From(table, "AS m")
+	sb.LeftJoin(this.tableRole, "AS r ON r.id = m.role_id")
+	sb.LeftJoin(this.tableRole, "AS rm ON rm.id = m.mutex_role_id")
+	sb.LeftJoin(this.tableRole, "AS x ON x.ctx = r.ctx AND x.left_value >= r.left_value AND x.right_value <= r.right_value")
+	sb.LeftJoin(this.tableRole, "AS y ON y.ctx = rm.ctx AND y.left_value >= rm.left_value AND y.right_value <= rm.right_value")
+	sb.Where("m.ctx = ?", ctx)
+	sb.Where("r.ctx = ?", ctx)
+	sb.Where("rm.ctx = ?", ctx)
+	sb.Where(dbs.IN("x.id", roleIds))
+	sb.Where(dbs.IN("y.id", roleIds))
+	sb.Where("x.id <> y.id")
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
 	}
-	return true
+	return result, nil
 }
@@ -13,6 +13,7 @@ func (this *Repository) GetPermissions(ctx int64, status odin.Status, keywords s
 	sb.From(this.tablePermission, "AS p")
 	if isGrantedToRole > 0 {
 		sb.Selects("(CASE WHEN rp.role_id IS NULL THEN 0 ELSE 1 END) AS granted")
+		sb.Selects("rp.cond")
 		sb.LeftJoin(this.tableRolePermission, "AS rp ON rp.permission_id = p.id AND rp.role_id = ?", isGrantedToRole)
 	}
 	if limitedInRole > 0 {
@@ -34,7 +35,7 @@ func (this *Repository) GetPermissions(ctx int64, status odin.Status, keywords s
 		sb.Where(or)
 	}
 	sb.OrderBy("p.ctx", "p.id")
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -49,7 +50,7 @@ func (this *Repository) GetPermissionsWithIds(ctx int64, permissionIds ...int64)
 	sb.Where(dbs.IN("p.id", permissionIds))
 	sb.OrderBy("p.ctx", "p.id")
 	sb.Limit(int64(len(permissionIds)))
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -64,7 +65,7 @@ func (this *Repository) GetPermissionsWithNames(ctx int64, names ...string) (res
 	sb.Where(dbs.IN("p.name", names))
 	sb.OrderBy("p.ctx", "p.id")
 	sb.Limit(int64(len(names)))
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -74,13 +75,14 @@ func (this *Repository) GetPermissionsWithRoleId(ctx int64, roleId int64) (resul
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
 	sb.Selects("p.id", "p.group_id", "p.ctx", "p.name", "p.alias_name", "p.status", "p.description", "p.created_on", "p.updated_on")
+	sb.Selects("rp.cond")
 	sb.From(this.tableRolePermission, "AS rp")
 	sb.LeftJoin(this.tablePermission, "AS p ON p.id = rp.permission_id")
 	sb.Where("rp.ctx = ?", ctx)
 	sb.Where("rp.role_id = ?", roleId)
 	sb.Where("p.ctx = ?", ctx)
 	sb.OrderBy("p.ctx", "p.id")
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -99,7 +101,7 @@ func (this *Repository) getPermission(ctx int64, permissionId int64, name string
 		sb.Where("p.name = ?", name)
 	}
 	sb.Limit(1)
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -121,7 +123,7 @@ func (this *Repository) AddPermission(ctx, groupId int64, name, aliasName, descr
 	ib.Table(this.tablePermission)
 	ib.Columns("id", "group_id", "ctx", "name", "alias_name", "status", "description", "created_on", "updated_on")
 	ib.Values(nId, groupId, ctx, name, aliasName, status, description, now, now)
-	if _, err = ib.Exec(this.db); err != nil {
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
 		return 0, err
 	}
 	return nId, nil
@@ -139,7 +141,7 @@ func (this *Repository) UpdatePermission(ctx, permissionId, groupId int64, alias
 	ub.SET("updated_on", now)
 	ub.Where("ctx = ? AND id = ?", ctx, permissionId)
 	ub.Limit(1)
-	_, err = ub.Exec(this.db)
+	_, err = ub.ExecContext(this.Context(), this.db)
 	return err
 }
 
@@ -152,10 +154,51 @@ func (this *Repository) UpdatePermissionStatus(ctx, permissionId int64, status o
 	ub.SET("updated_on", now)
 	ub.Where("ctx = ? AND id = ?", ctx, permissionId)
 	ub.Limit(1)
-	_, err = ub.Exec(this.db)
+	_, err = ub.ExecContext(this.Context(), this.db)
 	return err
 }
 
+func (this *Repository) UpdatePermissionName(ctx, permissionId int64, name string) (err error) {
+	var now = time.Now()
+	var ub = dbs.NewUpdateBuilder()
+	ub.UseDialect(this.dialect)
+	ub.Table(this.tablePermission)
+	ub.SET("name", name)
+	ub.SET("updated_on", now)
+	ub.Where("ctx = ? AND id = ?", ctx, permissionId)
+	_, err = ub.ExecContext(this.Context(), this.db)
+	return err
+}
+
+func (this *Repository) DeletePermissionWithIds(ctx int64, permissionIds []int64) (err error) {
+	if len(permissionIds) == 0 {
+		return nil
+	}
+
+	var relations = []struct {
+		table  string
+		column string
+	}{
+		{this.tableRolePermission, "permission_id"},
+		{this.tablePrePermission, "permission_id"},
+		{this.tablePrePermission, "pre_permission_id"},
+		{this.tableDeny, "permission_id"},
+		{this.tablePermission, "id"},
+	}
+
+	for _, relation := range relations {
+		var rb = dbs.NewDeleteBuilder()
+		rb.UseDialect(this.dialect)
+		rb.Table(relation.table)
+		rb.Where("ctx = ?", ctx)
+		rb.Where(dbs.IN(relation.column, permissionIds))
+		if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (this *Repository) GrantPermissionWithIds(ctx, roleId int64, permissionIds []int64) (err error) {
 	if len(permissionIds) == 0 {
 		return nil
@@ -169,7 +212,7 @@ func (this *Repository) GrantPermissionWithIds(ctx, roleId int64, permissionIds
 	for _, permissionId := range permissionIds {
 		ib.Values(ctx, roleId, permissionId, now)
 	}
-	if _, err = ib.Exec(this.db); err != nil {
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 	return nil
@@ -191,7 +234,7 @@ func (this *Repository) RevokePermissionWithIds(ctx, roleId int64, permissionIds
 	rb.Where("rp.id = ?", roleId)
 	rb.Where("r.ctx = ?", ctx)
 	rb.Where(dbs.IN("permission_id", permissionIds))
-	if _, err = rb.Exec(this.db); err != nil {
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 	return nil
@@ -209,42 +252,55 @@ func (this *Repository) RevokeAllPermission(ctx, roleId int64) (err error) {
 	rb.Where("rp.ctx = ?", ctx)
 	rb.Where("rp.id = ?", roleId)
 	rb.Where("r.ctx = ?", ctx)
-	if _, err = rb.Exec(this.db); err != nil {
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (this *Repository) GetGrantedPermissions(ctx int64, target string) (result []*odin.Permission, err error) {
+	if this.matcher != nil {
+		return this.matchGrantedPermissions(ctx, target)
+	}
+	return this.getGrantedPermissions(ctx, target, true)
+}
+
+// getGrantedPermissions 获取授予给 target 的权限，参数 withDeny 为 false 时不排除已经禁止 target 使用的权限
+func (this *Repository) getGrantedPermissions(ctx int64, target string, withDeny bool) (result []*odin.Permission, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
 	sb.Selects("p.id", "p.group_id", "p.ctx", "p.name", "p.alias_name", "p.status", "p.description", "p.created_on", "p.updated_on")
 	sb.Selects("(CASE WHEN p.id IS NULL THEN 0 ELSE 1 END) AS granted")
-	sb.From(this.tableRolePermission, "AS rp")
+	sb.From(this.tableGrant, "AS g")
+	this.joinGrantedRole(sb, ctx, "g")
+	sb.LeftJoin(this.tableRolePermission, "AS rp ON rp.role_id = r.id")
 	sb.LeftJoin(this.tablePermission, "AS p ON p.id = rp.permission_id")
-	sb.LeftJoin(this.tableGrant, "AS g ON g.role_id = rp.role_id")
-	sb.Where("rp.ctx = ?", ctx)
-	sb.Where("g.ctx = ? AND g.target = ?", ctx, target)
+	this.whereGranted(sb, "g", ctx, target)
+	sb.Where("r.ctx = ? AND r.status = ?", ctx, odin.Enable)
+	sb.Where("rp.ctx = ? AND rp.cond = ?", ctx, "")
 	sb.Where("p.ctx = ? AND p.status = ?", ctx, odin.Enable)
+	if withDeny {
+		this.whereNotDenied(sb, "p", ctx, target)
+	}
 	sb.GroupBy("p.id")
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-// AddPrePermission 添加授予权限的先决权限条件
-func (this *Repository) AddPrePermission(ctx, permissionId int64, prePermissionIds []int64) (err error) {
+// AddPrePermission 添加授予权限的先决权限条件，如果先决权限条件已经存在，则更新其 auto_grant 字段
+func (this *Repository) AddPrePermission(ctx, permissionId int64, prePermissionIds []int64, autoGrant bool) (err error) {
 	var now = time.Now()
 	var ib = dbs.NewInsertBuilder()
 	ib.UseDialect(this.dialect)
-	ib.Options("IGNORE")
 	ib.Table(this.tablePrePermission)
 	ib.Columns("ctx", "permission_id", "pre_permission_id", "auto_grant", "created_on")
 	for _, prePermissionId := range prePermissionIds {
-		ib.Values(ctx, permissionId, prePermissionId, false, now)
+		ib.Values(ctx, permissionId, prePermissionId, autoGrant, now)
 	}
-	if _, err = ib.Exec(this.db); err != nil {
+	ib.Suffix("ON DUPLICATE KEY UPDATE auto_grant = VALUES(auto_grant)")
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 	return nil
@@ -259,7 +315,7 @@ func (this *Repository) RemovePrePermission(ctx, permissionId int64, prePermissi
 	rb.Where("permission_id = ?", permissionId)
 	rb.Where(dbs.IN("pre_permission_id", prePermissionIds))
 	rb.Limit(int64(len(prePermissionIds)))
-	if _, err = rb.Exec(this.db); err != nil {
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 	return nil
@@ -272,7 +328,7 @@ func (this *Repository) CleanPrePermission(ctx, permissionId int64) (err error)
 	rb.Table(this.tablePrePermission)
 	rb.Where("ctx = ?", ctx)
 	rb.Where("permission_id = ?", permissionId)
-	if _, err = rb.Exec(this.db); err != nil {
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 	return nil
@@ -292,7 +348,7 @@ func (this *Repository) GetPrePermissions(ctx, permissionId int64) (result []*od
 	sb.Where("pp.permission_id = ?", permissionId)
 	sb.Where("pp.ctx = ?", ctx)
 	sb.Where("ppp.ctx = ?", ctx)
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -312,8 +368,91 @@ func (this *Repository) GetPrePermissionsWithIds(ctx int64, permissionIds []int6
 	sb.Where(dbs.IN("pp.permission_id", permissionIds))
 	sb.Where("pp.ctx = ?", ctx)
 	sb.Where("ppp.ctx = ?", ctx)
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetPrePermissionsWithPreIds 获取将指定权限列表作为先决权限条件的数据
+func (this *Repository) GetPrePermissionsWithPreIds(ctx int64, prePermissionIds []int64) (result []*odin.PrePermission, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("pp.ctx", "pp.permission_id", "pp.pre_permission_id", "pp.auto_grant", "pp.created_on")
+	sb.Selects("p.name AS permission_name", "p.alias_name AS permission_alias_name")
+	sb.Selects("ppp.name AS pre_permission_name", "ppp.alias_name AS pre_permission_alias_name")
+	sb.From(this.tablePrePermission, "AS pp")
+	sb.LeftJoin(this.tablePermission, "AS p ON p.id = pp.permission_id")
+	sb.LeftJoin(this.tablePermission, "AS ppp ON ppp.id = pp.pre_permission_id")
+	sb.Where("p.ctx = ?", ctx)
+	sb.Where(dbs.IN("pp.pre_permission_id", prePermissionIds))
+	sb.Where("pp.ctx = ?", ctx)
+	sb.Where("ppp.ctx = ?", ctx)
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
 }
+
+// UpdateRolePermissionCond 更新角色权限绑定的附加条件
+func (this *Repository) UpdateRolePermissionCond(ctx, roleId, permissionId int64, cond string) (err error) {
+	var ub = dbs.NewUpdateBuilder()
+	ub.UseDialect(this.dialect)
+	ub.Table(this.tableRolePermission)
+	ub.SET("cond", cond)
+	ub.Where("ctx = ? AND role_id = ? AND permission_id = ?", ctx, roleId, permissionId)
+	if _, err = ub.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetConditionalPermissions 获取 target 拥有的带有附加条件的权限绑定，每一个绑定对应一条数据，不包含已经禁止 target 使用的权限
+func (this *Repository) GetConditionalPermissions(ctx int64, target string, permissionName string) (result []*odin.Permission, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("p.id", "p.group_id", "p.ctx", "p.name", "p.alias_name", "p.status", "p.description", "p.created_on", "p.updated_on")
+	sb.Selects("rp.cond")
+	sb.From(this.tableGrant, "AS g")
+	this.joinGrantedRole(sb, ctx, "g")
+	sb.LeftJoin(this.tableRolePermission, "AS rp ON rp.role_id = r.id")
+	sb.LeftJoin(this.tablePermission, "AS p ON p.id = rp.permission_id")
+	this.whereGranted(sb, "g", ctx, target)
+	sb.Where("r.ctx = ? AND r.status = ?", ctx, odin.Enable)
+	sb.Where("rp.ctx = ? AND rp.cond <> ?", ctx, "")
+	sb.Where("p.ctx = ? AND p.status = ?", ctx, odin.Enable)
+	if this.matcher == nil {
+		sb.Where("p.name = ?", permissionName)
+		this.whereNotDenied(sb, "p", ctx, target)
+	}
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	if this.matcher == nil {
+		return result, nil
+	}
+
+	// 启用权限名称匹配器时，在程序中匹配权限名称及禁止权限
+	pList, err := this.GetPermissionsWithNames(ctx, permissionName)
+	if err != nil {
+		return nil, err
+	}
+	if len(pList) == 0 || pList[0].Status != odin.Enable {
+		return nil, nil
+	}
+	deniedList, err := this.getDeniedPermissions(ctx, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	var deniedNames = permissionNames(deniedList)
+	if this.matcher.MatchAny(deniedNames, permissionName) {
+		return nil, nil
+	}
+	var matched = make([]*odin.Permission, 0, len(result))
+	for _, p := range result {
+		if this.matcher.Match(p.Name, permissionName) {
+			matched = append(matched, p)
+		}
+	}
+	return matched, nil
+}
@@ -17,7 +17,7 @@ func (this *Repository) AddPreRole(ctx, roleId int64, preRoleIds []int64) (err e
 	for _, preRoleId := range preRoleIds {
 		ib.Values(ctx, roleId, preRoleId, now)
 	}
-	if _, err = ib.Exec(this.db); err != nil {
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 	return nil
@@ -32,7 +32,7 @@ func (this *Repository) RemovePreRole(ctx, roleId int64, preRoleIds []int64) (er
 	rb.Where("role_id = ?", roleId)
 	rb.Where(dbs.IN("pre_role_id", preRoleIds))
 	rb.Limit(int64(len(preRoleIds)))
-	if _, err = rb.Exec(this.db); err != nil {
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 	return nil
@@ -45,7 +45,7 @@ func (this *Repository) CleanPreRole(ctx, roleId int64) (err error) {
 	rb.Table(this.tablePreRole)
 	rb.Where("ctx = ?", ctx)
 	rb.Where("role_id = ?", roleId)
-	if _, err = rb.Exec(this.db); err != nil {
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 	return nil
@@ -65,7 +65,7 @@ func (this *Repository) GetPreRoles(ctx, roleId int64) (result []*odin.PreRole,
 	sb.Where("p.role_id = ?", roleId)
 	sb.Where("r.ctx = ?", ctx)
 	sb.Where("pr.ctx = ?", ctx)
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -73,6 +73,9 @@ func (this *Repository) GetPreRoles(ctx, roleId int64) (result []*odin.PreRole,
 
 // GetPreRolesWithIds 获取授予角色列表的先决角色条件
 func (this *Repository) GetPreRolesWithIds(ctx int64, roleIds []int64) (result []*odin.PreRole, err error) {
+	if this.inheritConstraint {
+		return this.getInheritedPreRoles(ctx, "x.id", roleIds)
+	}
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
 	sb.Selects("p.ctx", "p.role_id", "p.pre_role_id", "p.created_on")
@@ -85,7 +88,54 @@ func (this *Repository) GetPreRolesWithIds(ctx int64, roleIds []int64) (result [
 	sb.Where(dbs.IN("p.role_id", roleIds))
 	sb.Where("r.ctx = ?", ctx)
 	sb.Where("pr.ctx = ?", ctx)
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetPreRolesWithPreIds 获取将指定角色列表作为先决角色条件的数据
+func (this *Repository) GetPreRolesWithPreIds(ctx int64, preRoleIds []int64) (result []*odin.PreRole, err error) {
+	if this.inheritConstraint {
+		return this.getInheritedPreRoles(ctx, "p.pre_role_id", preRoleIds)
+	}
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("p.ctx", "p.role_id", "p.pre_role_id", "p.created_on")
+	sb.Selects("r.name AS role_name", "r.alias_name AS role_alias_name")
+	sb.Selects("pr.name AS pre_role_name", "pr.alias_name AS pre_role_alias_name")
+	sb.From(this.tablePreRole, "AS p")
+	sb.LeftJoin(this.tableRole, "AS r ON r.id = p.role_id")
+	sb.LeftJoin(this.tableRole, "AS pr ON pr.id = p.pre_role_id")
+	sb.Where("p.ctx = ?", ctx)
+	sb.Where(dbs.IN("p.pre_role_id", preRoleIds))
+	sb.Where("r.ctx = ?", ctx)
+	sb.Where("pr.ctx = ?", ctx)
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// getInheritedPreRoles 获取角色先决条件，先决条件会作用到子孙角色上，即授予角色 A 需要先授予角色 P 时，授予角色 A 的子孙角色同样需要先授予角色 P
+//
+// 参数 column 为筛选条件作用的字段，x.id 为需要先决条件的角色，p.pre_role_id 为先决角色
+func (this *Repository) getInheritedPreRoles(ctx int64, column string, ids []int64) (result []*odin.PreRole, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("p.ctx", "x.id AS role_id", "p.pre_role_id", "p.created_on")
+	sb.Selects("x.name AS role_name", "x.alias_name AS role_alias_name")
+	sb.Selects("pr.name AS pre_role_name", "pr.alias_name AS pre_role_alias_name")
+	sb.From(this.tablePreRole, "AS p")
+	sb.LeftJoin(this.tableRole, "AS r ON r.id = p.role_id")
+	sb.LeftJoin(this.tableRole, "AS x ON x.ctx = r.ctx AND x.left_value >= r.left_value AND x.right_value <= r.right_value")
+	sb.LeftJoin(this.tableRole, "AS pr ON pr.id = p.pre_role_id")
+	sb.Where("p.ctx = ?", ctx)
+	sb.Where(dbs.IN(column, ids))
+	sb.Where("r.ctx = ?", ctx)
+	sb.Where("pr.ctx = ?", ctx)
+	sb.Where("x.id <> p.pre_role_id")
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -0,0 +1,170 @@
+package sql
+
+import (
+	"github.com/smartwalle/dbs"
+	"github.com/smartwalle/odin"
+	"strings"
+	"time"
+)
+
+// resourcePatterns 获取可以匹配资源 resource 的所有资源标识
+//
+// 如资源 project:42:doc:7 可以被 project:42:doc:7、project:42:doc:*、project:42:*、project:* 及 * 匹配
+func resourcePatterns(resource string) []string {
+	var parts = strings.Split(resource, ":")
+	var patterns = make([]string, 0, len(parts)+1)
+	patterns = append(patterns, resource)
+	for i := len(parts) - 1; i > 0; i-- {
+		patterns = append(patterns, strings.Join(parts[:i], ":")+":*")
+	}
+	if resource != "*" {
+		patterns = append(patterns, "*")
+	}
+	return patterns
+}
+
+func (this *Repository) GetGrantedRolesOn(ctx int64, target, resource string) (result []*odin.Role, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("r.id", "r.group_id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.max_targets", "r.created_on", "r.updated_on")
+	sb.From(this.tableResourceGrant, "AS g")
+	sb.LeftJoin(this.tableRole, "AS r ON r.id = g.role_id")
+	sb.Where("g.ctx = ? AND g.target = ? AND g.resource = ?", ctx, target, resource)
+	sb.Where("r.ctx = ?", ctx)
+	sb.OrderBy("r.left_value")
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (this *Repository) GrantRoleOnWithIds(ctx int64, target, resource string, roleIds ...int64) (err error) {
+	if len(roleIds) == 0 {
+		return nil
+	}
+	var now = time.Now()
+	var ib = dbs.NewInsertBuilder()
+	ib.UseDialect(this.dialect)
+	ib.Options("IGNORE")
+	ib.Table(this.tableResourceGrant)
+	ib.Columns("ctx", "role_id", "target", "resource", "created_on")
+	for _, rId := range roleIds {
+		ib.Values(ctx, rId, target, resource, now)
+	}
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (this *Repository) RevokeRoleOnWithIds(ctx int64, target, resource string, roleIds ...int64) (err error) {
+	if len(roleIds) == 0 {
+		return nil
+	}
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableResourceGrant)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("target = ?", target)
+	rb.Where("resource = ?", resource)
+	rb.Where(dbs.IN("role_id", roleIds))
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (this *Repository) CheckPermissionOn(ctx int64, target string, permissionName string, resource string) bool {
+	ok, _ := this.CheckPermissionOnE(ctx, target, permissionName, resource)
+	return ok
+}
+
+func (this *Repository) CheckPermissionOnE(ctx int64, target string, permissionName string, resource string) (ok bool, err error) {
+	var patterns = resourcePatterns(resource)
+	if this.matcher != nil {
+		return this.matchPermission(ctx, target, permissionName, patterns)
+	}
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("g.ctx", "g.target", "g.role_id")
+	sb.Selects("r.name AS role_name")
+	sb.Selects("p.id AS permission_id", "p.name AS permission_name")
+	sb.From(this.tableResourceGrant, "AS g")
+	this.joinGrantedRole(sb, ctx, "g")
+	sb.LeftJoin(this.tableRolePermission, "AS rp ON rp.role_id = r.id")
+	sb.LeftJoin(this.tablePermission, "AS p ON p.id = rp.permission_id")
+	sb.Where("g.ctx = ? AND g.target = ?", ctx, target)
+	sb.Where(dbs.IN("g.resource", patterns))
+	sb.Where("r.ctx = ? AND r.status = ?", ctx, odin.Enable)
+	sb.Where("rp.ctx = ? AND rp.cond = ?", ctx, "")
+	sb.Where("p.ctx = ? AND p.name = ? AND p.status = ?", ctx, permissionName, odin.Enable)
+	this.whereNotDenied(sb, "p", ctx, target)
+	this.whereNotDeniedOn(sb, "p", ctx, target, patterns)
+	sb.Limit(1)
+	var grant *odin.Grant
+	if err = sb.ScanContext(this.Context(), this.db, &grant); err != nil {
+		return false, err
+	}
+	if grant != nil {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (this *Repository) CheckPermissionOnWithId(ctx int64, target string, permissionId int64, resource string) bool {
+	ok, _ := this.CheckPermissionOnWithIdE(ctx, target, permissionId, resource)
+	return ok
+}
+
+func (this *Repository) CheckPermissionOnWithIdE(ctx int64, target string, permissionId int64, resource string) (ok bool, err error) {
+	var patterns = resourcePatterns(resource)
+	if this.matcher != nil {
+		return this.matchPermissionWithId(ctx, target, permissionId, patterns)
+	}
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("g.ctx", "g.target", "g.role_id")
+	sb.Selects("r.name AS role_name")
+	sb.Selects("p.id AS permission_id", "p.name AS permission_name")
+	sb.From(this.tableResourceGrant, "AS g")
+	this.joinGrantedRole(sb, ctx, "g")
+	sb.LeftJoin(this.tableRolePermission, "AS rp ON rp.role_id = r.id")
+	sb.LeftJoin(this.tablePermission, "AS p ON p.id = rp.permission_id")
+	sb.Where("g.ctx = ? AND g.target = ?", ctx, target)
+	sb.Where(dbs.IN("g.resource", patterns))
+	sb.Where("r.ctx = ? AND r.status = ?", ctx, odin.Enable)
+	sb.Where("rp.ctx = ? AND rp.cond = ?", ctx, "")
+	sb.Where("p.ctx = ? AND p.id = ? AND p.status = ?", ctx, permissionId, odin.Enable)
+	this.whereNotDenied(sb, "p", ctx, target)
+	this.whereNotDeniedOn(sb, "p", ctx, target, patterns)
+	sb.Limit(1)
+	var grant *odin.Grant
+	if err = sb.ScanContext(this.Context(), this.db, &grant); err != nil {
+		return false, err
+	}
+	if grant != nil {
+		return true, nil
+	}
+	return false, nil
+}
+
+// getGrantedPermissionsOn 获取通过资源授权授予给 target 的权限，不排除已经禁止 target 使用的权限，参数 patterns 为可以匹配该资源的资源标识列表
+func (this *Repository) getGrantedPermissionsOn(ctx int64, target string, patterns []string) (result []*odin.Permission, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("p.id", "p.group_id", "p.ctx", "p.name", "p.alias_name", "p.status", "p.description", "p.created_on", "p.updated_on")
+	sb.From(this.tableResourceGrant, "AS g")
+	this.joinGrantedRole(sb, ctx, "g")
+	sb.LeftJoin(this.tableRolePermission, "AS rp ON rp.role_id = r.id")
+	sb.LeftJoin(this.tablePermission, "AS p ON p.id = rp.permission_id")
+	sb.Where("g.ctx = ? AND g.target = ?", ctx, target)
+	sb.Where(dbs.IN("g.resource", patterns))
+	sb.Where("r.ctx = ? AND r.status = ?", ctx, odin.Enable)
+	sb.Where("rp.ctx = ? AND rp.cond = ?", ctx, "")
+	sb.Where("p.ctx = ? AND p.status = ?", ctx, odin.Enable)
+	sb.GroupBy("p.id")
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -9,7 +9,7 @@ import (
 func (this *Repository) GetRoles(ctx int64, parentId int64, status odin.Status, keywords, isGrantedToTarget string) (result []*odin.Role, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
-	sb.Selects("r.id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.created_on", "r.updated_on")
+	sb.Selects("r.id", "r.group_id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.max_targets", "r.created_on", "r.updated_on")
 	sb.From(this.tableRole, "AS r")
 	if isGrantedToTarget != "" {
 		sb.Selects("(CASE WHEN rg.target IS NULL THEN 0 ELSE 1 END) AS granted")
@@ -31,7 +31,7 @@ func (this *Repository) GetRoles(ctx int64, parentId int64, status odin.Status,
 	}
 	sb.OrderBy("r.ctx", "r.id")
 
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 
@@ -41,7 +41,7 @@ func (this *Repository) GetRoles(ctx int64, parentId int64, status odin.Status,
 func (this *Repository) GetRolesInTarget(ctx int64, limitedInTarget string, status odin.Status, keywords, isGrantedToTarget string) (result []*odin.Role, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
-	sb.Selects("r.id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.created_on", "r.updated_on")
+	sb.Selects("r.id", "r.group_id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.max_targets", "r.created_on", "r.updated_on")
 	sb.From(this.tableRole, "AS r")
 
 	if isGrantedToTarget != "" {
@@ -53,8 +53,7 @@ func (this *Repository) GetRolesInTarget(ctx int64, limitedInTarget string, stat
 	sb.LeftJoin(this.tableRole, "AS rp ON rp.left_value <= r.left_value AND rp.right_value >= r.right_value")
 	sb.LeftJoin(this.tableGrant, "AS rg ON rg.role_id = rp.id")
 
-	sb.Where("rg.ctx = ?", ctx)
-	sb.Where("rg.target = ?", limitedInTarget)
+	this.whereGranted(sb, "rg", ctx, limitedInTarget)
 	sb.Where("rp.ctx = ?", ctx)
 	if status > 0 {
 		sb.Where("rp.status = ?", status)
@@ -75,7 +74,7 @@ func (this *Repository) GetRolesInTarget(ctx int64, limitedInTarget string, stat
 		sb.GroupBy("rgg.target")
 		sb.OrderBy("rgg.target")
 	}
-	if err := sb.Scan(this.db, &result); err != nil {
+	if err := sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, err
@@ -84,13 +83,13 @@ func (this *Repository) GetRolesInTarget(ctx int64, limitedInTarget string, stat
 func (this *Repository) GetRolesWithIds(ctx int64, roleIds ...int64) (result []*odin.Role, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
-	sb.Selects("r.id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.created_on", "r.updated_on")
+	sb.Selects("r.id", "r.group_id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.max_targets", "r.created_on", "r.updated_on")
 	sb.From(this.tableRole, "AS r")
 	sb.Where("r.ctx = ?", ctx)
 	sb.Where(dbs.IN("r.id", roleIds))
 	sb.OrderBy("r.ctx", "r.id")
 	sb.Limit(int64(len(roleIds)))
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -99,13 +98,33 @@ func (this *Repository) GetRolesWithIds(ctx int64, roleIds ...int64) (result []*
 func (this *Repository) GetRolesWithNames(ctx int64, names ...string) (result []*odin.Role, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
-	sb.Selects("r.id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.created_on", "r.updated_on")
+	sb.Selects("r.id", "r.group_id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.max_targets", "r.created_on", "r.updated_on")
 	sb.From(this.tableRole, "AS r")
 	sb.Where("r.ctx = ?", ctx)
 	sb.Where(dbs.IN("r.name", names))
 	sb.OrderBy("r.ctx", "r.id")
 	sb.Limit(int64(len(names)))
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (this *Repository) GetRolesWithGroupIds(ctx int64, status odin.Status, groupIds []int64) (result []*odin.Role, err error) {
+	if len(groupIds) == 0 {
+		return nil, nil
+	}
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("r.id", "r.group_id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.max_targets", "r.created_on", "r.updated_on")
+	sb.From(this.tableRole, "AS r")
+	sb.Where("r.ctx = ?", ctx)
+	sb.Where(dbs.IN("r.group_id", groupIds))
+	if status != 0 {
+		sb.Where("r.status = ?", status)
+	}
+	sb.OrderBy("r.ctx", "r.left_value")
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -114,7 +133,7 @@ func (this *Repository) GetRolesWithNames(ctx int64, names ...string) (result []
 func (this *Repository) getRole(ctx int64, roleId int64, name string) (result *odin.Role, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
-	sb.Selects("r.id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.created_on", "r.updated_on")
+	sb.Selects("r.id", "r.group_id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.max_targets", "r.created_on", "r.updated_on")
 	sb.From(this.tableRole, "AS r")
 	sb.Where("r.ctx = ?", ctx)
 	if roleId > 0 {
@@ -124,7 +143,7 @@ func (this *Repository) getRole(ctx int64, roleId int64, name string) (result *o
 		sb.Where("r.name = ?", name)
 	}
 	sb.Limit(1)
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -156,6 +175,20 @@ func (this *Repository) AddRole(ctx int64, parent *odin.Role, name, aliasName, d
 	return this.insertRoleToLast(parent, name, aliasName, description, status)
 }
 
+func (this *Repository) AddRoleBefore(ctx int64, sibling *odin.Role, name, aliasName, description string, status odin.Status) (result int64, err error) {
+	if err = this.shiftRoleValue(ctx, sibling.LeftValue-1, 2); err != nil {
+		return 0, err
+	}
+	return this.insertRole(ctx, sibling.ParentId, sibling.LeftValue, sibling.LeftValue+1, sibling.Depth, name, aliasName, description, status)
+}
+
+func (this *Repository) AddRoleAfter(ctx int64, sibling *odin.Role, name, aliasName, description string, status odin.Status) (result int64, err error) {
+	if err = this.shiftRoleValue(ctx, sibling.RightValue, 2); err != nil {
+		return 0, err
+	}
+	return this.insertRole(ctx, sibling.ParentId, sibling.RightValue+1, sibling.RightValue+2, sibling.Depth, name, aliasName, description, status)
+}
+
 func (this *Repository) insertRoleToRoot(parent *odin.Role, name, aliasName, description string, status odin.Status) (result int64, err error) {
 	return this.insertRole(parent.Ctx, parent.Id, parent.RightValue+1, parent.RightValue+2, parent.Depth, name, aliasName, description, status)
 }
@@ -167,7 +200,7 @@ func (this *Repository) insertRoleToLast(parent *odin.Role, name, aliasName, des
 	ubLeft.SET("left_value", dbs.SQL("left_value + 2"))
 	ubLeft.SET("updated_on", time.Now())
 	ubLeft.Where("ctx = ? AND left_value > ?", parent.Ctx, parent.RightValue)
-	if _, err = ubLeft.Exec(this.db); err != nil {
+	if _, err = ubLeft.ExecContext(this.Context(), this.db); err != nil {
 		return 0, err
 	}
 
@@ -177,7 +210,7 @@ func (this *Repository) insertRoleToLast(parent *odin.Role, name, aliasName, des
 	ubRight.SET("right_value", dbs.SQL("right_value + 2"))
 	ubRight.SET("updated_on", time.Now())
 	ubRight.Where("ctx = ? AND right_value >= ?", parent.Ctx, parent.RightValue)
-	if _, err = ubRight.Exec(this.db); err != nil {
+	if _, err = ubRight.ExecContext(this.Context(), this.db); err != nil {
 		return 0, err
 	}
 	return this.insertRole(parent.Ctx, parent.Id, parent.RightValue, parent.RightValue+1, parent.Depth+1, name, aliasName, description, status)
@@ -189,9 +222,9 @@ func (this *Repository) insertRole(ctx, parentId int64, leftValue, rightValue in
 	var ib = dbs.NewInsertBuilder()
 	ib.UseDialect(this.dialect)
 	ib.Table(this.tableRole)
-	ib.Columns("id", "ctx", "name", "alias_name", "status", "description", "parent_id", "left_value", "right_value", "depth", "created_on", "updated_on")
-	ib.Values(nId, ctx, name, aliasName, status, description, parentId, leftValue, rightValue, depth, now, now)
-	if _, err = ib.Exec(this.db); err != nil {
+	ib.Columns("id", "group_id", "ctx", "name", "alias_name", "status", "description", "parent_id", "left_value", "right_value", "depth", "created_on", "updated_on")
+	ib.Values(nId, 0, ctx, name, aliasName, status, description, parentId, leftValue, rightValue, depth, now, now)
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
 		return 0, err
 	}
 	return nId, nil
@@ -200,12 +233,12 @@ func (this *Repository) insertRole(ctx, parentId int64, leftValue, rightValue in
 func (this *Repository) getMaxRightRole(ctx int64) (result *odin.Role, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
-	sb.Selects("r.id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.created_on", "r.updated_on")
+	sb.Selects("r.id", "r.group_id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.max_targets", "r.created_on", "r.updated_on")
 	sb.From(this.tableRole, "AS r")
 	sb.Where("r.ctx = ?", ctx)
 	sb.OrderBy("r.right_value DESC")
 	sb.Limit(1)
-	if err = sb.Scan(this.db, &result); err != nil {
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -222,7 +255,7 @@ func (this *Repository) UpdateRole(ctx, roleId int64, aliasName, description str
 	ub.SET("updated_on", now)
 	ub.Where("ctx = ? AND id = ?", ctx, roleId)
 	ub.Limit(1)
-	_, err = ub.Exec(this.db)
+	_, err = ub.ExecContext(this.Context(), this.db)
 	return err
 }
 
@@ -235,14 +268,253 @@ func (this *Repository) UpdateRoleStatus(ctx, roleId int64, status odin.Status)
 	ub.SET("updated_on", now)
 	ub.Where("ctx = ? AND id = ?", ctx, roleId)
 	ub.Limit(1)
-	_, err = ub.Exec(this.db)
+	_, err = ub.ExecContext(this.Context(), this.db)
+	return err
+}
+
+func (this *Repository) UpdateRoleName(ctx, roleId int64, name string) (err error) {
+	var now = time.Now()
+	var ub = dbs.NewUpdateBuilder()
+	ub.UseDialect(this.dialect)
+	ub.Table(this.tableRole)
+	ub.SET("name", name)
+	ub.SET("updated_on", now)
+	ub.Where("ctx = ? AND id = ?", ctx, roleId)
+	_, err = ub.ExecContext(this.Context(), this.db)
 	return err
 }
 
+func (this *Repository) UpdateRoleGroupWithIds(ctx, groupId int64, roleIds []int64) (err error) {
+	if len(roleIds) == 0 {
+		return nil
+	}
+	var now = time.Now()
+	var ub = dbs.NewUpdateBuilder()
+	ub.UseDialect(this.dialect)
+	ub.Table(this.tableRole)
+	ub.SET("group_id", groupId)
+	ub.SET("updated_on", now)
+	ub.Where("ctx = ?", ctx)
+	ub.Where(dbs.IN("id", roleIds))
+	_, err = ub.ExecContext(this.Context(), this.db)
+	return err
+}
+
+func (this *Repository) MoveRole(ctx int64, role, parent *odin.Role) (err error) {
+	if parent == nil {
+		maxRole, err := this.getMaxRightRole(ctx)
+		if err != nil {
+			return err
+		}
+		return this.moveRole(ctx, role, 0, 1, maxRole.RightValue+1)
+	}
+	return this.moveRole(ctx, role, parent.Id, parent.Depth+1, parent.RightValue)
+}
+
+func (this *Repository) MoveRoleBefore(ctx int64, role, sibling *odin.Role) (err error) {
+	return this.moveRole(ctx, role, sibling.ParentId, sibling.Depth, sibling.LeftValue)
+}
+
+func (this *Repository) MoveRoleAfter(ctx int64, role, sibling *odin.Role) (err error) {
+	return this.moveRole(ctx, role, sibling.ParentId, sibling.Depth, sibling.RightValue+1)
+}
+
+// moveRole 将角色及其子角色移动到左值为 position 的位置，position 为移动前的左右值
+func (this *Repository) moveRole(ctx int64, role *odin.Role, parentId int64, depth int, position int64) (err error) {
+	var width = role.RightValue - role.LeftValue + 1
+
+	// 将子树的左右值置为负数，使其脱离原来的位置
+	var ubDetach = dbs.NewUpdateBuilder()
+	ubDetach.UseDialect(this.dialect)
+	ubDetach.Table(this.tableRole)
+	ubDetach.SET("left_value", dbs.SQL("0 - left_value"))
+	ubDetach.SET("right_value", dbs.SQL("0 - right_value"))
+	ubDetach.Where("ctx = ? AND left_value >= ? AND right_value <= ?", ctx, role.LeftValue, role.RightValue)
+	if _, err = ubDetach.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+
+	// 回收子树占用的左右值
+	if err = this.shiftRoleValue(ctx, role.RightValue, -width); err != nil {
+		return err
+	}
+	if position > role.RightValue {
+		position = position - width
+	}
+
+	// 在目标位置腾出子树需要的左右值
+	if err = this.shiftRoleValue(ctx, position-1, width); err != nil {
+		return err
+	}
+
+	// 将子树放置到目标位置
+	var ubAttach = dbs.NewUpdateBuilder()
+	ubAttach.UseDialect(this.dialect)
+	ubAttach.Table(this.tableRole)
+	ubAttach.SET("left_value", dbs.SQL("? - left_value", position-role.LeftValue))
+	ubAttach.SET("right_value", dbs.SQL("? - right_value", position-role.LeftValue))
+	ubAttach.SET("depth", dbs.SQL("depth + ?", depth-role.Depth))
+	ubAttach.SET("updated_on", time.Now())
+	ubAttach.Where("ctx = ? AND left_value < 0", ctx)
+	if _, err = ubAttach.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+
+	var ubParent = dbs.NewUpdateBuilder()
+	ubParent.UseDialect(this.dialect)
+	ubParent.Table(this.tableRole)
+	ubParent.SET("parent_id", parentId)
+	ubParent.Where("ctx = ? AND id = ?", ctx, role.Id)
+	if _, err = ubParent.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (this *Repository) DeleteRole(ctx int64, role *odin.Role, withChildren bool) (err error) {
+	if withChildren {
+		return this.deleteRoleWithChildren(ctx, role)
+	}
+	return this.deleteRoleOnly(ctx, role)
+}
+
+func (this *Repository) deleteRoleWithChildren(ctx int64, role *odin.Role) (err error) {
+	// 查询出该角色及其所有子角色
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("r.id", "r.group_id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.max_targets", "r.created_on", "r.updated_on")
+	sb.From(this.tableRole, "AS r")
+	sb.Where("r.ctx = ?", ctx)
+	sb.Where("r.left_value >= ? AND r.right_value <= ?", role.LeftValue, role.RightValue)
+	var roleList []*odin.Role
+	if err = sb.ScanContext(this.Context(), this.db, &roleList); err != nil {
+		return err
+	}
+
+	var roleIds = make([]int64, 0, len(roleList))
+	for _, r := range roleList {
+		roleIds = append(roleIds, r.Id)
+	}
+	if err = this.cleanRoleRelations(ctx, roleIds); err != nil {
+		return err
+	}
+
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableRole)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("left_value >= ? AND right_value <= ?", role.LeftValue, role.RightValue)
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+
+	// 回收该子树占用的左右值
+	return this.shiftRoleValue(ctx, role.RightValue, -(role.RightValue - role.LeftValue + 1))
+}
+
+func (this *Repository) deleteRoleOnly(ctx int64, role *odin.Role) (err error) {
+	if err = this.cleanRoleRelations(ctx, []int64{role.Id}); err != nil {
+		return err
+	}
+
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableRole)
+	rb.Where("ctx = ? AND id = ?", ctx, role.Id)
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+
+	// 子角色挂载到该角色的父角色下
+	var ubParent = dbs.NewUpdateBuilder()
+	ubParent.UseDialect(this.dialect)
+	ubParent.Table(this.tableRole)
+	ubParent.SET("parent_id", role.ParentId)
+	ubParent.SET("updated_on", time.Now())
+	ubParent.Where("ctx = ? AND parent_id = ?", ctx, role.Id)
+	if _, err = ubParent.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+
+	// 所有子角色上移一层
+	var ubChildren = dbs.NewUpdateBuilder()
+	ubChildren.UseDialect(this.dialect)
+	ubChildren.Table(this.tableRole)
+	ubChildren.SET("left_value", dbs.SQL("left_value - 1"))
+	ubChildren.SET("right_value", dbs.SQL("right_value - 1"))
+	ubChildren.SET("depth", dbs.SQL("depth - 1"))
+	ubChildren.SET("updated_on", time.Now())
+	ubChildren.Where("ctx = ? AND left_value > ? AND right_value < ?", ctx, role.LeftValue, role.RightValue)
+	if _, err = ubChildren.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+
+	return this.shiftRoleValue(ctx, role.RightValue, -2)
+}
+
+// shiftRoleValue 将左值或者右值大于 value 的角色的左值或者右值增加 delta
+func (this *Repository) shiftRoleValue(ctx, value, delta int64) (err error) {
+	var ubLeft = dbs.NewUpdateBuilder()
+	ubLeft.UseDialect(this.dialect)
+	ubLeft.Table(this.tableRole)
+	ubLeft.SET("left_value", dbs.SQL("left_value + ?", delta))
+	ubLeft.SET("updated_on", time.Now())
+	ubLeft.Where("ctx = ? AND left_value > ?", ctx, value)
+	if _, err = ubLeft.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+
+	var ubRight = dbs.NewUpdateBuilder()
+	ubRight.UseDialect(this.dialect)
+	ubRight.Table(this.tableRole)
+	ubRight.SET("right_value", dbs.SQL("right_value + ?", delta))
+	ubRight.SET("updated_on", time.Now())
+	ubRight.Where("ctx = ? AND right_value > ?", ctx, value)
+	if _, err = ubRight.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+// cleanRoleRelations 清除与角色相关的授权、权限、互斥关系及先决条件
+func (this *Repository) cleanRoleRelations(ctx int64, roleIds []int64) (err error) {
+	if len(roleIds) == 0 {
+		return nil
+	}
+
+	var relations = []struct {
+		table   string
+		columns []string
+	}{
+		{this.tableGrant, []string{"role_id"}},
+		{this.tableResourceGrant, []string{"role_id"}},
+		{this.tableDeny, []string{"role_id"}},
+		{this.tableDelegation, []string{"role_id"}},
+		{this.tableRolePermission, []string{"role_id"}},
+		{this.tableRoleMutex, []string{"role_id", "mutex_role_id"}},
+		{this.tableDynamicMutex, []string{"role_id", "mutex_role_id"}},
+		{this.tablePreRole, []string{"role_id", "pre_role_id"}},
+	}
+
+	for _, relation := range relations {
+		for _, column := range relation.columns {
+			var rb = dbs.NewDeleteBuilder()
+			rb.UseDialect(this.dialect)
+			rb.Table(relation.table)
+			rb.Where("ctx = ?", ctx)
+			rb.Where(dbs.IN(column, roleIds))
+			if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (this *Repository) GetGrantedRoles(ctx int64, target string, withChildren bool) (result []*odin.Role, err error) {
 	var sb = dbs.NewSelectBuilder()
 	sb.UseDialect(this.dialect)
-	sb.Selects("r.id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.created_on", "r.updated_on")
+	sb.Selects("r.id", "r.group_id", "r.ctx", "r.name", "r.alias_name", "r.status", "r.description", "r.parent_id", "r.left_value", "r.right_value", "r.depth", "r.max_targets", "r.created_on", "r.updated_on")
 	sb.Selects("MAX(CASE WHEN rg.role_id <> r.id THEN 0 ELSE 1 END) AS granted")
 	sb.Selects("MAX(CASE WHEN rg.role_id = r.id THEN 0 ELSE 1 END) AS can_access")
 	sb.From(this.tableRole, "AS r")
@@ -252,39 +524,148 @@ func (this *Repository) GetGrantedRoles(ctx int64, target string, withChildren b
 		sb.LeftJoin(this.tableRole, "AS rp ON rp.left_value = r.left_value AND rp.right_value = r.right_value")
 	}
 	sb.LeftJoin(this.tableGrant, "AS rg ON rg.role_id = rp.id")
-	sb.Where("rg.ctx = ?", ctx)
-	sb.Where("rg.target = ?", target)
+	this.whereGranted(sb, "rg", ctx, target)
 	sb.Where("rp.ctx = ?", ctx)
 	sb.Where("rp.status = ?", odin.Enable)
 	sb.Where("r.ctx = ?", ctx)
 	sb.Where("r.status = ?", odin.Enable)
 	sb.GroupBy("r.ctx", "r.id")
 	sb.OrderBy("r.ctx", "r.id")
-	if err := sb.Scan(this.db, &result); err != nil {
+	if err := sb.ScanContext(this.Context(), this.db, &result); err != nil {
 		return nil, err
 	}
 	return result, err
 }
 
+// GrantRoleWithIds 授予永久有效的角色，target 已经拥有并且尚未过期的授权（包括尚未生效的授权）保持原有的有效期不变
 func (this *Repository) GrantRoleWithIds(ctx int64, target string, roleIds ...int64) (err error) {
 	if len(roleIds) == 0 {
 		return nil
 	}
+
+	// 已经过期但是还没有清理的授权需要先删除，否则无法重新授予
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableGrant)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("target = ?", target)
+	rb.Where(dbs.IN("role_id", roleIds))
+	rb.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now())
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+
 	var now = time.Now()
 	var ib = dbs.NewInsertBuilder()
 	ib.UseDialect(this.dialect)
-	ib.Table(this.tableGrant)
 	ib.Options("IGNORE")
+	ib.Table(this.tableGrant)
 	ib.Columns("ctx", "role_id", "target", "created_on")
 	for _, rId := range roleIds {
 		ib.Values(ctx, rId, target, now)
 	}
-	if _, err = ib.Exec(this.db); err != nil {
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
 	return nil
 }
 
+// GrantRoleWithIdsBetween 授予在指定时间段内有效的角色，target 已经拥有的授权会使用新的有效期
+
+func (this *Repository) GrantRoleWithIdsBetween(ctx int64, target string, notBefore, expiresAt *time.Time, roleIds ...int64) (err error) {
+	if len(roleIds) == 0 {
+		return nil
+	}
+	var now = time.Now()
+	var ib = dbs.NewInsertBuilder()
+	ib.UseDialect(this.dialect)
+	ib.Table(this.tableGrant)
+	ib.Columns("ctx", "role_id", "target", "not_before", "expires_at", "created_on")
+	for _, rId := range roleIds {
+		ib.Values(ctx, rId, target, notBefore, expiresAt, now)
+	}
+	ib.Suffix("ON DUPLICATE KEY UPDATE not_before = VALUES(not_before), expires_at = VALUES(expires_at)")
+	if _, err = ib.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (this *Repository) GetGrantsWithTarget(ctx int64, target string) (result []*odin.Grant, err error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("g.ctx", "g.target", "g.role_id", "g.not_before", "g.expires_at")
+	sb.Selects("r.name AS role_name")
+	sb.From(this.tableGrant, "AS g")
+	sb.LeftJoin(this.tableRole, "AS r ON r.id = g.role_id")
+	var cond, args = this.grantTargetSQL("g", ctx, target)
+	sb.Where(cond, args...)
+	sb.Where("r.ctx = ?", ctx)
+	sb.OrderBy("g.role_id")
+	if err = sb.ScanContext(this.Context(), this.db, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetTargetsWithRoleIds 获取拥有指定角色的 target 列表（包括授权对象组），启用权限继承时包括通过继承关系拥有这些角色的权限的 target
+func (this *Repository) GetTargetsWithRoleIds(ctx int64, roleIds []int64) (result []string, err error) {
+	if len(roleIds) == 0 {
+		return nil, nil
+	}
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("g.target")
+	sb.From(this.tableGrant, "AS g")
+	this.joinGrantedRole(sb, ctx, "g")
+	sb.Where("g.ctx = ?", ctx)
+	sb.Where(dbs.IN("r.id", roleIds))
+	sb.GroupBy("g.target")
+	return this.scanTargets(sb)
+}
+
+// GetTargetsWithPermissionIds 获取通过角色拥有指定权限的 target 列表（包括授权对象组），启用权限继承时包括通过继承关系拥有这些权限的 target
+func (this *Repository) GetTargetsWithPermissionIds(ctx int64, permissionIds []int64) (result []string, err error) {
+	if len(permissionIds) == 0 {
+		return nil, nil
+	}
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("g.target")
+	sb.From(this.tableGrant, "AS g")
+	this.joinGrantedRole(sb, ctx, "g")
+	sb.LeftJoin(this.tableRolePermission, "AS rp ON rp.role_id = r.id")
+	sb.Where("g.ctx = ?", ctx)
+	sb.Where("rp.ctx = ?", ctx)
+	sb.Where(dbs.IN("rp.permission_id", permissionIds))
+	sb.GroupBy("g.target")
+	return this.scanTargets(sb)
+}
+
+func (this *Repository) scanTargets(sb *dbs.SelectBuilder) (result []string, err error) {
+	var grants []*odin.Grant
+	if err = sb.ScanContext(this.Context(), this.db, &grants); err != nil {
+		return nil, err
+	}
+	result = make([]string, 0, len(grants))
+	for _, grant := range grants {
+		result = append(result, grant.Target)
+	}
+	return result, nil
+}
+
+func (this *Repository) CleanExpiredGrants(ctx int64) (err error) {
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.dialect)
+	rb.Table(this.tableGrant)
+	rb.Where("ctx = ?", ctx)
+	rb.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now())
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
+		return err
+	}
+	return this.cleanExpiredDelegations(ctx)
+}
+
 func (this *Repository) RevokeRoleWithIds(ctx int64, target string, roleIds ...int64) (err error) {
 	if len(roleIds) == 0 {
 		return nil
@@ -296,10 +677,10 @@ func (this *Repository) RevokeRoleWithIds(ctx int64, target string, roleIds ...i
 	rb.Where("target = ?", target)
 	rb.Where(dbs.IN("role_id", roleIds))
 	rb.Limit(int64(len(roleIds)))
-	if _, err = rb.Exec(this.db); err != nil {
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
-	return nil
+	return this.RemoveDelegationsWithTarget(ctx, target, roleIds)
 }
 
 func (this *Repository) RevokeAllRole(ctx int64, target string) (err error) {
@@ -308,8 +689,8 @@ func (this *Repository) RevokeAllRole(ctx int64, target string) (err error) {
 	rb.Table(this.tableGrant)
 	rb.Where("ctx = ?", ctx)
 	rb.Where("target = ?", target)
-	if _, err = rb.Exec(this.db); err != nil {
+	if _, err = rb.ExecContext(this.Context(), this.db); err != nil {
 		return err
 	}
-	return nil
+	return this.RemoveDelegationsWithTarget(ctx, target, nil)
 }
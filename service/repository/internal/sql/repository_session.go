@@ -0,0 +1,99 @@
+package sql
+
+import (
+	"github.com/smartwalle/dbs"
+	"github.com/smartwalle/odin"
+)
+
+// CheckSessionPermission 验证 target 是否通过已激活的角色 roleIds 拥有指定权限，角色需要仍然授予给 target
+func (this *Repository) CheckSessionPermission(ctx int64, target string, roleIds []int64, permissionName string) bool {
+	ok, _ := this.CheckSessionPermissionE(ctx, target, roleIds, permissionName)
+	return ok
+}
+
+func (this *Repository) CheckSessionPermissionE(ctx int64, target string, roleIds []int64, permissionName string) (ok bool, err error) {
+	if len(roleIds) == 0 {
+		return false, nil
+	}
+	if this.matcher != nil {
+		return this.matchSessionPermission(ctx, target, roleIds, permissionName)
+	}
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("g.ctx", "g.target", "g.role_id")
+	sb.Selects("r.name AS role_name")
+	sb.Selects("p.id AS permission_id", "p.name AS permission_name")
+	sb.From(this.tableGrant, "AS g")
+	this.joinGrantedRole(sb, ctx, "g")
+	sb.LeftJoin(this.tableRolePermission, "AS rp ON rp.role_id = r.id")
+	sb.LeftJoin(this.tablePermission, "AS p ON p.id = rp.permission_id")
+	this.whereGranted(sb, "g", ctx, target)
+	sb.Where(dbs.IN("g.role_id", roleIds))
+	sb.Where("r.ctx = ? AND r.status = ?", ctx, odin.Enable)
+	sb.Where("rp.ctx = ? AND rp.cond = ?", ctx, "")
+	sb.Where("p.ctx = ? AND p.name = ? AND p.status = ?", ctx, permissionName, odin.Enable)
+	this.whereNotDenied(sb, "p", ctx, target)
+	sb.Limit(1)
+	var grant *odin.Grant
+	if err = sb.ScanContext(this.Context(), this.db, &grant); err != nil {
+		return false, err
+	}
+	if grant != nil {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (this *Repository) CheckSessionPermissionWithId(ctx int64, target string, roleIds []int64, permissionId int64) bool {
+	ok, _ := this.CheckSessionPermissionWithIdE(ctx, target, roleIds, permissionId)
+	return ok
+}
+
+func (this *Repository) CheckSessionPermissionWithIdE(ctx int64, target string, roleIds []int64, permissionId int64) (ok bool, err error) {
+	pList, err := this.GetPermissionsWithIds(ctx, permissionId)
+	if err != nil {
+		return false, err
+	}
+	if len(pList) == 0 {
+		return false, nil
+	}
+	return this.CheckSessionPermissionE(ctx, target, roleIds, pList[0].Name)
+}
+
+// matchSessionPermission 使用权限名称匹配器验证 target 是否通过已激活的角色 roleIds 拥有指定权限
+func (this *Repository) matchSessionPermission(ctx int64, target string, roleIds []int64, permissionName string) (bool, error) {
+	pList, err := this.GetPermissionsWithNames(ctx, permissionName)
+	if err != nil {
+		return false, err
+	}
+	if len(pList) == 0 || pList[0].Status != odin.Enable {
+		return false, nil
+	}
+
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(this.dialect)
+	sb.Selects("p.id", "p.group_id", "p.ctx", "p.name", "p.alias_name", "p.status", "p.description", "p.created_on", "p.updated_on")
+	sb.From(this.tableGrant, "AS g")
+	this.joinGrantedRole(sb, ctx, "g")
+	sb.LeftJoin(this.tableRolePermission, "AS rp ON rp.role_id = r.id")
+	sb.LeftJoin(this.tablePermission, "AS p ON p.id = rp.permission_id")
+	this.whereGranted(sb, "g", ctx, target)
+	sb.Where(dbs.IN("g.role_id", roleIds))
+	sb.Where("r.ctx = ? AND r.status = ?", ctx, odin.Enable)
+	sb.Where("rp.ctx = ? AND rp.cond = ?", ctx, "")
+	sb.Where("p.ctx = ? AND p.status = ?", ctx, odin.Enable)
+	sb.GroupBy("p.id")
+	var grantedList []*odin.Permission
+	if err = sb.ScanContext(this.Context(), this.db, &grantedList); err != nil {
+		return false, err
+	}
+	if this.matcher.MatchAny(permissionNames(grantedList), permissionName) == false {
+		return false, nil
+	}
+
+	deniedList, err := this.getDeniedPermissions(ctx, target, nil)
+	if err != nil {
+		return false, err
+	}
+	return this.matcher.MatchAny(permissionNames(deniedList), permissionName) == false, nil
+}
@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"github.com/smartwalle/dbs"
 	"github.com/smartwalle/odin"
 	"github.com/smartwalle/odin/service/repository/internal/sql"
@@ -30,17 +31,57 @@ func (this *repository) WithTx(tx dbs.TX) odin.Repository {
 	return &nRepo
 }
 
+func (this *repository) WithContext(ctx context.Context) odin.Repository {
+	var nRepo = *this
+	nRepo.Repository = this.Repository.ExWithContext(ctx)
+	return &nRepo
+}
+
 func (this *repository) InitTable() error {
 	var rawText = "" +
+		"CREATE TABLE IF NOT EXISTS `odin_ctx_limit` (" +
+		"  `ctx` bigint(20) NOT NULL," +
+		"  `max_roles_per_target` int(11) NOT NULL DEFAULT '0'," +
+		"  `created_on` datetime DEFAULT NULL," +
+		"  `updated_on` datetime DEFAULT NULL," +
+		"  PRIMARY KEY (`ctx`)" +
+		") ENGINE=InnoDB;" +
+		"" +
+		"CREATE TABLE IF NOT EXISTS `odin_delegation` (" +
+		"  `ctx` bigint(20) NOT NULL," +
+		"  `role_id` bigint(20) NOT NULL," +
+		"  `from_target` varchar(64) NOT NULL," +
+		"  `to_target` varchar(64) NOT NULL," +
+		"  `expires_at` datetime DEFAULT NULL," +
+		"  `created_on` datetime DEFAULT NULL," +
+		"  PRIMARY KEY (`ctx`,`role_id`,`from_target`,`to_target`)," +
+		"  KEY `odin_delegation_ctx_from_target_index` (`ctx`,`from_target`)," +
+		"  KEY `odin_delegation_ctx_to_target_index` (`ctx`,`to_target`)" +
+		") ENGINE=InnoDB;" +
+		"" +
+		"CREATE TABLE IF NOT EXISTS `odin_deny` (" +
+		"  `ctx` bigint(20) NOT NULL," +
+		"  `target` varchar(64) NOT NULL DEFAULT ''," +
+		"  `role_id` bigint(20) NOT NULL DEFAULT '0'," +
+		"  `permission_id` bigint(20) NOT NULL," +
+		"  `created_on` datetime DEFAULT NULL," +
+		"  PRIMARY KEY (`ctx`,`target`,`role_id`,`permission_id`)," +
+		"  KEY `odin_deny_ctx_permission_id_index` (`ctx`,`permission_id`)," +
+		"  KEY `odin_deny_ctx_role_id_index` (`ctx`,`role_id`)" +
+		") ENGINE=InnoDB;" +
+		"" +
 		"CREATE TABLE IF NOT EXISTS `odin_grant` (" +
 		"  `ctx` bigint(20) DEFAULT NULL," +
 		"  `role_id` bigint(20) DEFAULT NULL," +
 		"  `target` varchar(64) DEFAULT NULL," +
+		"  `not_before` datetime DEFAULT NULL," +
+		"  `expires_at` datetime DEFAULT NULL," +
 		"  `created_on` datetime DEFAULT NULL," +
 		"  UNIQUE KEY `odin_grant_pk` (`ctx`,`role_id`,`target`)," +
 		"  KEY `odin_grant_ctx_target_index` (`ctx`,`target`)," +
 		"  KEY `odin_grant_role_id_index` (`role_id`)," +
-		"  KEY `odin_grant_target_index` (`target`)" +
+		"  KEY `odin_grant_target_index` (`target`)," +
+		"  KEY `odin_grant_ctx_expires_at_index` (`ctx`,`expires_at`)" +
 		") ENGINE=InnoDB;" +
 		"" +
 		"CREATE TABLE IF NOT EXISTS `odin_group` (" +
@@ -57,6 +98,15 @@ func (this *repository) InitTable() error {
 		"  UNIQUE KEY `odin_group_pk` (`ctx`,`type`,`name`)" +
 		") ENGINE=InnoDB;" +
 		"" +
+		"CREATE TABLE IF NOT EXISTS `odin_group_member` (" +
+		"  `ctx` bigint(20) NOT NULL," +
+		"  `group_id` bigint(20) NOT NULL," +
+		"  `target` varchar(64) NOT NULL," +
+		"  `created_on` datetime DEFAULT NULL," +
+		"  PRIMARY KEY (`ctx`,`group_id`,`target`)," +
+		"  KEY `odin_group_member_ctx_target_index` (`ctx`,`target`)" +
+		") ENGINE=InnoDB;" +
+		"" +
 		"CREATE TABLE IF NOT EXISTS `odin_permission` (" +
 		"  `id` bigint(20) NOT NULL," +
 		"  `group_id` bigint(20) DEFAULT NULL," +
@@ -95,8 +145,20 @@ func (this *repository) InitTable() error {
 		"  KEY `odin_pre_role_ctx_role_id_pre_role_id_index` (`ctx`,`role_id`,`pre_role_id`)" +
 		") ENGINE=InnoDB;" +
 		"" +
+		"CREATE TABLE IF NOT EXISTS `odin_resource_grant` (" +
+		"  `ctx` bigint(20) NOT NULL," +
+		"  `role_id` bigint(20) NOT NULL," +
+		"  `target` varchar(64) NOT NULL," +
+		"  `resource` varchar(255) NOT NULL," +
+		"  `created_on` datetime DEFAULT NULL," +
+		"  PRIMARY KEY (`ctx`,`role_id`,`target`,`resource`)," +
+		"  KEY `odin_resource_grant_ctx_target_index` (`ctx`,`target`)," +
+		"  KEY `odin_resource_grant_role_id_index` (`role_id`)" +
+		") ENGINE=InnoDB;" +
+		"" +
 		"CREATE TABLE IF NOT EXISTS `odin_role` (" +
 		"  `id` bigint(20) NOT NULL," +
+		"  `group_id` bigint(20) DEFAULT '0'," +
 		"  `ctx` bigint(20) DEFAULT NULL," +
 		"  `name` varchar(64) DEFAULT NULL," +
 		"  `alias_name` varchar(255) DEFAULT NULL," +
@@ -106,6 +168,7 @@ func (this *repository) InitTable() error {
 		"  `left_value` bigint(20) DEFAULT NULL," +
 		"  `right_value` bigint(20) DEFAULT NULL," +
 		"  `depth` int(11) DEFAULT NULL," +
+		"  `max_targets` int(11) NOT NULL DEFAULT '0'," +
 		"  `created_on` datetime DEFAULT NULL," +
 		"  `updated_on` datetime DEFAULT NULL," +
 		"  PRIMARY KEY (`id`)," +
@@ -114,9 +177,20 @@ func (this *repository) InitTable() error {
 		"  KEY `odin_role_ctx_index` (`ctx`)," +
 		"  KEY `odin_role_ctx_left_value_index` (`ctx`,`left_value`)," +
 		"  KEY `odin_role_ctx_parent_id_index` (`ctx`,`parent_id`)," +
+		"  KEY `odin_role_ctx_group_id_index` (`ctx`,`group_id`)," +
 		"  KEY `odin_role_ctx_right_value_index` (`ctx`,`right_value`)" +
 		") ENGINE=InnoDB;" +
 		"" +
+		"CREATE TABLE IF NOT EXISTS `odin_role_dynamic_mutex` (" +
+		"  `ctx` bigint(20) NOT NULL," +
+		"  `role_id` bigint(20) NOT NULL," +
+		"  `mutex_role_id` bigint(20) NOT NULL," +
+		"  `created_on` datetime DEFAULT NULL," +
+		"  PRIMARY KEY (`ctx`,`role_id`,`mutex_role_id`)," +
+		"  KEY `odin_role_dynamic_mutex_ctx_mutex_role_id_index` (`ctx`,`mutex_role_id`)," +
+		"  KEY `odin_role_dynamic_mutex_ctx_role_id_index` (`ctx`,`role_id`)" +
+		") ENGINE=InnoDB;" +
+		"" +
 		"CREATE TABLE IF NOT EXISTS `odin_role_mutex` (" +
 		"  `ctx` bigint(20) NOT NULL," +
 		"  `role_id` bigint(20) NOT NULL," +
@@ -132,6 +206,7 @@ func (this *repository) InitTable() error {
 		"  `ctx` bigint(20) DEFAULT NULL," +
 		"  `role_id` bigint(20) DEFAULT NULL," +
 		"  `permission_id` bigint(20) DEFAULT NULL," +
+		"  `cond` varchar(1024) NOT NULL DEFAULT ''," +
 		"  `created_on` datetime DEFAULT NULL," +
 		"  UNIQUE KEY `odin_role_permission_pk` (`ctx`,`role_id`,`permission_id`)" +
 		") ENGINE=InnoDB;"
@@ -142,9 +217,79 @@ func (this *repository) InitTable() error {
 			continue
 		}
 		var rb = dbs.NewBuilder(sql)
-		if _, err := rb.Exec(this.DB()); err != nil {
+		if _, err := rb.ExecContext(this.Context(), this.DB()); err != nil {
+			return err
+		}
+	}
+	return this.migrateTable()
+}
+
+// migrateTable 为已经存在的数据表添加后续版本新增的字段及索引，可以重复执行
+func (this *repository) migrateTable() error {
+	var columns = []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"odin_grant", "not_before", "datetime DEFAULT NULL AFTER `target`"},
+		{"odin_grant", "expires_at", "datetime DEFAULT NULL AFTER `not_before`"},
+		{"odin_role", "group_id", "bigint(20) DEFAULT '0' AFTER `id`"},
+		{"odin_role", "max_targets", "int(11) NOT NULL DEFAULT '0' AFTER `depth`"},
+		{"odin_role_permission", "cond", "varchar(1024) NOT NULL DEFAULT '' AFTER `permission_id`"},
+	}
+	for _, c := range columns {
+		var table = strings.ReplaceAll(c.table, "odin", this.TablePrefix())
+		exists, err := this.schemaExists("columns", "column_name", table, c.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		var rb = dbs.NewBuilder("ALTER TABLE `" + table + "` ADD COLUMN `" + c.column + "` " + c.definition)
+		if _, err = rb.ExecContext(this.Context(), this.DB()); err != nil {
+			return err
+		}
+	}
+
+	var indexes = []struct {
+		table   string
+		index   string
+		columns string
+	}{
+		{"odin_grant", "odin_grant_ctx_expires_at_index", "`ctx`,`expires_at`"},
+		{"odin_role", "odin_role_ctx_group_id_index", "`ctx`,`group_id`"},
+	}
+	for _, i := range indexes {
+		var table = strings.ReplaceAll(i.table, "odin", this.TablePrefix())
+		var index = strings.ReplaceAll(i.index, "odin", this.TablePrefix())
+		exists, err := this.schemaExists("statistics", "index_name", table, index)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		var rb = dbs.NewBuilder("ALTER TABLE `" + table + "` ADD INDEX `" + index + "` (" + i.columns + ")")
+		if _, err = rb.ExecContext(this.Context(), this.DB()); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// schemaExists 查询当前数据库的 information_schema 中是否存在指定的字段或者索引
+func (this *repository) schemaExists(view, column, table, name string) (bool, error) {
+	var sb = dbs.NewSelectBuilder()
+	sb.UseDialect(dbs.DialectMySQL)
+	sb.Selects("COUNT(1)")
+	sb.From("information_schema." + view)
+	sb.Where("table_schema = DATABASE()")
+	sb.Where("table_name = ?", table)
+	sb.Where(column+" = ?", name)
+	var count int
+	if err := sb.ScanRowContext(this.Context(), this.DB(), &count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,203 @@
+//go:build integration
+// +build integration
+
+package mysql
+
+import (
+	"fmt"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/smartwalle/dbs"
+	"github.com/smartwalle/odin"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 角色树的测试需要连接 MySQL 数据库，在 mod 中添加依赖 github.com/go-sql-driver/mysql v1.4.1 之后执行：
+//
+// ODIN_MYSQL_DSN="root:password@tcp(127.0.0.1:3306)/test?parseTime=true" go test -tags integration ./service/repository/mysql
+
+// newRoleTree 创建角色树，ctx 下为 a(b(c), d), e，ctx+1 下为 x(y)，用于检查操作不会影响其它 ctx
+func newRoleTree(t *testing.T) (repo odin.Repository, ctx int64) {
+	var dsn = os.Getenv("ODIN_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("未设置 ODIN_MYSQL_DSN")
+	}
+	dbs.SetLogger(nil)
+	db, err := dbs.NewSQL("mysql", dsn, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo = NewRepository(db, "test")
+	if err = repo.InitTable(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx = time.Now().UnixNano()
+	addRole(t, repo, ctx, "", "a")
+	addRole(t, repo, ctx+1, "", "x")
+	addRole(t, repo, ctx, "a", "b")
+	addRole(t, repo, ctx, "b", "c")
+	addRole(t, repo, ctx+1, "x", "y")
+	addRole(t, repo, ctx, "a", "d")
+	addRole(t, repo, ctx, "", "e")
+
+	assertRoleTree(t, repo, ctx, "a:1-8@1 b:2-5@2 c:3-4@3 d:6-7@2 e:9-10@1")
+	assertRoleTree(t, repo, ctx+1, "x:1-4@1 y:2-3@2")
+	return repo, ctx
+}
+
+func addRole(t *testing.T, repo odin.Repository, ctx int64, parent, name string) {
+	if _, err := repo.AddRole(ctx, getRole(t, repo, ctx, parent), name, "", "", odin.Enable); err != nil {
+		t.Fatalf("添加角色 %s 发生错误: %v", name, err)
+	}
+}
+
+// getRole 查询角色的当前数据，name 为空时返回 nil
+func getRole(t *testing.T, repo odin.Repository, ctx int64, name string) *odin.Role {
+	if name == "" {
+		return nil
+	}
+	role, err := repo.GetRoleWithName(ctx, name)
+	if err != nil || role == nil {
+		t.Fatalf("查询角色 %s 发生错误: %v", name, err)
+	}
+	return role
+}
+
+// assertRoleTree 检查 ctx 下角色树的左右值及层级，expect 的格式为按左值排序的 名称:左值-右值@层级，
+// 同时检查左右值是否连续、parent_id 是否指向最近的祖先角色
+func assertRoleTree(t *testing.T, repo odin.Repository, ctx int64, expect string) {
+	t.Helper()
+
+	roleList, err := repo.GetRoles(ctx, -1, 0, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(roleList, func(i, j int) bool {
+		return roleList[i].LeftValue < roleList[j].LeftValue
+	})
+
+	var parts = make([]string, 0, len(roleList))
+	for i, role := range roleList {
+		parts = append(parts, fmt.Sprintf("%s:%d-%d@%d", role.Name, role.LeftValue, role.RightValue, role.Depth))
+
+		var parentId int64
+		for _, p := range roleList[:i] {
+			if p.RightValue > role.RightValue {
+				parentId = p.Id
+			}
+		}
+		if role.ParentId != parentId {
+			t.Errorf("角色 %s 的 parent_id 为 %d，期望为 %d", role.Name, role.ParentId, parentId)
+		}
+	}
+	if actual := strings.Join(parts, " "); actual != expect {
+		t.Fatalf("角色树为 %s，期望为 %s", actual, expect)
+	}
+}
+
+func TestDeleteRole(t *testing.T) {
+	var tests = []struct {
+		name         string
+		withChildren bool
+		expect       string
+	}{
+		{"b", true, "a:1-4@1 d:2-3@2 e:5-6@1"},
+		{"a", true, "e:1-2@1"},
+		{"b", false, "a:1-6@1 c:2-3@2 d:4-5@2 e:7-8@1"},
+		{"a", false, "b:1-4@1 c:2-3@2 d:5-6@1 e:7-8@1"},
+		{"d", false, "a:1-6@1 b:2-5@2 c:3-4@3 e:7-8@1"},
+	}
+
+	for _, test := range tests {
+		var repo, ctx = newRoleTree(t)
+		if err := repo.DeleteRole(ctx, getRole(t, repo, ctx, test.name), test.withChildren); err != nil {
+			t.Fatalf("删除角色 %s 发生错误: %v", test.name, err)
+		}
+		assertRoleTree(t, repo, ctx, test.expect)
+		assertRoleTree(t, repo, ctx+1, "x:1-4@1 y:2-3@2")
+	}
+}
+
+func TestMoveRole(t *testing.T) {
+	var tests = []struct {
+		name   string
+		parent string
+		expect string
+	}{
+		{"b", "e", "a:1-4@1 d:2-3@2 e:5-10@1 b:6-9@2 c:7-8@3"},
+		{"e", "c", "a:1-10@1 b:2-7@2 c:3-6@3 e:4-5@4 d:8-9@2"},
+		{"b", "", "a:1-4@1 d:2-3@2 e:5-6@1 b:7-10@1 c:8-9@2"},
+		{"b", "a", "a:1-8@1 d:2-3@2 b:4-7@2 c:5-6@3 e:9-10@1"},
+	}
+
+	for _, test := range tests {
+		var repo, ctx = newRoleTree(t)
+		if err := repo.MoveRole(ctx, getRole(t, repo, ctx, test.name), getRole(t, repo, ctx, test.parent)); err != nil {
+			t.Fatalf("移动角色 %s 发生错误: %v", test.name, err)
+		}
+		assertRoleTree(t, repo, ctx, test.expect)
+		assertRoleTree(t, repo, ctx+1, "x:1-4@1 y:2-3@2")
+	}
+}
+
+func TestAddRoleNextTo(t *testing.T) {
+	var tests = []struct {
+		sibling string
+		before  bool
+		expect  string
+	}{
+		{"d", true, "a:1-10@1 b:2-5@2 c:3-4@3 f:6-7@2 d:8-9@2 e:11-12@1"},
+		{"a", true, "f:1-2@1 a:3-10@1 b:4-7@2 c:5-6@3 d:8-9@2 e:11-12@1"},
+		{"b", false, "a:1-10@1 b:2-5@2 c:3-4@3 f:6-7@2 d:8-9@2 e:11-12@1"},
+		{"a", false, "a:1-8@1 b:2-5@2 c:3-4@3 d:6-7@2 f:9-10@1 e:11-12@1"},
+	}
+
+	for _, test := range tests {
+		var repo, ctx = newRoleTree(t)
+		var err error
+		if test.before {
+			_, err = repo.AddRoleBefore(ctx, getRole(t, repo, ctx, test.sibling), "f", "", "", odin.Enable)
+		} else {
+			_, err = repo.AddRoleAfter(ctx, getRole(t, repo, ctx, test.sibling), "f", "", "", odin.Enable)
+		}
+		if err != nil {
+			t.Fatalf("添加角色发生错误: %v", err)
+		}
+		assertRoleTree(t, repo, ctx, test.expect)
+		assertRoleTree(t, repo, ctx+1, "x:1-4@1 y:2-3@2")
+	}
+}
+
+func TestMoveRoleNextTo(t *testing.T) {
+	var tests = []struct {
+		name    string
+		sibling string
+		before  bool
+		expect  string
+	}{
+		{"d", "b", true, "a:1-8@1 d:2-3@2 b:4-7@2 c:5-6@3 e:9-10@1"},
+		{"e", "a", true, "e:1-2@1 a:3-10@1 b:4-7@2 c:5-6@3 d:8-9@2"},
+		{"c", "d", false, "a:1-8@1 b:2-3@2 d:4-5@2 c:6-7@2 e:9-10@1"},
+		{"b", "e", false, "a:1-4@1 d:2-3@2 e:5-6@1 b:7-10@1 c:8-9@2"},
+	}
+
+	for _, test := range tests {
+		var repo, ctx = newRoleTree(t)
+		var role, sibling = getRole(t, repo, ctx, test.name), getRole(t, repo, ctx, test.sibling)
+		var err error
+		if test.before {
+			err = repo.MoveRoleBefore(ctx, role, sibling)
+		} else {
+			err = repo.MoveRoleAfter(ctx, role, sibling)
+		}
+		if err != nil {
+			t.Fatalf("移动角色 %s 发生错误: %v", test.name, err)
+		}
+		assertRoleTree(t, repo, ctx, test.expect)
+		assertRoleTree(t, repo, ctx+1, "x:1-4@1 y:2-3@2")
+	}
+}
@@ -1,6 +1,7 @@
 package postgresql
 
 import (
+	"context"
 	"github.com/smartwalle/dbs"
 	"github.com/smartwalle/odin"
 	"github.com/smartwalle/odin/service/repository/internal/sql"
@@ -31,6 +32,12 @@ func (this *repository) WithTx(tx dbs.TX) odin.Repository {
 	return &nRepo
 }
 
+func (this *repository) WithContext(ctx context.Context) odin.Repository {
+	var nRepo = *this
+	nRepo.Repository = this.Repository.ExWithContext(ctx)
+	return &nRepo
+}
+
 func (this *repository) InitTable() error {
 	var rawText = `
 create table if not exists odin_group
@@ -49,6 +56,19 @@ create table if not exists odin_group
 		unique (ctx, type, name)
 );
 
+create table if not exists odin_group_member
+(
+	ctx        bigint      not null,
+	group_id   bigint      not null,
+	target     varchar(64) not null,
+	created_on timestamp with time zone,
+	constraint odin_group_member_pk
+		primary key (ctx, group_id, target)
+);
+
+create index if not exists odin_group_member_ctx_target_index
+	on odin_group_member (ctx, target);
+
 create table if not exists odin_permission
 (
 	id          bigint not null,
@@ -81,6 +101,7 @@ create unique index if not exists odin_permission_ctx_name_uindex
 create table if not exists odin_role
 (
 	id          bigint not null,
+	group_id    bigint default 0,
 	ctx         bigint,
 	name        varchar(64),
 	alias_name  varchar(255),
@@ -90,6 +111,7 @@ create table if not exists odin_role
 	left_value  bigint,
 	right_value bigint,
 	depth       integer,
+	max_targets integer default 0 not null,
 	created_on  timestamp with time zone,
 	updated_on  timestamp with time zone,
 	constraint odin_role_pk
@@ -98,6 +120,10 @@ create table if not exists odin_role
 		unique (ctx, name)
 );
 
+-- 为已经存在的数据表添加后续版本新增的字段
+alter table odin_role add column if not exists group_id bigint default 0;
+alter table odin_role add column if not exists max_targets integer default 0 not null;
+
 create unique index if not exists odin_role_id_uindex
 	on odin_role (id);
 
@@ -113,6 +139,9 @@ create index if not exists odin_role_ctx_left_value_index
 create index if not exists odin_role_ctx_parent_id_index
 	on odin_role (ctx, parent_id);
 
+create index if not exists odin_role_ctx_group_id_index
+	on odin_role (ctx, group_id);
+
 create index if not exists odin_role_ctx_right_value_index
 	on odin_role (ctx, right_value);
 
@@ -121,30 +150,103 @@ create table if not exists odin_grant
 	ctx        bigint      not null,
 	role_id    bigint      not null,
 	target     varchar(64) not null,
+	not_before timestamp with time zone,
+	expires_at timestamp with time zone,
 	created_on timestamp with time zone,
 	constraint odin_grant_pk
 		primary key (ctx, role_id, target)
 );
 
+alter table odin_grant add column if not exists not_before timestamp with time zone;
+alter table odin_grant add column if not exists expires_at timestamp with time zone;
+
 create index if not exists odin_grant_role_id_index
 	on odin_grant (role_id);
 
+create index if not exists odin_grant_ctx_expires_at_index
+	on odin_grant (ctx, expires_at);
+
 create index if not exists odin_grant_target_index
 	on odin_grant (target);
 
 create index if not exists odin_grant_ctx_target_index
 	on odin_grant (ctx, target);
 
+create table if not exists odin_ctx_limit
+(
+	ctx                  bigint  not null,
+	max_roles_per_target integer default 0 not null,
+	created_on           timestamp with time zone,
+	updated_on           timestamp with time zone,
+	constraint odin_ctx_limit_pk
+		primary key (ctx)
+);
+
+create table if not exists odin_delegation
+(
+	ctx         bigint      not null,
+	role_id     bigint      not null,
+	from_target varchar(64) not null,
+	to_target   varchar(64) not null,
+	expires_at  timestamp with time zone,
+	created_on  timestamp with time zone,
+	constraint odin_delegation_pk
+		primary key (ctx, role_id, from_target, to_target)
+);
+
+create index if not exists odin_delegation_ctx_from_target_index
+	on odin_delegation (ctx, from_target);
+
+create index if not exists odin_delegation_ctx_to_target_index
+	on odin_delegation (ctx, to_target);
+
+create table if not exists odin_deny
+(
+	ctx           bigint                not null,
+	target        varchar(64) default '' not null,
+	role_id       bigint      default 0  not null,
+	permission_id bigint                not null,
+	created_on    timestamp with time zone,
+	constraint odin_deny_pk
+		primary key (ctx, target, role_id, permission_id)
+);
+
+create index if not exists odin_deny_ctx_permission_id_index
+	on odin_deny (ctx, permission_id);
+
+create index if not exists odin_deny_ctx_role_id_index
+	on odin_deny (ctx, role_id);
+
+create table if not exists odin_resource_grant
+(
+	ctx        bigint       not null,
+	role_id    bigint       not null,
+	target     varchar(64)  not null,
+	resource   varchar(255) not null,
+	created_on timestamp with time zone,
+	constraint odin_resource_grant_pk
+		primary key (ctx, role_id, target, resource)
+);
+
+create index if not exists odin_resource_grant_ctx_target_index
+	on odin_resource_grant (ctx, target);
+
+create index if not exists odin_resource_grant_role_id_index
+	on odin_resource_grant (role_id);
+
 create table if not exists odin_role_permission
 (
 	ctx           bigint  not null,
 	role_id       bigint  not null,
 	permission_id bigint  not null,
+	cond          varchar(1024) default '' not null,
 	created_on    timestamp with time zone,
 	constraint odin_role_permission_pk
 		primary key (ctx, role_id, permission_id)
 );
 
+alter table odin_role_permission add column if not exists cond varchar(1024) default '' not null;
+
 create table if not exists odin_role_mutex
 (
 	ctx           bigint  not null,
@@ -161,6 +263,22 @@ create index if not exists odin_role_mutex_ctx_mutex_role_id_index
 create index if not exists odin_role_mutex_ctx_role_id_index
 	on odin_role_mutex (ctx, role_id);
 
+create table if not exists odin_role_dynamic_mutex
+(
+	ctx           bigint  not null,
+	role_id       bigint  not null,
+	mutex_role_id bigint  not null,
+	created_on    timestamp with time zone,
+	constraint odin_role_dynamic_mutex_pk
+		primary key (ctx, role_id, mutex_role_id)
+);
+
+create index if not exists odin_role_dynamic_mutex_ctx_mutex_role_id_index
+	on odin_role_dynamic_mutex (ctx, mutex_role_id);
+
+create index if not exists odin_role_dynamic_mutex_ctx_role_id_index
+	on odin_role_dynamic_mutex (ctx, role_id);
+
 create table if not exists odin_pre_role
 (
 	ctx         bigint  not null,
@@ -203,6 +321,10 @@ create or replace rule odin_role_mutex_pk_rule as on insert to odin_role_mutex w
 select 1 from odin_role_mutex where ctx = NEW.ctx and role_id = NEW.role_id and mutex_role_id = NEW.mutex_role_id
 ) do instead nothing;
 
+create or replace rule odin_role_dynamic_mutex_pk_rule as on insert to odin_role_dynamic_mutex where exists (
+select 1 from odin_role_dynamic_mutex where ctx = NEW.ctx and role_id = NEW.role_id and mutex_role_id = NEW.mutex_role_id
+) do instead nothing;
+
 create or replace rule odin_pre_role_pk_rule as on insert to odin_pre_role where exists (
 select 1 from odin_pre_role where ctx = NEW.ctx and role_id = NEW.role_id and pre_role_id = NEW.pre_role_id
 ) do instead nothing;
@@ -210,10 +332,30 @@ select 1 from odin_pre_role where ctx = NEW.ctx and role_id = NEW.role_id and pr
 create or replace rule odin_grant_pk_rule as on insert to odin_grant where exists (
 select 1 from odin_grant where ctx = NEW.ctx and role_id = NEW.role_id and target = NEW.target
 ) do instead nothing;
+
+create or replace rule odin_group_member_pk_rule as on insert to odin_group_member where exists (
+select 1 from odin_group_member where ctx = NEW.ctx and group_id = NEW.group_id and target = NEW.target
+) do instead nothing;
+
+create or replace rule odin_ctx_limit_pk_rule as on insert to odin_ctx_limit where exists (
+select 1 from odin_ctx_limit where ctx = NEW.ctx
+) do instead nothing;
+
+create or replace rule odin_delegation_pk_rule as on insert to odin_delegation where exists (
+select 1 from odin_delegation where ctx = NEW.ctx and role_id = NEW.role_id and from_target = NEW.from_target and to_target = NEW.to_target
+) do instead nothing;
+
+create or replace rule odin_deny_pk_rule as on insert to odin_deny where exists (
+select 1 from odin_deny where ctx = NEW.ctx and target = NEW.target and role_id = NEW.role_id and permission_id = NEW.permission_id
+) do instead nothing;
+
+create or replace rule odin_resource_grant_pk_rule as on insert to odin_resource_grant where exists (
+select 1 from odin_resource_grant where ctx = NEW.ctx and role_id = NEW.role_id and target = NEW.target and resource = NEW.resource
+) do instead nothing;
 `
 	var sql = strings.ReplaceAll(rawText, "odin", this.TablePrefix())
 	var rb = dbs.NewBuilder(sql)
-	if _, err := rb.Exec(this.DB()); err != nil {
+	if _, err := rb.ExecContext(this.Context(), this.DB()); err != nil {
 		return err
 	}
 
@@ -232,22 +374,38 @@ func (this *repository) GrantPermissionWithIds(ctx, roleId int64, permissionIds
 	for _, permissionId := range permissionIds {
 		ib.Values(ctx, roleId, permissionId, now)
 	}
-	if _, err = ib.Exec(this.DB()); err != nil {
+	if _, err = ib.ExecContext(this.Context(), this.DB()); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (this *repository) AddPrePermission(ctx, permissionId int64, prePermissionIds []int64) (err error) {
+func (this *repository) AddPrePermission(ctx, permissionId int64, prePermissionIds []int64, autoGrant bool) (err error) {
+	if len(prePermissionIds) == 0 {
+		return nil
+	}
+
+	// 表上存在 insert rule，无法使用 on conflict，所以先更新已经存在的先决权限条件
+	var ub = dbs.NewUpdateBuilder()
+	ub.UseDialect(this.Dialect())
+	ub.Table(this.TablePrePermission())
+	ub.SET("auto_grant", autoGrant)
+	ub.Where("ctx = ?", ctx)
+	ub.Where("permission_id = ?", permissionId)
+	ub.Where(dbs.IN("pre_permission_id", prePermissionIds))
+	if _, err = ub.ExecContext(this.Context(), this.DB()); err != nil {
+		return err
+	}
+
 	var now = time.Now()
 	var ib = dbs.NewInsertBuilder()
 	ib.UseDialect(this.Dialect())
 	ib.Table(this.TablePrePermission())
 	ib.Columns("ctx", "permission_id", "pre_permission_id", "auto_grant", "created_on")
 	for _, prePermissionId := range prePermissionIds {
-		ib.Values(ctx, permissionId, prePermissionId, false, now)
+		ib.Values(ctx, permissionId, prePermissionId, autoGrant, now)
 	}
-	if _, err = ib.Exec(this.DB()); err != nil {
+	if _, err = ib.ExecContext(this.Context(), this.DB()); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,31 @@
+package postgresql
+
+import (
+	"github.com/smartwalle/dbs"
+	"time"
+)
+
+func (this *repository) AddDelegation(ctx, roleId int64, fromTarget, toTarget string, expiresAt time.Time) (err error) {
+	// 表上存在 insert rule，无法使用 on conflict，所以先更新已经存在的委托记录的过期时间
+	var ub = dbs.NewUpdateBuilder()
+	ub.UseDialect(this.Dialect())
+	ub.Table(this.TableDelegation())
+	ub.SET("expires_at", expiresAt)
+	ub.Where("ctx = ?", ctx)
+	ub.Where("role_id = ?", roleId)
+	ub.Where("from_target = ?", fromTarget)
+	ub.Where("to_target = ?", toTarget)
+	if _, err = ub.ExecContext(this.Context(), this.DB()); err != nil {
+		return err
+	}
+
+	var ib = dbs.NewInsertBuilder()
+	ib.UseDialect(this.Dialect())
+	ib.Table(this.TableDelegation())
+	ib.Columns("ctx", "role_id", "from_target", "to_target", "expires_at", "created_on")
+	ib.Values(ctx, roleId, fromTarget, toTarget, expiresAt, time.Now())
+	if _, err = ib.ExecContext(this.Context(), this.DB()); err != nil {
+		return err
+	}
+	return nil
+}
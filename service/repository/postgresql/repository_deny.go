@@ -0,0 +1,24 @@
+package postgresql
+
+import (
+	"github.com/smartwalle/dbs"
+	"time"
+)
+
+func (this *repository) AddDenyWithIds(ctx int64, target string, roleId int64, permissionIds []int64) (err error) {
+	if len(permissionIds) == 0 {
+		return nil
+	}
+	var now = time.Now()
+	var ib = dbs.NewInsertBuilder()
+	ib.UseDialect(this.Dialect())
+	ib.Table(this.TableDeny())
+	ib.Columns("ctx", "target", "role_id", "permission_id", "created_on")
+	for _, permissionId := range permissionIds {
+		ib.Values(ctx, target, roleId, permissionId, now)
+	}
+	if _, err = ib.ExecContext(this.Context(), this.DB()); err != nil {
+		return err
+	}
+	return nil
+}
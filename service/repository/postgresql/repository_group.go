@@ -0,0 +1,24 @@
+package postgresql
+
+import (
+	"github.com/smartwalle/dbs"
+	"time"
+)
+
+func (this *repository) AddGroupMembers(ctx, groupId int64, targets []string) (err error) {
+	if len(targets) == 0 {
+		return nil
+	}
+	var now = time.Now()
+	var ib = dbs.NewInsertBuilder()
+	ib.UseDialect(this.Dialect())
+	ib.Table(this.TableGroupMember())
+	ib.Columns("ctx", "group_id", "target", "created_on")
+	for _, target := range targets {
+		ib.Values(ctx, groupId, target, now)
+	}
+	if _, err = ib.ExecContext(this.Context(), this.DB()); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package postgresql
+
+import (
+	"github.com/smartwalle/dbs"
+	"time"
+)
+
+func (this *repository) SetMaxRolesPerTarget(ctx int64, maxRoles int) (err error) {
+	var now = time.Now()
+	var ub = dbs.NewUpdateBuilder()
+	ub.UseDialect(this.Dialect())
+	ub.Table(this.TableCtxLimit())
+	ub.SET("max_roles_per_target", maxRoles)
+	ub.SET("updated_on", now)
+	ub.Where("ctx = ?", ctx)
+	if _, err = ub.ExecContext(this.Context(), this.DB()); err != nil {
+		return err
+	}
+
+	var ib = dbs.NewInsertBuilder()
+	ib.UseDialect(this.Dialect())
+	ib.Table(this.TableCtxLimit())
+	ib.Columns("ctx", "max_roles_per_target", "created_on", "updated_on")
+	ib.Values(ctx, maxRoles, now, now)
+	if _, err = ib.ExecContext(this.Context(), this.DB()); err != nil {
+		return err
+	}
+	return nil
+}
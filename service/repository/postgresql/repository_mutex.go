@@ -15,7 +15,7 @@ func (this *repository) AddRoleMutex(ctx, roleId int64, mutexRoleIds []int64) (e
 		ib.Values(ctx, roleId, mutexRoleId, now)
 		ib.Values(ctx, mutexRoleId, roleId, now)
 	}
-	if _, err = ib.Exec(this.DB()); err != nil {
+	if _, err = ib.ExecContext(this.Context(), this.DB()); err != nil {
 		return err
 	}
 	return nil
@@ -14,7 +14,7 @@ func (this *repository) AddPreRole(ctx, roleId int64, preRoleIds []int64) (err e
 	for _, preRoleId := range preRoleIds {
 		ib.Values(ctx, roleId, preRoleId, now)
 	}
-	if _, err = ib.Exec(this.DB()); err != nil {
+	if _, err = ib.ExecContext(this.Context(), this.DB()); err != nil {
 		return err
 	}
 	return nil
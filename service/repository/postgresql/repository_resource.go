@@ -0,0 +1,24 @@
+package postgresql
+
+import (
+	"github.com/smartwalle/dbs"
+	"time"
+)
+
+func (this *repository) GrantRoleOnWithIds(ctx int64, target, resource string, roleIds ...int64) (err error) {
+	if len(roleIds) == 0 {
+		return nil
+	}
+	var now = time.Now()
+	var ib = dbs.NewInsertBuilder()
+	ib.UseDialect(this.Dialect())
+	ib.Table(this.TableResourceGrant())
+	ib.Columns("ctx", "role_id", "target", "resource", "created_on")
+	for _, rId := range roleIds {
+		ib.Values(ctx, rId, target, resource, now)
+	}
+	if _, err = ib.ExecContext(this.Context(), this.DB()); err != nil {
+		return err
+	}
+	return nil
+}
@@ -9,6 +9,19 @@ func (this *repository) GrantRoleWithIds(ctx int64, target string, roleIds ...in
 	if len(roleIds) == 0 {
 		return nil
 	}
+
+	var rb = dbs.NewDeleteBuilder()
+	rb.UseDialect(this.Dialect())
+	rb.Table(this.TableGrant())
+	rb.Where("ctx = ?", ctx)
+	rb.Where("target = ?", target)
+	rb.Where(dbs.IN("role_id", roleIds))
+	rb.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now())
+	if _, err = rb.ExecContext(this.Context(), this.DB()); err != nil {
+		return err
+	}
+
+	// 表上存在 insert rule，已经存在的授权会被忽略，保持原有的有效期不变
 	var now = time.Now()
 	var ib = dbs.NewInsertBuilder()
 	ib.UseDialect(this.Dialect())
@@ -17,7 +30,39 @@ func (this *repository) GrantRoleWithIds(ctx int64, target string, roleIds ...in
 	for _, rId := range roleIds {
 		ib.Values(ctx, rId, target, now)
 	}
-	if _, err = ib.Exec(this.DB()); err != nil {
+	if _, err = ib.ExecContext(this.Context(), this.DB()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (this *repository) GrantRoleWithIdsBetween(ctx int64, target string, notBefore, expiresAt *time.Time, roleIds ...int64) (err error) {
+	if len(roleIds) == 0 {
+		return nil
+	}
+
+	// 表上存在 insert rule，无法使用 on conflict，所以先更新已经存在的授权的有效期
+	var ub = dbs.NewUpdateBuilder()
+	ub.UseDialect(this.Dialect())
+	ub.Table(this.TableGrant())
+	ub.SET("not_before", notBefore)
+	ub.SET("expires_at", expiresAt)
+	ub.Where("ctx = ?", ctx)
+	ub.Where("target = ?", target)
+	ub.Where(dbs.IN("role_id", roleIds))
+	if _, err = ub.ExecContext(this.Context(), this.DB()); err != nil {
+		return err
+	}
+
+	var now = time.Now()
+	var ib = dbs.NewInsertBuilder()
+	ib.UseDialect(this.Dialect())
+	ib.Table(this.TableGrant())
+	ib.Columns("ctx", "role_id", "target", "not_before", "expires_at", "created_on")
+	for _, rId := range roleIds {
+		ib.Values(ctx, rId, target, notBefore, expiresAt, now)
+	}
+	if _, err = ib.ExecContext(this.Context(), this.DB()); err != nil {
 		return err
 	}
 	return nil
@@ -1,10 +1,12 @@
 package redis
 
 import (
+	"context"
 	"fmt"
 	"github.com/smartwalle/dbr"
 	"github.com/smartwalle/dbs"
 	"github.com/smartwalle/odin"
+	"time"
 )
 
 type repository struct {
@@ -34,6 +36,12 @@ func (this *repository) WithTx(tx dbs.TX) odin.Repository {
 	return &nRepo
 }
 
+func (this *repository) WithContext(ctx context.Context) odin.Repository {
+	var nRepo = *this
+	nRepo.Repository = this.Repository.WithContext(ctx)
+	return &nRepo
+}
+
 func (this *repository) buildGrantListKey(ctx int64) (result string) {
 	return fmt.Sprintf("%s:odin:grant:ctx-%d:list", this.tPrefix, ctx)
 }
@@ -43,17 +51,34 @@ func (this *repository) buildTargetKey(ctx int64, target string) (result string)
 }
 
 func (this *repository) CheckPermission(ctx int64, target string, permissionName string) bool {
+	ok, _ := this.CheckPermissionE(ctx, target, permissionName)
+	return ok
+}
+
+func (this *repository) CheckPermissionE(ctx int64, target string, permissionName string) (bool, error) {
+	// dbr 不支持 context.Context，只能在访问缓存之前检查 context.Context 是否已经被取消或者超时
+	if err := this.Context().Err(); err != nil {
+		return false, err
+	}
+
 	var rSess = this.rPool.GetSession()
 	defer rSess.Close()
 
 	var key = this.buildTargetKey(ctx, target)
-	var result = rSess.SISMEMBER(key, permissionName).MustBool()
+	result, err := rSess.SISMEMBER(key, permissionName).Bool()
+	if err != nil {
+		return false, err
+	}
 
 	if result == false {
-		if rSess.EXISTS(key).MustBool() == false {
+		exists, err := rSess.EXISTS(key).Bool()
+		if err != nil {
+			return false, err
+		}
+		if exists == false {
 			pList, err := this.Repository.GetGrantedPermissions(ctx, target)
 			if err != nil {
-				return false
+				return false, err
 			}
 
 			var pNames = make([]interface{}, 0, len(pList))
@@ -63,14 +88,90 @@ func (this *repository) CheckPermission(ctx int64, target string, permissionName
 				}
 				pNames = append(pNames, p.Name)
 			}
-			this.grantPermissions(ctx, key, pNames)
+			this.grantPermissions(ctx, key, pNames, this.cacheTTL(ctx, target))
 		}
 	}
 
-	return result
+	return result, nil
 }
 
-func (this *repository) grantPermissions(ctx int64, key string, permissionNames []interface{}) {
+// CheckPermissions 通过 pipeline 一次性验证所有权限，缓存不存在时只从数据库加载一次
+func (this *repository) CheckPermissions(ctx int64, target string, permissionNames []string) (map[string]bool, error) {
+	if err := this.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	var result = make(map[string]bool, len(permissionNames))
+	if len(permissionNames) == 0 {
+		return result, nil
+	}
+
+	var rSess = this.rPool.GetSession()
+	defer rSess.Close()
+
+	var key = this.buildTargetKey(ctx, target)
+	rSess.Send("EXISTS", key)
+	for _, name := range permissionNames {
+		rSess.Send("SISMEMBER", key, name)
+	}
+	if err := rSess.Flush(); err != nil {
+		return nil, err
+	}
+
+	exists, err := rSess.Receive().Bool()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range permissionNames {
+		ok, err := rSess.Receive().Bool()
+		if err != nil {
+			return nil, err
+		}
+		result[name] = ok
+	}
+	if exists {
+		return result, nil
+	}
+
+	pList, err := this.Repository.GetGrantedPermissions(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	var granted = make(map[string]struct{}, len(pList))
+	var pNames = make([]interface{}, 0, len(pList))
+	for _, p := range pList {
+		granted[p.Name] = struct{}{}
+		pNames = append(pNames, p.Name)
+	}
+	this.grantPermissions(ctx, key, pNames, this.cacheTTL(ctx, target))
+
+	for _, name := range permissionNames {
+		_, result[name] = granted[name]
+	}
+	return result, nil
+}
+
+// cacheTTL 计算 target 权限缓存的有效时长（秒），缓存的有效期不能跨越授权生效或者过期的时间点
+func (this *repository) cacheTTL(ctx int64, target string) int64 {
+	var ttl int64 = 3600
+	grants, err := this.Repository.GetGrantsWithTarget(ctx, target)
+	if err != nil {
+		return ttl
+	}
+	var now = time.Now()
+	for _, grant := range grants {
+		for _, t := range []*time.Time{grant.NotBefore, grant.ExpiresAt} {
+			if t != nil && t.After(now) {
+				if d := int64(t.Sub(now)/time.Second) + 1; d < ttl {
+					ttl = d
+				}
+			}
+		}
+	}
+	return ttl
+}
+
+func (this *repository) grantPermissions(ctx int64, key string, permissionNames []interface{}, ttl int64) {
 	var rSess = this.rPool.GetSession()
 	defer rSess.Close()
 
@@ -90,7 +191,7 @@ func (this *repository) grantPermissions(ctx int64, key string, permissionNames
 	rSess.Send("DEL", key)
 	rSess.Send("SADD", ps...)
 	rSess.Send("SADD", this.buildGrantListKey(ctx), key) // 记录角色授予给了那些对象
-	rSess.Send("EXPIRE", key, 3600)
+	rSess.Send("EXPIRE", key, ttl)
 	rSess.Do("EXEC")
 }
 
@@ -109,6 +210,15 @@ func (this *repository) CleanCache(ctx int64, target string) {
 			rSess.Send("SREM", key, item)
 		}
 		rSess.Do("EXEC")
+	} else if groupId, ok := odin.ParseTargetOfGroup(target); ok {
+		// 授权对象组没有缓存，清除组内所有成员的缓存
+		members, err := this.Repository.GetGroupMembers(ctx, groupId)
+		if err != nil {
+			return
+		}
+		for _, member := range members {
+			rSess.DEL(this.buildTargetKey(ctx, member.Target))
+		}
 	} else {
 		var key = this.buildTargetKey(ctx, target)
 		rSess.DEL(key)